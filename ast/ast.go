@@ -1,16 +1,63 @@
 package ast
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type Node interface {
 	Print(indent int)
+	Span() Span // Fragmento del código fuente del que proviene el nodo
 }
 
+// Position es un punto del código fuente. Offset se cuenta en bytes y
+// Column en caracteres (runas), ambos desde el inicio de la línea o archivo.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`   // Desde 1
+	Column int `json:"column"` // Desde 1
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span es el fragmento del código fuente que ocupa un nodo. End apunta
+// justo después del último carácter del nodo.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+func (s Span) String() string {
+	return s.Start.String() + "-" + s.End.String()
+}
+
+// Contains indica si la posición (línea y columna) está dentro del fragmento
+func (s Span) Contains(line, column int) bool {
+	if line < s.Start.Line || line > s.End.Line {
+		return false
+	}
+	if line == s.Start.Line && column < s.Start.Column {
+		return false
+	}
+	if line == s.End.Line && column >= s.End.Column {
+		return false
+	}
+	return true
+}
+
+// ShowSpans hace que Print muestre el fragmento de código de cada nodo
+var ShowSpans = false
+
 type Program struct {
 	Statements []Statement
+	Loc        Span
 }
 
+func (p *Program) Span() Span { return p.Loc }
 func (p *Program) Print(indent int) {
+	printNodeIndent(indent, p)
 	fmt.Println("Programa")
 	for _, stmt := range p.Statements {
 		stmt.Print(indent + 1)
@@ -29,18 +76,20 @@ type Expression interface {
 
 // Declaraciones
 type DeclareStatement struct {
-	IsConst   bool
-	Name      *Identifier
-	Value     Expression
+	IsConst bool
+	Name    *Identifier
+	Value   Expression
+	Loc     Span
 }
 
 func (d *DeclareStatement) statementNode() {}
+func (d *DeclareStatement) Span() Span     { return d.Loc }
 func (d *DeclareStatement) Print(indent int) {
 	prefix := "definir"
 	if d.IsConst {
 		prefix = "constante"
 	}
-	printIndent(indent)
+	printNodeIndent(indent, d)
 	fmt.Printf("%s %s\n", prefix, d.Name.Value)
 	d.Value.Print(indent + 1)
 }
@@ -49,25 +98,45 @@ func (d *DeclareStatement) Print(indent int) {
 type AssignStatement struct {
 	Name  *Identifier
 	Value Expression
+	Loc   Span
 }
 
 func (a *AssignStatement) statementNode() {}
+func (a *AssignStatement) Span() Span     { return a.Loc }
 func (a *AssignStatement) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, a)
 	fmt.Printf("Asignación: %s\n", a.Name.Value)
 	a.Value.Print(indent + 1)
 }
 
+// Asignación a un elemento (lista[i] = valor, dic["clave"] = valor)
+type IndexAssignStatement struct {
+	Target *IndexExpression
+	Value  Expression
+	Loc    Span
+}
+
+func (a *IndexAssignStatement) statementNode() {}
+func (a *IndexAssignStatement) Span() Span     { return a.Loc }
+func (a *IndexAssignStatement) Print(indent int) {
+	printNodeIndent(indent, a)
+	fmt.Println("Asignación a elemento")
+	a.Target.Print(indent + 1)
+	a.Value.Print(indent + 1)
+}
+
 // Condicionales
 type IfStatement struct {
 	Condition Expression
 	Then      *BlockStatement
 	Else      *BlockStatement
+	Loc       Span
 }
 
 func (i *IfStatement) statementNode() {}
+func (i *IfStatement) Span() Span     { return i.Loc }
 func (i *IfStatement) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, i)
 	fmt.Println("Si")
 	i.Condition.Print(indent + 1)
 	printIndent(indent)
@@ -82,29 +151,43 @@ func (i *IfStatement) Print(indent int) {
 
 // Bucles
 type WhileStatement struct {
+	Label     *Identifier // Etiqueta opcional (exterior: mientras ...)
 	Condition Expression
 	Body      *BlockStatement
+	Loc       Span
 }
 
 func (w *WhileStatement) statementNode() {}
+func (w *WhileStatement) Span() Span     { return w.Loc }
 func (w *WhileStatement) Print(indent int) {
-	printIndent(indent)
-	fmt.Println("Mientras")
+	printNodeIndent(indent, w)
+	if w.Label != nil {
+		fmt.Printf("Mientras (etiqueta: %s)\n", w.Label.Value)
+	} else {
+		fmt.Println("Mientras")
+	}
 	w.Condition.Print(indent + 1)
 	w.Body.Print(indent + 1)
 }
 
 type RepeatStatement struct {
+	Label    *Identifier // Etiqueta opcional (exterior: repetir ...)
 	Variable *Identifier
 	From     Expression
 	To       Expression
 	Body     *BlockStatement
+	Loc      Span
 }
 
 func (r *RepeatStatement) statementNode() {}
+func (r *RepeatStatement) Span() Span     { return r.Loc }
 func (r *RepeatStatement) Print(indent int) {
-	printIndent(indent)
-	fmt.Printf("Repetir %s desde\n", r.Variable.Value)
+	printNodeIndent(indent, r)
+	if r.Label != nil {
+		fmt.Printf("Repetir %s desde (etiqueta: %s)\n", r.Variable.Value, r.Label.Value)
+	} else {
+		fmt.Printf("Repetir %s desde\n", r.Variable.Value)
+	}
 	r.From.Print(indent + 1)
 	printIndent(indent)
 	fmt.Println("hasta")
@@ -117,11 +200,13 @@ type FunctionStatement struct {
 	Name       *Identifier
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Loc        Span
 }
 
 func (f *FunctionStatement) statementNode() {}
+func (f *FunctionStatement) Span() Span     { return f.Loc }
 func (f *FunctionStatement) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, f)
 	fmt.Printf("Función: %s\n", f.Name.Value)
 	f.Body.Print(indent + 1)
 }
@@ -129,11 +214,13 @@ func (f *FunctionStatement) Print(indent int) {
 // Mostrar
 type ShowStatement struct {
 	Value Expression
+	Loc   Span
 }
 
 func (s *ShowStatement) statementNode() {}
+func (s *ShowStatement) Span() Span     { return s.Loc }
 func (s *ShowStatement) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, s)
 	fmt.Println("Mostrar")
 	s.Value.Print(indent + 1)
 }
@@ -141,23 +228,105 @@ func (s *ShowStatement) Print(indent int) {
 // Retorno
 type ReturnStatement struct {
 	Value Expression
+	Loc   Span
 }
 
 func (r *ReturnStatement) statementNode() {}
+func (r *ReturnStatement) Span() Span     { return r.Loc }
 func (r *ReturnStatement) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, r)
 	fmt.Println("Retornar")
 	if r.Value != nil {
 		r.Value.Print(indent + 1)
 	}
 }
 
+// Control de bucles
+type BreakStatement struct {
+	Label *Identifier // nil si sale del bucle más interno
+	Loc   Span
+}
+
+func (b *BreakStatement) statementNode() {}
+func (b *BreakStatement) Span() Span     { return b.Loc }
+func (b *BreakStatement) Print(indent int) {
+	printNodeIndent(indent, b)
+	if b.Label != nil {
+		fmt.Printf("Salir %s\n", b.Label.Value)
+	} else {
+		fmt.Println("Salir")
+	}
+}
+
+type ContinueStatement struct {
+	Label *Identifier // nil si continúa el bucle más interno
+	Loc   Span
+}
+
+func (c *ContinueStatement) statementNode() {}
+func (c *ContinueStatement) Span() Span     { return c.Loc }
+func (c *ContinueStatement) Print(indent int) {
+	printNodeIndent(indent, c)
+	if c.Label != nil {
+		fmt.Printf("Continuar %s\n", c.Label.Value)
+	} else {
+		fmt.Println("Continuar")
+	}
+}
+
+// TryStatement - intentar ... capturar e hacer ... finalmente ... fin
+type TryStatement struct {
+	Body      *BlockStatement
+	CatchName *Identifier     // Variable que recibe el error; nil si no se nombra
+	Catch     *BlockStatement // nil si no hay 'capturar'
+	Finally   *BlockStatement // nil si no hay 'finalmente'
+	Loc       Span
+}
+
+func (t *TryStatement) statementNode() {}
+func (t *TryStatement) Span() Span     { return t.Loc }
+func (t *TryStatement) Print(indent int) {
+	printNodeIndent(indent, t)
+	fmt.Println("Intentar")
+	t.Body.Print(indent + 1)
+	if t.Catch != nil {
+		printIndent(indent)
+		if t.CatchName != nil {
+			fmt.Printf("Capturar %s\n", t.CatchName.Value)
+		} else {
+			fmt.Println("Capturar")
+		}
+		t.Catch.Print(indent + 1)
+	}
+	if t.Finally != nil {
+		printIndent(indent)
+		fmt.Println("Finalmente")
+		t.Finally.Print(indent + 1)
+	}
+}
+
+// ThrowStatement - lanzar expresión
+type ThrowStatement struct {
+	Value Expression
+	Loc   Span
+}
+
+func (t *ThrowStatement) statementNode() {}
+func (t *ThrowStatement) Span() Span     { return t.Loc }
+func (t *ThrowStatement) Print(indent int) {
+	printNodeIndent(indent, t)
+	fmt.Println("Lanzar")
+	t.Value.Print(indent + 1)
+}
+
 // ExpressionStatement - para expresiones que se ejecutan como sentencias (ej: llamadas a función)
 type ExpressionStatement struct {
 	Expression Expression
+	Loc        Span
 }
 
 func (e *ExpressionStatement) statementNode() {}
+func (e *ExpressionStatement) Span() Span     { return e.Loc }
 func (e *ExpressionStatement) Print(indent int) {
 	e.Expression.Print(indent)
 }
@@ -165,9 +334,11 @@ func (e *ExpressionStatement) Print(indent int) {
 // Bloques
 type BlockStatement struct {
 	Statements []Statement
+	Loc        Span
 }
 
 func (b *BlockStatement) statementNode() {}
+func (b *BlockStatement) Span() Span     { return b.Loc }
 func (b *BlockStatement) Print(indent int) {
 	for _, stmt := range b.Statements {
 		stmt.Print(indent)
@@ -177,51 +348,79 @@ func (b *BlockStatement) Print(indent int) {
 // Expresiones
 type Identifier struct {
 	Value string
+	Loc   Span
 }
 
 func (i *Identifier) expressionNode() {}
+func (i *Identifier) Span() Span      { return i.Loc }
 func (i *Identifier) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, i)
 	fmt.Printf("Identificador: %s\n", i.Value)
 }
 
 type IntegerLiteral struct {
 	Value int64
+	Loc   Span
 }
 
 func (i *IntegerLiteral) expressionNode() {}
+func (i *IntegerLiteral) Span() Span      { return i.Loc }
 func (i *IntegerLiteral) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, i)
 	fmt.Printf("Entero: %d\n", i.Value)
 }
 
 type FloatLiteral struct {
 	Value float64
+	Loc   Span
 }
 
 func (f *FloatLiteral) expressionNode() {}
+func (f *FloatLiteral) Span() Span      { return f.Loc }
 func (f *FloatLiteral) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, f)
 	fmt.Printf("Decimal: %f\n", f.Value)
 }
 
 type StringLiteral struct {
 	Value string
+	Loc   Span
 }
 
 func (s *StringLiteral) expressionNode() {}
+func (s *StringLiteral) Span() Span      { return s.Loc }
 func (s *StringLiteral) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, s)
 	fmt.Printf("Cadena: %s\n", s.Value)
 }
 
+// InterpolatedString es una cadena con expresiones ${...}. Parts alterna los
+// trozos de texto (StringLiteral) con las expresiones, en el orden en que
+// aparecen.
+type InterpolatedString struct {
+	Parts []Expression
+	Loc   Span
+}
+
+func (s *InterpolatedString) expressionNode() {}
+func (s *InterpolatedString) Span() Span      { return s.Loc }
+func (s *InterpolatedString) Print(indent int) {
+	printNodeIndent(indent, s)
+	fmt.Printf("Cadena interpolada (%d partes)\n", len(s.Parts))
+	for _, part := range s.Parts {
+		part.Print(indent + 1)
+	}
+}
+
 type BooleanLiteral struct {
 	Value bool
+	Loc   Span
 }
 
 func (b *BooleanLiteral) expressionNode() {}
+func (b *BooleanLiteral) Span() Span      { return b.Loc }
 func (b *BooleanLiteral) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, b)
 	fmt.Printf("Booleano: %v\n", b.Value)
 }
 
@@ -229,11 +428,13 @@ type InfixExpression struct {
 	Left     Expression
 	Operator string
 	Right    Expression
+	Loc      Span
 }
 
 func (i *InfixExpression) expressionNode() {}
+func (i *InfixExpression) Span() Span      { return i.Loc }
 func (i *InfixExpression) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, i)
 	fmt.Printf("Operador: %s\n", i.Operator)
 	i.Left.Print(indent + 1)
 	i.Right.Print(indent + 1)
@@ -242,23 +443,47 @@ func (i *InfixExpression) Print(indent int) {
 type PrefixExpression struct {
 	Operator string
 	Right    Expression
+	Loc      Span
 }
 
 func (p *PrefixExpression) expressionNode() {}
+func (p *PrefixExpression) Span() Span      { return p.Loc }
 func (p *PrefixExpression) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, p)
 	fmt.Printf("Operador: %s\n", p.Operator)
 	p.Right.Print(indent + 1)
 }
 
+// FunctionLiteral es una función anónima: función(x) hacer ... fin o x => x * 2.
+// La forma corta se representa con un cuerpo que retorna la expresión.
+type FunctionLiteral struct {
+	Parameters []*Identifier
+	Body       *BlockStatement
+	Loc        Span
+}
+
+func (f *FunctionLiteral) expressionNode() {}
+func (f *FunctionLiteral) Span() Span      { return f.Loc }
+func (f *FunctionLiteral) Print(indent int) {
+	printNodeIndent(indent, f)
+	names := make([]string, len(f.Parameters))
+	for i, param := range f.Parameters {
+		names[i] = param.Value
+	}
+	fmt.Printf("Función anónima (%s)\n", strings.Join(names, ", "))
+	f.Body.Print(indent + 1)
+}
+
 type CallExpression struct {
 	Function  Expression
 	Arguments []Expression
+	Loc       Span
 }
 
 func (c *CallExpression) expressionNode() {}
+func (c *CallExpression) Span() Span      { return c.Loc }
 func (c *CallExpression) Print(indent int) {
-	printIndent(indent)
+	printNodeIndent(indent, c)
 	fmt.Println("Llamada función")
 	c.Function.Print(indent + 1)
 	for _, arg := range c.Arguments {
@@ -266,9 +491,72 @@ func (c *CallExpression) Print(indent int) {
 	}
 }
 
+type ListLiteral struct {
+	Elements []Expression
+	Loc      Span
+}
+
+func (l *ListLiteral) expressionNode() {}
+func (l *ListLiteral) Span() Span      { return l.Loc }
+func (l *ListLiteral) Print(indent int) {
+	printNodeIndent(indent, l)
+	fmt.Printf("Lista (%d elementos)\n", len(l.Elements))
+	for _, el := range l.Elements {
+		el.Print(indent + 1)
+	}
+}
+
+type DictLiteral struct {
+	Pairs []*DictPair // En el orden en que aparecen en el código
+	Loc   Span
+}
+
+type DictPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (d *DictLiteral) expressionNode() {}
+func (d *DictLiteral) Span() Span      { return d.Loc }
+func (d *DictLiteral) Print(indent int) {
+	printNodeIndent(indent, d)
+	fmt.Printf("Diccionario (%d pares)\n", len(d.Pairs))
+	for _, pair := range d.Pairs {
+		printIndent(indent + 1)
+		fmt.Println("Clave")
+		pair.Key.Print(indent + 2)
+		printIndent(indent + 1)
+		fmt.Println("Valor")
+		pair.Value.Print(indent + 2)
+	}
+}
+
+type IndexExpression struct {
+	Left  Expression
+	Index Expression
+	Loc   Span
+}
+
+func (i *IndexExpression) expressionNode() {}
+func (i *IndexExpression) Span() Span      { return i.Loc }
+func (i *IndexExpression) Print(indent int) {
+	printNodeIndent(indent, i)
+	fmt.Println("Índice")
+	i.Left.Print(indent + 1)
+	i.Index.Print(indent + 1)
+}
+
+// printNodeIndent sangra la primera línea de un nodo y, si ShowSpans está
+// activo, antepone su posición en el código fuente
+func printNodeIndent(indent int, node Node) {
+	printIndent(indent)
+	if ShowSpans {
+		fmt.Printf("[%s] ", node.Span())
+	}
+}
+
 func printIndent(indent int) {
 	for i := 0; i < indent; i++ {
 		fmt.Print("  ")
 	}
 }
-
@@ -0,0 +1,111 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MarshalNode convierte un nodo y todos sus hijos a JSON. Cada nodo es un
+// objeto con su tipo en "kind", sus campos en el orden en que se declaran
+// (con el nombre en minúscula inicial) y su fragmento de código en "span":
+//
+//	{"kind":"Identifier","value":"x","span":{"start":{...},"end":{...}}}
+func MarshalNode(node Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, reflect.ValueOf(node)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON permite pasar el programa directamente a json.Marshal
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return MarshalNode(p)
+}
+
+var (
+	nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+	spanType = reflect.TypeOf(Span{})
+)
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct && v.Elem().Type() != spanType {
+			return encodeStruct(buf, v)
+		}
+		return encodeValue(buf, v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	default:
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+}
+
+// encodeStruct escribe un nodo (o una estructura auxiliar como DictPair)
+// conservando el orden de los campos
+func encodeStruct(buf *bytes.Buffer, ptr reflect.Value) error {
+	v := ptr.Elem()
+	t := v.Type()
+	buf.WriteByte('{')
+	first := true
+	if ptr.Type().Implements(nodeType) {
+		buf.WriteString(`"kind":`)
+		data, _ := json.Marshal(t.Name())
+		buf.Write(data)
+		first = false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := lowerFirst(field.Name)
+		if field.Name == "Loc" {
+			name = "span"
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		data, _ := json.Marshal(name)
+		buf.Write(data)
+		buf.WriteByte(':')
+		if err := encodeValue(buf, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
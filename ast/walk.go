@@ -0,0 +1,121 @@
+package ast
+
+// Inspect recorre el árbol en profundidad empezando por node y llama a f con
+// cada nodo, en el orden en que aparecen en el código. Si f devuelve false,
+// no se recorren los hijos de ese nodo. Los campos opcionales vacíos (un
+// 'sino' que no existe, un 'retornar' sin valor...) no se visitan.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			Inspect(stmt, f)
+		}
+	case *DeclareStatement:
+		inspectIdent(n.Name, f)
+		inspectExpr(n.Value, f)
+	case *AssignStatement:
+		inspectIdent(n.Name, f)
+		inspectExpr(n.Value, f)
+	case *IndexAssignStatement:
+		if n.Target != nil {
+			Inspect(n.Target, f)
+		}
+		inspectExpr(n.Value, f)
+	case *IfStatement:
+		inspectExpr(n.Condition, f)
+		inspectBlock(n.Then, f)
+		inspectBlock(n.Else, f)
+	case *WhileStatement:
+		inspectIdent(n.Label, f)
+		inspectExpr(n.Condition, f)
+		inspectBlock(n.Body, f)
+	case *RepeatStatement:
+		inspectIdent(n.Label, f)
+		inspectIdent(n.Variable, f)
+		inspectExpr(n.From, f)
+		inspectExpr(n.To, f)
+		inspectBlock(n.Body, f)
+	case *FunctionStatement:
+		inspectIdent(n.Name, f)
+		for _, param := range n.Parameters {
+			inspectIdent(param, f)
+		}
+		inspectBlock(n.Body, f)
+	case *ShowStatement:
+		inspectExpr(n.Value, f)
+	case *ReturnStatement:
+		inspectExpr(n.Value, f)
+	case *BreakStatement:
+		inspectIdent(n.Label, f)
+	case *ContinueStatement:
+		inspectIdent(n.Label, f)
+	case *TryStatement:
+		inspectBlock(n.Body, f)
+		inspectIdent(n.CatchName, f)
+		inspectBlock(n.Catch, f)
+		inspectBlock(n.Finally, f)
+	case *ThrowStatement:
+		inspectExpr(n.Value, f)
+	case *ExpressionStatement:
+		inspectExpr(n.Expression, f)
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			Inspect(stmt, f)
+		}
+	case *InfixExpression:
+		inspectExpr(n.Left, f)
+		inspectExpr(n.Right, f)
+	case *PrefixExpression:
+		inspectExpr(n.Right, f)
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			inspectIdent(param, f)
+		}
+		inspectBlock(n.Body, f)
+	case *CallExpression:
+		inspectExpr(n.Function, f)
+		for _, arg := range n.Arguments {
+			inspectExpr(arg, f)
+		}
+	case *ListLiteral:
+		for _, el := range n.Elements {
+			inspectExpr(el, f)
+		}
+	case *InterpolatedString:
+		for _, part := range n.Parts {
+			inspectExpr(part, f)
+		}
+	case *DictLiteral:
+		for _, pair := range n.Pairs {
+			inspectExpr(pair.Key, f)
+			inspectExpr(pair.Value, f)
+		}
+	case *IndexExpression:
+		inspectExpr(n.Left, f)
+		inspectExpr(n.Index, f)
+	}
+}
+
+// Los campos opcionales son punteros que pueden ser nil; se comprueban antes
+// de convertirlos en Node para no visitar un nodo vacío
+
+func inspectIdent(ident *Identifier, f func(Node) bool) {
+	if ident != nil {
+		Inspect(ident, f)
+	}
+}
+
+func inspectBlock(block *BlockStatement, f func(Node) bool) {
+	if block != nil {
+		Inspect(block, f)
+	}
+}
+
+func inspectExpr(expr Expression, f func(Node) bool) {
+	if expr != nil {
+		Inspect(expr, f)
+	}
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"flux/ast"
+)
+
+// astCommand muestra el árbol sintáctico del programa. Si hay errores de
+// sintaxis no hay árbol: se muestran los diagnósticos.
+func astCommand(env *Env, opts *options) int {
+	u, ok := load(env, opts)
+	if !ok {
+		return exitUsage
+	}
+	parsed := u.parse()
+
+	if opts.format == formatJSON {
+		// El programa se codifica con ast.MarshalNode a través de MarshalJSON
+		var program interface{}
+		if parsed {
+			program = u.program
+		}
+		writeJSON(env.Stdout, map[string]interface{}{
+			"file":        u.filename,
+			"ast":         program,
+			"diagnostics": u.jsonDiagnostics(),
+		})
+		return status(parsed)
+	}
+
+	if !parsed {
+		u.reportDiagnostics(env.Stdout)
+		return exitFailure
+	}
+	ast.ShowSpans = opts.showSpans
+	u.program.Print(0)
+	return exitOK
+}
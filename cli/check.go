@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"flux/diagnostic"
+	"fmt"
+)
+
+// checkCommand hace el análisis léxico, sintáctico y semántico sin ejecutar
+// el programa. Termina con código 0 si no hay errores (las advertencias no
+// cuentan) y con 1 si los hay.
+func checkCommand(env *Env, opts *options) int {
+	u, ok := load(env, opts)
+	if !ok {
+		return exitUsage
+	}
+	valid := u.analyze(opts.dynamicScope)
+
+	if opts.format == formatJSON {
+		errors, warnings := 0, 0
+		for _, d := range u.diagnostics {
+			if d.Severity == diagnostic.Error {
+				errors++
+			} else if d.Severity == diagnostic.Warning {
+				warnings++
+			}
+		}
+		writeJSON(env.Stdout, map[string]interface{}{
+			"file":        u.filename,
+			"ok":          valid,
+			"errors":      errors,
+			"warnings":    warnings,
+			"diagnostics": u.jsonDiagnostics(),
+		})
+		return status(valid)
+	}
+
+	u.reportDiagnostics(env.Stdout)
+	if valid {
+		fmt.Fprintf(env.Stdout, "%s: sin errores\n", u.filename)
+	}
+	return status(valid)
+}
@@ -0,0 +1,404 @@
+// Package cli implementa la línea de comandos de Flux. Cada subcomando
+// (run, tokens, ast, check...) lee sus propias opciones y puede escribir su
+// resultado como texto o como JSON para que lo consuman otros programas.
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"flux/ast"
+	"flux/diagnostic"
+	"flux/evaluator"
+	"flux/lexer"
+	"flux/parser"
+	"flux/repl"
+	"flux/semantic"
+	"flux/trace"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const usage = `Uso: flux [comando] [opciones] archivo.flux
+
+Comandos:
+  run      ejecuta el programa (es el comando por defecto)
+  tokens   muestra la lista de tokens
+  ast      muestra el árbol sintáctico
+  check    analiza el programa sin ejecutarlo y reporta los problemas
+  fmt      escribe los programas en su forma canónica
+  vet      busca código sospechoso (variables sin usar, código inalcanzable...)
+  depurar  ejecuta el programa paso a paso con el depurador interactivo
+  traza    ejecuta el programa y registra cada paso (JSON o página HTML)
+  comparar ejecuta los programas con los dos motores y compara su salida
+  lsp      inicia el servidor de lenguaje para editores (por stdin/stdout)
+
+Sin argumentos se abre la consola interactiva.
+
+Opciones:
+  --formato=texto|json   formato de la salida (por defecto texto)
+  --alcance-dinamico     resolver los nombres como en versiones anteriores
+  --motor=arbol|vm       (run) ejecutar recorriendo el árbol (por defecto) o con la máquina virtual
+  --tiempo-max=5s        (run) interrumpe el programa si tarda más
+  --max-pasos=N          (run) interrumpe el programa tras ejecutar N sentencias
+  --max-profundidad=N    (run) profundidad máxima de llamadas (por defecto 10000)
+  --entrada=archivo      (run, traza, depurar, comparar) datos que lee el programa con 'leer'
+  --semilla=N            (run, comparar) semilla de 'aleatorio', para repetir una ejecución
+  --posiciones           (ast) muestra el fragmento de código de cada nodo
+  --escribir             (fmt) reescribe los archivos en lugar de mostrarlos
+  --diff                 (fmt) muestra las diferencias con el archivo original
+  --reglas=a,b           (vet) aplica solo estas reglas
+  --sin=a,b              (vet) aplica todas las reglas menos estas
+  --listar               (vet) muestra las reglas disponibles
+  --formato=json|html    (traza) la traza como JSON (por defecto) o como visor HTML
+  --max-pasos=N          (traza) deja de registrar tras N pasos (por defecto 10000)
+
+Escribe 'flux <comando> -h' para ver las opciones de cada comando.
+`
+
+// Códigos de salida
+const (
+	exitOK      = 0
+	exitFailure = 1 // El programa tiene errores o falló al ejecutarse
+	exitUsage   = 2 // Argumentos incorrectos o archivo ilegible
+)
+
+// Formatos de salida
+const (
+	formatText = "texto"
+	formatJSON = "json"
+	formatHTML = "html" // Solo para traza
+)
+
+// command es un subcomando. Recibe las opciones ya leídas y devuelve el
+// código de salida.
+type command func(env *Env, opts *options) int
+
+var commands = map[string]command{
+	"run":      runCommand,
+	"tokens":   tokensCommand,
+	"ast":      astCommand,
+	"check":    checkCommand,
+	"fmt":      fmtCommand,
+	"vet":      vetCommand,
+	"depurar":  depurarCommand,
+	"traza":    trazaCommand,
+	"comparar": compararCommand,
+	"lsp":      lspCommand,
+}
+
+// multiFile son los comandos que aceptan varios archivos
+var multiFile = map[string]bool{"fmt": true, "comparar": true}
+
+// allSamples son los comandos que, sin archivos, usan todos los .flux del
+// directorio actual
+var allSamples = map[string]bool{"comparar": true}
+
+// noFile son los comandos que no trabajan sobre un archivo
+var noFile = map[string]bool{"lsp": true}
+
+// Env son la entrada y las salidas de la línea de comandos
+type Env struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// options son las opciones comunes a todos los subcomandos
+type options struct {
+	format       string
+	dynamicScope bool
+	showSpans    bool
+	write        bool
+	diff         bool
+	rules        string // Reglas de vet separadas por comas
+	skipRules    string
+	listRules    bool
+	maxSteps     int // Pasos registrados (traza) o ejecutados (run)
+	maxDepth     int
+	timeout      time.Duration
+	input        string // Archivo del que lee el programa (--entrada)
+	seed         *int64 // Semilla de 'aleatorio' (--semilla), nil si no se indicó
+	engine       string
+	filename     string   // Primer archivo
+	files        []string // Todos los archivos, para los comandos que aceptan varios
+}
+
+// Main ejecuta la línea de comandos con los argumentos indicados (sin el
+// nombre del programa) y devuelve el código de salida
+func Main(env *Env, args []string) int {
+	name := "run"
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			name, args = args[0], args[1:]
+		} else if args[0] == "ayuda" || args[0] == "-h" || args[0] == "--help" {
+			fmt.Fprint(env.Stdout, usage)
+			return exitOK
+		}
+	}
+
+	opts, err := parseOptions(env, name, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		fmt.Fprintf(env.Stderr, "flux %s: %v\n\n%s", name, err, usage)
+		return exitUsage
+	}
+
+	if name == "vet" && opts.listRules {
+		return listRules(env)
+	}
+	if opts.filename == "" && !noFile[name] {
+		// 'flux' sin archivo abre la consola interactiva
+		if name == "run" {
+			repl.Start(env.Stdin, env.Stdout, opts.dynamicScope)
+			return exitOK
+		}
+		fmt.Fprintf(env.Stderr, "flux %s: falta el archivo\n\n%s", name, usage)
+		return exitUsage
+	}
+	return commands[name](env, opts)
+}
+
+// parseOptions lee las opciones de un subcomando. Las opciones pueden ir
+// antes o después del nombre del archivo.
+func parseOptions(env *Env, name string, args []string) (*options, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("flux "+name, flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	if name == "traza" {
+		fs.StringVar(&opts.format, "formato", formatJSON, "formato de la traza: json o html")
+		fs.IntVar(&opts.maxSteps, "max-pasos", trace.DefaultMaxSteps, "número máximo de pasos registrados")
+	} else {
+		fs.StringVar(&opts.format, "formato", formatText, "formato de la salida: texto o json")
+	}
+	fs.BoolVar(&opts.dynamicScope, "alcance-dinamico", false, "resolver los nombres como en versiones anteriores (scope de quien llama)")
+	if name == "run" {
+		fs.StringVar(&opts.engine, "motor", engineTree, "motor de ejecución: arbol o vm")
+		fs.DurationVar(&opts.timeout, "tiempo-max", 0, "interrumpir el programa tras este tiempo (por ejemplo 5s)")
+		fs.IntVar(&opts.maxSteps, "max-pasos", 0, "interrumpir el programa tras ejecutar N sentencias")
+		fs.IntVar(&opts.maxDepth, "max-profundidad", evaluator.DefaultMaxDepth, "profundidad máxima de llamadas")
+	}
+	switch name {
+	case "run", "traza", "depurar", "comparar":
+		fs.StringVar(&opts.input, "entrada", "", "archivo del que lee el programa con 'leer' (por defecto la entrada estándar)")
+	}
+	var seed int64
+	switch name {
+	case "run", "comparar":
+		fs.Int64Var(&seed, "semilla", 0, "semilla de 'aleatorio' (por defecto, una distinta en cada ejecución)")
+	}
+	if name == "ast" {
+		fs.BoolVar(&opts.showSpans, "posiciones", false, "mostrar el fragmento de código de cada nodo")
+	}
+	if name == "fmt" {
+		fs.BoolVar(&opts.write, "escribir", false, "reescribir los archivos con el resultado")
+		fs.BoolVar(&opts.diff, "diff", false, "mostrar las diferencias con el archivo original")
+	}
+	if name == "vet" {
+		fs.StringVar(&opts.rules, "reglas", "", "aplicar solo estas reglas (separadas por comas)")
+		fs.StringVar(&opts.skipRules, "sin", "", "no aplicar estas reglas (separadas por comas)")
+		fs.BoolVar(&opts.listRules, "listar", false, "mostrar las reglas disponibles")
+	}
+
+	var files []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "semilla" {
+			opts.seed = &seed
+		}
+	})
+
+	if name == "traza" {
+		if opts.format != formatJSON && opts.format != formatHTML {
+			return nil, fmt.Errorf("formato desconocido '%s' (usa json o html)", opts.format)
+		}
+		if opts.maxSteps < 1 {
+			return nil, fmt.Errorf("--max-pasos debe ser al menos 1")
+		}
+	} else if opts.format != formatText && opts.format != formatJSON {
+		return nil, fmt.Errorf("formato desconocido '%s' (usa texto o json)", opts.format)
+	}
+	if name == "run" {
+		if opts.engine != engineTree && opts.engine != engineVM {
+			return nil, fmt.Errorf("motor desconocido '%s' (usa arbol o vm)", opts.engine)
+		}
+		if opts.engine == engineVM && opts.dynamicScope {
+			return nil, fmt.Errorf("--alcance-dinamico no está disponible con --motor=vm")
+		}
+		if opts.engine == engineVM && opts.maxSteps > 0 {
+			return nil, fmt.Errorf("--max-pasos no está disponible con --motor=vm")
+		}
+		switch {
+		case opts.timeout < 0:
+			return nil, fmt.Errorf("--tiempo-max no puede ser negativo")
+		case opts.maxSteps < 0:
+			return nil, fmt.Errorf("--max-pasos no puede ser negativo")
+		case opts.maxDepth < 1:
+			return nil, fmt.Errorf("--max-profundidad debe ser al menos 1")
+		}
+	}
+	if len(files) == 0 && allSamples[name] {
+		samples, err := filepath.Glob("*.flux")
+		if err != nil || len(samples) == 0 {
+			return nil, fmt.Errorf("no hay archivos .flux en el directorio actual")
+		}
+		files = samples
+	}
+	if len(files) > 0 && noFile[name] {
+		return nil, fmt.Errorf("no se esperaba ningún archivo")
+	}
+	if len(files) > 1 && !multiFile[name] {
+		return nil, fmt.Errorf("se esperaba un solo archivo, se recibieron %d", len(files))
+	}
+	if len(files) > 0 {
+		opts.filename = files[0]
+	}
+	opts.files = files
+	return opts, nil
+}
+
+// unit es un archivo fuente y el resultado de analizarlo
+type unit struct {
+	filename    string
+	source      string
+	tokens      []lexer.Token
+	comments    []lexer.Comment
+	program     *ast.Program // nil si hubo errores de sintaxis
+	diagnostics diagnostic.List
+}
+
+// load lee el archivo de las opciones. Si no se puede leer, informa del
+// error y devuelve false.
+func load(env *Env, opts *options) (*unit, bool) {
+	return loadFile(env, opts.filename)
+}
+
+func loadFile(env *Env, filename string) (*unit, bool) {
+	sourceBytes, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "Error leyendo archivo: %v\n", err)
+		return nil, false
+	}
+	// Convertir a string UTF-8, removiendo BOM si existe
+	source := strings.TrimPrefix(string(sourceBytes), "\uFEFF")
+	return &unit{filename: filename, source: source}, true
+}
+
+// lex hace el análisis léxico
+func (u *unit) lex() {
+	l := lexer.New(u.source)
+	u.tokens, _ = l.Tokenize()
+	u.comments = l.Comments()
+	u.diagnostics = append(u.diagnostics, l.Diagnostics()...)
+}
+
+// parse hace el análisis léxico y sintáctico. Ambos se recuperan de los
+// errores, así que se reportan todos juntos.
+func (u *unit) parse() bool {
+	u.lex()
+	p := parser.New(u.tokens)
+	program, _ := p.Parse()
+	u.diagnostics = append(u.diagnostics, p.Errors()...)
+	u.diagnostics.Sort()
+	if u.diagnostics.HasErrors() {
+		return false
+	}
+	u.program = program
+	return true
+}
+
+// analyze hace el análisis completo, hasta el semántico
+func (u *unit) analyze(dynamicScope bool) bool {
+	if !u.parse() {
+		return false
+	}
+	analyzer := semantic.New(evaluator.BuiltinNames(), evaluator.ConstantNames())
+	analyzer.SetDynamicScope(dynamicScope)
+	analyzer.Analyze(u.program)
+	u.diagnostics = append(u.diagnostics, analyzer.Errors()...)
+	u.diagnostics.Sort()
+	return !u.diagnostics.HasErrors()
+}
+
+// reportDiagnostics muestra los diagnósticos con el fragmento de código de
+// cada uno y un resumen al final
+func (u *unit) reportDiagnostics(w io.Writer) {
+	diagnostic.RenderAll(w, u.filename, u.source, u.diagnostics)
+	errors := countSeverity(u.diagnostics, diagnostic.Error)
+	warnings := countSeverity(u.diagnostics, diagnostic.Warning)
+
+	var parts []string
+	if errors > 0 {
+		parts = append(parts, plural(errors, "error", "errores"))
+	}
+	if warnings > 0 {
+		parts = append(parts, plural(warnings, "advertencia", "advertencias"))
+	}
+	switch {
+	case len(parts) == 0:
+	case errors+warnings == 1:
+		fmt.Fprintf(w, "\nse encontró %s\n", parts[0])
+	default:
+		fmt.Fprintf(w, "\nse encontraron %s\n", strings.Join(parts, " y "))
+	}
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+func countSeverity(list diagnostic.List, severity diagnostic.Severity) int {
+	n := 0
+	for _, d := range list {
+		if d.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// jsonDiagnostics devuelve los diagnósticos listos para codificar; una
+// lista vacía se codifica como [] y no como null
+func (u *unit) jsonDiagnostics() diagnostic.List {
+	if u.diagnostics == nil {
+		return diagnostic.List{}
+	}
+	return u.diagnostics
+}
+
+// writeJSON escribe un valor como JSON con sangría
+func writeJSON(w io.Writer, value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		fmt.Fprintf(w, "{\"error\": %q}\n", err.Error())
+		return
+	}
+	w.Write(data)
+	fmt.Fprintln(w)
+}
+
+// status devuelve el código de salida según haya errores o no
+func status(ok bool) int {
+	if ok {
+		return exitOK
+	}
+	return exitFailure
+}
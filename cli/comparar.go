@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"bytes"
+	"flux/evaluator"
+	"fmt"
+	"os"
+)
+
+// compareSeed es la semilla de 'aleatorio' de los dos motores si no se
+// indica --semilla: tiene que ser la misma para que la salida coincida
+const compareSeed = 1
+
+// comparison es el resultado de ejecutar un archivo con los dos motores
+type comparison struct {
+	File  string `json:"file"`
+	Equal bool   `json:"equal"`
+	Tree  string `json:"tree"` // Salida con el evaluador
+	VM    string `json:"vm"`   // Salida con la máquina virtual
+	Diff  string `json:"diff,omitempty"`
+}
+
+// compararCommand ejecuta cada programa con el evaluador y con la máquina
+// virtual y compara lo que escriben, incluidos los errores de ejecución.
+// Sin archivos usa todos los .flux del directorio actual. Los dos motores
+// reciben la misma entrada: el archivo de --entrada o ninguna, y la misma
+// semilla de 'aleatorio': la de --semilla o compareSeed. Termina con código
+// 1 si algún programa no da la misma salida con los dos motores.
+func compararCommand(env *Env, opts *options) int {
+	var input []byte
+	if opts.input != "" {
+		data, err := os.ReadFile(opts.input)
+		if err != nil {
+			fmt.Fprintf(env.Stderr, "Error leyendo la entrada: %v\n", err)
+			return exitUsage
+		}
+		input = data
+	}
+
+	seed := int64(compareSeed)
+	if opts.seed != nil {
+		seed = *opts.seed
+	}
+
+	failed, different := false, 0
+	var results []comparison
+
+	for _, filename := range opts.files {
+		u, ok := loadFile(env, filename)
+		if !ok {
+			failed = true
+			continue
+		}
+		if !u.analyze(false) {
+			// Un programa con errores no llega a ejecutarse con ningún motor
+			fmt.Fprintf(env.Stderr, "%s: no se compara porque tiene errores (usa 'flux check')\n", filename)
+			failed = true
+			continue
+		}
+
+		result := comparison{
+			File: filename,
+			Tree: engineOutput(u, engineTree, input, seed),
+			VM:   engineOutput(u, engineVM, input, seed),
+		}
+		result.Equal = result.Tree == result.VM
+		if !result.Equal {
+			different++
+			result.Diff = unifiedDiff(filename+" (arbol)", filename+" (vm)", result.Tree, result.VM)
+		}
+		results = append(results, result)
+
+		if opts.format == formatText {
+			if result.Equal {
+				fmt.Fprintf(env.Stdout, "igual      %s\n", filename)
+			} else {
+				fmt.Fprintf(env.Stdout, "DIFERENTE  %s\n%s", filename, result.Diff)
+			}
+		}
+	}
+
+	if opts.format == formatJSON {
+		if results == nil {
+			results = []comparison{}
+		}
+		writeJSON(env.Stdout, results)
+	} else {
+		fmt.Fprintf(env.Stdout, "\n%s, %s con salida diferente\n",
+			plural(len(results), "programa comparado", "programas comparados"), plural(different, "programa", "programas"))
+	}
+	return status(!failed && different == 0)
+}
+
+// engineOutput ejecuta el programa con un motor y devuelve todo lo que
+// escribe, terminando con el error si lo hubo
+func engineOutput(u *unit, engine string, input []byte, seed int64) string {
+	var out bytes.Buffer
+	err := execute(u.program, execution{engine: engine, input: bytes.NewReader(input), seed: &seed}, &out)
+	if runtimeErr, ok := err.(*evaluator.RuntimeError); ok {
+		fmt.Fprintf(&out, "Error en ejecución %s", runtimeErr.Traceback())
+	} else if err != nil {
+		fmt.Fprintln(&out, err)
+	}
+	return out.String()
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// sampleInput es la entrada que reciben los ejemplos, para que los que usan
+// 'leer' y compañía lean algo además de llegar al final de la entrada
+const sampleInput = "Ana\n41\nuno\ndos\n"
+
+// TestEnginesAgree ejecuta cada ejemplo .flux del repositorio con el
+// evaluador y con la máquina virtual y comprueba que los dos escriben lo
+// mismo, incluidos los errores de ejecución
+func TestEnginesAgree(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "*.flux"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no se encontró ningún ejemplo .flux")
+	}
+
+	env := &Env{Stdout: io.Discard, Stderr: io.Discard}
+	for _, filename := range files {
+		filename := filename
+		t.Run(filepath.Base(filename), func(t *testing.T) {
+			u, ok := loadFile(env, filename)
+			if !ok {
+				t.Fatalf("no se pudo leer %s", filename)
+			}
+			if !u.analyze(false) {
+				t.Fatalf("%s tiene errores:\n%v", filename, u.diagnostics)
+			}
+			tree := engineOutput(u, engineTree, []byte(sampleInput), compareSeed)
+			vm := engineOutput(u, engineVM, []byte(sampleInput), compareSeed)
+			if tree != vm {
+				t.Errorf("los motores no coinciden:\n%s", unifiedDiff(filename+" (arbol)", filename+" (vm)", tree, vm))
+			}
+		})
+	}
+}
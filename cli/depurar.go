@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"flux/debugger"
+	"flux/evaluator"
+	"flux/symbol"
+	"fmt"
+	"strings"
+)
+
+// depurarCommand ejecuta el programa bajo el depurador interactivo. Las
+// órdenes se leen de la entrada estándar y los datos del programa, del
+// archivo de --entrada.
+func depurarCommand(env *Env, opts *options) int {
+	u, ok := load(env, opts)
+	if !ok {
+		return exitUsage
+	}
+	if !u.analyze(opts.dynamicScope) {
+		u.reportDiagnostics(env.Stdout)
+		return exitFailure
+	}
+
+	// La entrada estándar trae las órdenes del depurador: el programa solo
+	// recibe datos si se indica --entrada
+	input, ok := programInput(env, opts, strings.NewReader(""))
+	if !ok {
+		return exitUsage
+	}
+
+	evalOptions := []evaluator.Option{evaluator.WithInput(input), evaluator.WithOutput(env.Stdout)}
+	if opts.dynamicScope {
+		evalOptions = append(evalOptions, evaluator.WithDynamicScope())
+	}
+	d := debugger.New(u.filename, u.source, u.program, env.Stdin, env.Stdout)
+	err := d.Run(u.program, symbol.NewTable(), evalOptions...)
+
+	switch runtimeErr, isRuntime := err.(*evaluator.RuntimeError); {
+	case err == nil:
+		return exitOK
+	case err == debugger.ErrStopped:
+		fmt.Fprintln(env.Stdout, "Depuración terminada.")
+		return exitOK
+	case isRuntime:
+		fmt.Fprintf(env.Stdout, "Error en ejecución %s", runtimeErr.Traceback())
+	default:
+		fmt.Fprintf(env.Stdout, "Error en ejecución: %v\n", err)
+	}
+	return exitFailure
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"flux/ast"
+	"flux/compiler"
+	"flux/evaluator"
+	"flux/symbol"
+	"flux/vm"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Motores de ejecución (--motor)
+const (
+	engineTree = "arbol" // El evaluador, que recorre el árbol sintáctico
+	engineVM   = "vm"    // El compilador a bytecode y la máquina virtual
+)
+
+// compileError es un programa que el motor vm no pudo compilar
+type compileError struct {
+	err error
+}
+
+func (c *compileError) Error() string {
+	return "Error de compilación: " + c.err.Error()
+}
+
+// execution son las opciones con las que se ejecuta un programa. Los
+// límites a cero no se aplican (la profundidad tiene siempre un máximo).
+type execution struct {
+	engine       string
+	input        io.Reader // De donde leen 'leer' y compañía
+	dynamicScope bool
+	timeout      time.Duration
+	maxSteps     int // Solo en el motor de árbol
+	maxDepth     int
+	seed         *int64 // Semilla de 'aleatorio'; nil para una distinta cada vez
+}
+
+// execute ejecuta un programa ya analizado. La salida de 'mostrar' va a
+// out. Devuelve el error de ejecución, si lo hubo, o un *compileError si el
+// programa no se pudo compilar.
+func execute(program *ast.Program, ex execution, out io.Writer) error {
+	ctx := context.Background()
+	if ex.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ex.timeout)
+		defer cancel()
+	}
+
+	if ex.engine == engineVM {
+		compiled, err := compiler.Compile(program)
+		if err != nil {
+			return &compileError{err}
+		}
+		vmOptions := []vm.Option{vm.WithOutput(out), vm.WithInput(ex.input), vm.WithContext(ctx), vm.WithMaxDepth(ex.maxDepth)}
+		if ex.seed != nil {
+			vmOptions = append(vmOptions, vm.WithSeed(*ex.seed))
+		}
+		return vm.New(compiled, vmOptions...).Run()
+	}
+
+	evalOptions := []evaluator.Option{
+		evaluator.WithOutput(out),
+		evaluator.WithInput(ex.input),
+		evaluator.WithContext(ctx),
+		evaluator.WithMaxSteps(ex.maxSteps),
+		evaluator.WithMaxDepth(ex.maxDepth),
+	}
+	if ex.dynamicScope {
+		evalOptions = append(evalOptions, evaluator.WithDynamicScope())
+	}
+	if ex.seed != nil {
+		evalOptions = append(evalOptions, evaluator.WithSeed(*ex.seed))
+	}
+	err := evaluator.New(symbol.NewTable(), evalOptions...).Evaluate(program)
+	// Un ReturnValue suelto solo es relevante dentro de funciones
+	if evaluator.IsReturnValue(err) {
+		return nil
+	}
+	return err
+}
+
+// programInput devuelve la entrada del programa: el contenido del archivo
+// de --entrada o, si no se indicó, fallback. Si el archivo no se puede leer,
+// informa del error y devuelve false.
+func programInput(env *Env, opts *options, fallback io.Reader) (io.Reader, bool) {
+	if opts.input == "" {
+		return fallback, true
+	}
+	data, err := os.ReadFile(opts.input)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "Error leyendo la entrada: %v\n", err)
+		return nil, false
+	}
+	return bytes.NewReader(data), true
+}
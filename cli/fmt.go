@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"flux/diagnostic"
+	"flux/formatter"
+	"fmt"
+	"os"
+)
+
+// fmtResult es el resultado de formatear un archivo en --formato=json
+type fmtResult struct {
+	File        string          `json:"file"`
+	Changed     bool            `json:"changed"`
+	Formatted   string          `json:"formatted,omitempty"`
+	Diff        string          `json:"diff,omitempty"`
+	Diagnostics diagnostic.List `json:"diagnostics"`
+}
+
+// fmtCommand formatea los archivos. Sin opciones escribe el resultado en la
+// salida estándar; con --escribir reescribe los archivos que cambian y
+// muestra sus nombres; con --diff muestra solo las diferencias y termina con
+// código 1 si algún archivo no está formateado, para usarlo en revisiones
+// automáticas.
+func fmtCommand(env *Env, opts *options) int {
+	failed, unformatted := false, false
+	var results []fmtResult
+
+	for _, filename := range opts.files {
+		u, ok := loadFile(env, filename)
+		if !ok {
+			failed = true
+			continue
+		}
+		result := fmtResult{File: filename, Diagnostics: diagnostic.List{}}
+
+		formatted, err := formatter.Format(u.source)
+		if err != nil {
+			failed = true
+			if list, ok := err.(diagnostic.List); ok {
+				u.diagnostics = list
+				result.Diagnostics = list
+			}
+			if opts.format == formatJSON {
+				results = append(results, result)
+			} else {
+				u.reportDiagnostics(env.Stderr)
+			}
+			continue
+		}
+
+		result.Changed = formatted != u.source
+		if result.Changed {
+			unformatted = true
+		}
+		switch {
+		case opts.write:
+			if result.Changed {
+				if err := writeFile(filename, formatted); err != nil {
+					fmt.Fprintf(env.Stderr, "Error escribiendo archivo: %v\n", err)
+					failed = true
+					continue
+				}
+				if opts.format == formatText {
+					fmt.Fprintln(env.Stdout, filename)
+				}
+			}
+		case opts.diff:
+			if result.Changed {
+				result.Diff = unifiedDiff(filename, filename+" (formateado)", u.source, formatted)
+				if opts.format == formatText {
+					fmt.Fprint(env.Stdout, result.Diff)
+				}
+			}
+		default:
+			result.Formatted = formatted
+			if opts.format == formatText {
+				fmt.Fprint(env.Stdout, formatted)
+			}
+		}
+		results = append(results, result)
+	}
+
+	if opts.format == formatJSON {
+		if results == nil {
+			results = []fmtResult{}
+		}
+		writeJSON(env.Stdout, results)
+	}
+	if failed || (opts.diff && !opts.write && unformatted) {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// writeFile reescribe un archivo conservando sus permisos
+func writeFile(filename, content string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(content), info.Mode().Perm())
+}
@@ -0,0 +1,14 @@
+package cli
+
+import (
+	"flux/evaluator"
+	"flux/lsp"
+)
+
+// lspCommand atiende a un editor por la entrada y la salida estándar hasta
+// que este cierre la sesión
+func lspCommand(env *Env, opts *options) int {
+	server := lsp.NewServer(env.Stdin, env.Stdout, env.Stderr, evaluator.BuiltinNames(), evaluator.ConstantNames())
+	server.SetDynamicScope(opts.dynamicScope)
+	return server.Run()
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"flux/evaluator"
+	"fmt"
+)
+
+// runCommand analiza y ejecuta el programa. La salida del programa va a la
+// salida estándar; con --formato=json los errores se escriben como JSON en
+// la salida de error para no mezclarse con ella.
+func runCommand(env *Env, opts *options) int {
+	u, ok := load(env, opts)
+	if !ok {
+		return exitUsage
+	}
+	if !u.analyze(opts.dynamicScope) {
+		if opts.format == formatJSON {
+			writeJSON(env.Stderr, map[string]interface{}{
+				"file":        u.filename,
+				"diagnostics": u.jsonDiagnostics(),
+			})
+		} else {
+			u.reportDiagnostics(env.Stdout)
+		}
+		return exitFailure
+	}
+
+	input, ok := programInput(env, opts, env.Stdin)
+	if !ok {
+		return exitUsage
+	}
+
+	if opts.format == formatText {
+		fmt.Fprintln(env.Stdout, "=== EJECUCION ===")
+	}
+	err := execute(u.program, execution{
+		engine:       opts.engine,
+		input:        input,
+		dynamicScope: opts.dynamicScope,
+		timeout:      opts.timeout,
+		maxSteps:     opts.maxSteps,
+		maxDepth:     opts.maxDepth,
+		seed:         opts.seed,
+	}, env.Stdout)
+	if err == nil {
+		return exitOK
+	}
+
+	runtimeErr, isRuntime := err.(*evaluator.RuntimeError)
+	_, isCompile := err.(*compileError)
+	switch {
+	case opts.format == formatJSON && isRuntime:
+		writeJSON(env.Stderr, map[string]interface{}{"file": u.filename, "error": runtimeErr})
+	case opts.format == formatJSON:
+		writeJSON(env.Stderr, map[string]interface{}{"file": u.filename, "error": map[string]string{"message": err.Error()}})
+	case isCompile:
+		fmt.Fprintln(env.Stdout, err)
+	case isRuntime:
+		fmt.Fprintf(env.Stdout, "Error en ejecución %s", runtimeErr.Traceback())
+	default:
+		fmt.Fprintf(env.Stdout, "Error en ejecución: %v\n", err)
+	}
+	return exitFailure
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"flux/lexer"
+	"fmt"
+)
+
+// tokensCommand muestra la lista de tokens del programa, sin el EOF final
+func tokensCommand(env *Env, opts *options) int {
+	u, ok := load(env, opts)
+	if !ok {
+		return exitUsage
+	}
+	u.lex()
+	tokens := u.tokens
+	if n := len(tokens); n > 0 && tokens[n-1].Type == lexer.TOKEN_EOF {
+		tokens = tokens[:n-1]
+	}
+
+	if opts.format == formatJSON {
+		writeJSON(env.Stdout, map[string]interface{}{
+			"file":        u.filename,
+			"tokens":      tokens,
+			"diagnostics": u.jsonDiagnostics(),
+		})
+	} else {
+		for _, tok := range tokens {
+			fmt.Fprintln(env.Stdout, tok)
+		}
+		if len(u.diagnostics) > 0 {
+			fmt.Fprintln(env.Stdout)
+			u.reportDiagnostics(env.Stdout)
+		}
+	}
+	return status(!u.diagnostics.HasErrors())
+}
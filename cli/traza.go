@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"flux/evaluator"
+	"flux/symbol"
+	"flux/trace"
+)
+
+// trazaCommand ejecuta el programa registrando cada paso y escribe la traza
+// como JSON o como una página HTML que la recorre junto al código. La salida
+// del programa queda dentro de la traza. Termina con código 1 si el programa
+// falló.
+func trazaCommand(env *Env, opts *options) int {
+	u, ok := load(env, opts)
+	if !ok {
+		return exitUsage
+	}
+	if !u.analyze(opts.dynamicScope) {
+		writeJSON(env.Stderr, map[string]interface{}{
+			"file":        u.filename,
+			"diagnostics": u.jsonDiagnostics(),
+		})
+		return exitFailure
+	}
+
+	input, ok := programInput(env, opts, env.Stdin)
+	if !ok {
+		return exitUsage
+	}
+
+	evalOptions := []evaluator.Option{evaluator.WithInput(input)}
+	if opts.dynamicScope {
+		evalOptions = append(evalOptions, evaluator.WithDynamicScope())
+	}
+	t := trace.New(u.filename, u.source, opts.maxSteps).Run(u.program, symbol.NewTable(), evalOptions...)
+
+	if opts.format == formatHTML {
+		if err := trace.WriteHTML(env.Stdout, t); err != nil {
+			writeJSON(env.Stderr, map[string]interface{}{"file": u.filename, "error": map[string]string{"message": err.Error()}})
+			return exitFailure
+		}
+	} else {
+		writeJSON(env.Stdout, t)
+	}
+	return status(t.Error == nil)
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"flux/vet"
+	"fmt"
+	"strings"
+)
+
+// vetCommand hace el análisis completo y además aplica las reglas del
+// linter. Termina con código 1 si encuentra cualquier problema, también si
+// solo son advertencias.
+func vetCommand(env *Env, opts *options) int {
+	rules, err := selectRules(opts.rules, opts.skipRules)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "flux vet: %v\n", err)
+		return exitUsage
+	}
+	u, ok := load(env, opts)
+	if !ok {
+		return exitUsage
+	}
+	if u.analyze(opts.dynamicScope) {
+		u.diagnostics = append(u.diagnostics, vet.Check(u.program, u.source, u.comments, rules)...)
+		u.diagnostics.Sort()
+	}
+
+	if opts.format == formatJSON {
+		writeJSON(env.Stdout, map[string]interface{}{
+			"file":        u.filename,
+			"diagnostics": u.jsonDiagnostics(),
+		})
+	} else {
+		u.reportDiagnostics(env.Stdout)
+	}
+	return status(len(u.diagnostics) == 0)
+}
+
+// selectRules devuelve los nombres de las reglas que se aplican según
+// --reglas y --sin
+func selectRules(only, skip string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, rule := range vet.Rules {
+		selected[rule.Name] = only == ""
+	}
+	for _, name := range splitList(only) {
+		if _, ok := vet.LookupRule(name); !ok {
+			return nil, fmt.Errorf("regla desconocida '%s' (usa --listar para ver las reglas)", name)
+		}
+		selected[name] = true
+	}
+	for _, name := range splitList(skip) {
+		if _, ok := vet.LookupRule(name); !ok {
+			return nil, fmt.Errorf("regla desconocida '%s' (usa --listar para ver las reglas)", name)
+		}
+		selected[name] = false
+	}
+
+	var rules []string
+	for _, rule := range vet.Rules {
+		if selected[rule.Name] {
+			rules = append(rules, rule.Name)
+		}
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no queda ninguna regla por aplicar")
+	}
+	return rules, nil
+}
+
+func splitList(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func listRules(env *Env) int {
+	for _, rule := range vet.Rules {
+		fmt.Fprintf(env.Stdout, "%-22s %s  %s\n", rule.Name, rule.Code, rule.Description)
+	}
+	fmt.Fprintln(env.Stdout, "\nPara ignorar una regla en una línea: // flux:ignorar nombre-de-la-regla")
+	return exitOK
+}
@@ -0,0 +1,713 @@
+// Package compiler traduce un ast.Program a bytecode para la máquina virtual
+// de flux/vm. El resultado se comporta exactamente igual que el evaluador:
+// los nombres se resuelven antes de ejecutar a casillas de cada scope (solo
+// las funciones crean scopes, como en el evaluador) y las operaciones tienen
+// su propio código, así que no hay que recorrer el árbol, comparar el texto
+// de los operadores ni buscar los nombres en un mapa en cada paso.
+package compiler
+
+import (
+	"encoding/binary"
+	"flux/ast"
+	"fmt"
+)
+
+// Program es un programa compilado
+type Program struct {
+	Main      *Function   // Sentencias del programa, fuera de cualquier función
+	Functions []*Function // Funciones del programa, por índice de OpClosure
+	Constants []interface{}
+}
+
+// Function es el código de una función (o del programa principal). Sus
+// variables viven en casillas de un scope que se crea en cada llamada.
+type Function struct {
+	Name       string   // Vacío en las funciones anónimas y el programa principal
+	Parameters int      // Los parámetros ocupan las primeras casillas
+	Slots      []string // Nombre de cada casilla; "" en las auxiliares
+	Code       []byte
+	References []Reference
+	Handlers   []Handler
+	Nodes      map[int]ast.Node // Nodo de cada instrucción que puede fallar, para ubicar el error
+}
+
+// Reference es un nombre usado en la función. Como el evaluador busca los
+// nombres al ejecutar, una variable declarada más adelante o en otra rama
+// puede no existir todavía; por eso se guardan todas las casillas que
+// pueden contenerlo, de la más interna a la más externa, y se usa la
+// primera que tenga valor.
+type Reference struct {
+	Name   string
+	Called bool // Se usa como función: el error dice "la función ... no está definida"
+	Slots  []SlotRef
+	Local  int // Casilla del scope actual donde 'x = ...' crea la variable, o -1
+}
+
+// SlotRef es una casilla de un scope que rodea a la función
+type SlotRef struct {
+	Depth int  // 0 es el scope de la propia función, 1 el que la rodea...
+	Index int  // Casilla dentro del scope
+	Param bool // Los parámetros siempre tienen valor, aunque sea nulo
+}
+
+// Handler protege las instrucciones de [Start, End): si una falla, la
+// ejecución sigue en Target con el error en la pila. Los manejadores
+// internos van antes que los externos.
+type Handler struct {
+	Start  int
+	End    int
+	Target int
+}
+
+// scope son las casillas de la función que se compila
+type scope struct {
+	slots  map[string]int
+	params int
+	parent *scope
+}
+
+// loop es un bucle abierto, para resolver 'salir' y 'continuar'
+type loop struct {
+	label     string
+	tries     int   // Bloques 'intentar' abiertos al empezar el bucle
+	breaks    []int // Saltos a completar con el final del bucle
+	continues []int // Saltos a completar con la siguiente iteración
+}
+
+// tryBlock es un 'intentar' abierto. Al salir de él con 'salir',
+// 'continuar' o 'retornar' se ejecuta una copia de su bloque 'finalmente'.
+type tryBlock struct {
+	finally *ast.BlockStatement
+	loops   int   // Bucles abiertos al empezar el 'intentar'
+	zone    *zone // Instrucciones protegidas que se están compilando
+}
+
+// zone son las instrucciones protegidas por un mismo manejador. Se corta
+// en varios intervalos cuando dentro hay copias de un 'finalmente', que no
+// deben quedar protegidas por su propio 'intentar'.
+type zone struct {
+	start   int
+	open    bool
+	entries []int // Índices en Handlers, para completar su destino
+}
+
+type refKey struct {
+	name   string
+	called bool
+}
+
+type compiler struct {
+	program   *Program
+	constants map[interface{}]int
+	err       error
+
+	// Estado de la función que se compila
+	fn           *Function
+	scope        *scope
+	refs         map[refKey]int
+	loops        []*loop
+	tries        []*tryBlock
+	statementEnd *[]int // Fuera de las funciones, saltos de 'retornar' al final de la sentencia
+}
+
+// Compile compila un programa ya analizado
+func Compile(program *ast.Program) (*Program, error) {
+	c := &compiler{
+		program:   &Program{},
+		constants: make(map[interface{}]int),
+	}
+	c.program.Main = c.compileFunction("", nil, program.Statements, true)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.program, nil
+}
+
+func (c *compiler) fail(format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = fmt.Errorf(format, args...)
+	}
+}
+
+// compileFunction compila un cuerpo con su propio scope y devuelve la función
+func (c *compiler) compileFunction(name string, params []*ast.Identifier, body []ast.Statement, main bool) *Function {
+	outer := *c
+	fn := &Function{Name: name, Parameters: len(params), Nodes: make(map[int]ast.Node)}
+	c.fn = fn
+	c.scope = &scope{slots: make(map[string]int), params: len(params)}
+	if !main {
+		c.scope.parent = outer.scope
+	}
+	c.refs = make(map[refKey]int)
+	c.loops, c.tries, c.statementEnd = nil, nil, nil
+
+	// Cada parámetro tiene su casilla aunque se repita el nombre; gana el último
+	for i, param := range params {
+		fn.Slots = append(fn.Slots, param.Value)
+		c.scope.slots[param.Value] = i
+	}
+	c.declareStatements(body)
+
+	for _, stmt := range body {
+		if !main {
+			c.compileStatement(stmt)
+			continue
+		}
+		// 'retornar' fuera de una función termina solo la sentencia actual
+		var ends []int
+		c.statementEnd = &ends
+		c.compileStatement(stmt)
+		for _, pos := range ends {
+			c.patchOperand(pos, 0, c.pos())
+		}
+	}
+	c.emit(OpReturnNull)
+
+	program, constants, err := c.program, c.constants, c.err
+	*c = outer
+	c.program, c.constants, c.err = program, constants, err
+	return fn
+}
+
+// declareStatements crea las casillas de los nombres que el cuerpo puede
+// definir en su scope. Los bloques no crean scopes, así que se recorren.
+func (c *compiler) declareStatements(statements []ast.Statement) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *ast.DeclareStatement:
+			c.declare(s.Name.Value)
+		case *ast.AssignStatement:
+			// Asignar a un nombre que no existe en ningún scope lo crea aquí
+			c.declare(s.Name.Value)
+		case *ast.FunctionStatement:
+			c.declare(s.Name.Value)
+		case *ast.RepeatStatement:
+			c.declare(s.Variable.Value)
+			c.declareBlock(s.Body)
+		case *ast.IfStatement:
+			c.declareBlock(s.Then)
+			c.declareBlock(s.Else)
+		case *ast.WhileStatement:
+			c.declareBlock(s.Body)
+		case *ast.TryStatement:
+			c.declareBlock(s.Body)
+			if s.CatchName != nil {
+				c.declare(s.CatchName.Value)
+			}
+			c.declareBlock(s.Catch)
+			c.declareBlock(s.Finally)
+		case *ast.BlockStatement:
+			c.declareStatements(s.Statements)
+		}
+	}
+}
+
+func (c *compiler) declareBlock(block *ast.BlockStatement) {
+	if block != nil {
+		c.declareStatements(block.Statements)
+	}
+}
+
+func (c *compiler) declare(name string) int {
+	if slot, ok := c.scope.slots[name]; ok {
+		return slot
+	}
+	slot := len(c.fn.Slots)
+	c.fn.Slots = append(c.fn.Slots, name)
+	c.scope.slots[name] = slot
+	return slot
+}
+
+// temp reserva n casillas auxiliares consecutivas y devuelve la primera
+func (c *compiler) temp(n int) int {
+	slot := len(c.fn.Slots)
+	for i := 0; i < n; i++ {
+		c.fn.Slots = append(c.fn.Slots, "")
+	}
+	return slot
+}
+
+// resolve devuelve la referencia a un nombre desde el scope actual
+func (c *compiler) resolve(name string, called bool) int {
+	key := refKey{name, called}
+	if index, ok := c.refs[key]; ok {
+		return index
+	}
+	ref := Reference{Name: name, Called: called, Local: -1}
+	depth := 0
+	for sc := c.scope; sc != nil; sc = sc.parent {
+		if slot, ok := sc.slots[name]; ok {
+			param := slot < sc.params
+			ref.Slots = append(ref.Slots, SlotRef{Depth: depth, Index: slot, Param: param})
+			if param {
+				// Un parámetro siempre tiene valor: los scopes exteriores no se alcanzan
+				break
+			}
+		}
+		depth++
+	}
+	if slot, ok := c.scope.slots[name]; ok {
+		ref.Local = slot
+	}
+	index := len(c.fn.References)
+	c.fn.References = append(c.fn.References, ref)
+	c.refs[key] = index
+	return index
+}
+
+func (c *compiler) constant(value interface{}) int {
+	if index, ok := c.constants[value]; ok {
+		return index
+	}
+	index := len(c.program.Constants)
+	c.program.Constants = append(c.program.Constants, value)
+	c.constants[value] = index
+	return index
+}
+
+// Emisión de código
+
+func (c *compiler) pos() int {
+	return len(c.fn.Code)
+}
+
+func (c *compiler) emit(op Opcode, operands ...int) int {
+	pos := c.pos()
+	c.fn.Code = append(c.fn.Code, byte(op))
+	for _, operand := range operands {
+		c.fn.Code = binary.BigEndian.AppendUint16(c.fn.Code, c.operand(operand))
+	}
+	return pos
+}
+
+// emitAt emite una instrucción que puede fallar y recuerda su nodo
+func (c *compiler) emitAt(node ast.Node, op Opcode, operands ...int) int {
+	pos := c.emit(op, operands...)
+	c.fn.Nodes[pos] = node
+	return pos
+}
+
+func (c *compiler) operand(value int) uint16 {
+	if value < 0 || value > maxOperand {
+		c.fail("el programa es demasiado grande para el motor vm (un operando vale %d)", value)
+		return 0
+	}
+	return uint16(value)
+}
+
+// patchOperand cambia el operando número n de la instrucción en pos
+func (c *compiler) patchOperand(pos, n, value int) {
+	binary.BigEndian.PutUint16(c.fn.Code[pos+1+2*n:], c.operand(value))
+}
+
+// Sentencias
+
+func (c *compiler) compileBlock(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		c.compileStatement(stmt)
+	}
+}
+
+func (c *compiler) compileStatement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.DeclareStatement:
+		c.compileExpression(s.Value)
+		op := OpDefine
+		if s.IsConst {
+			op = OpDefineConst
+		}
+		c.emitAt(s.Name, op, c.scope.slots[s.Name.Value])
+	case *ast.AssignStatement:
+		c.compileExpression(s.Value)
+		c.emitAt(s.Name, OpAssign, c.resolve(s.Name.Value, false))
+	case *ast.IndexAssignStatement:
+		c.compileExpression(s.Target.Left)
+		c.compileExpression(s.Target.Index)
+		c.compileExpression(s.Value)
+		c.emitAt(s.Target, OpSetIndex)
+	case *ast.IfStatement:
+		c.compileIf(s)
+	case *ast.WhileStatement:
+		c.compileWhile(s)
+	case *ast.RepeatStatement:
+		c.compileRepeat(s)
+	case *ast.ShowStatement:
+		c.compileExpression(s.Value)
+		c.emit(OpShow)
+	case *ast.ReturnStatement:
+		c.compileReturn(s)
+	case *ast.BreakStatement:
+		c.compileLoopExit(s.Label, true)
+	case *ast.ContinueStatement:
+		c.compileLoopExit(s.Label, false)
+	case *ast.TryStatement:
+		c.compileTry(s)
+	case *ast.ThrowStatement:
+		c.compileExpression(s.Value)
+		c.emitAt(s, OpThrow)
+	case *ast.FunctionStatement:
+		fn := c.compileFunction(s.Name.Value, s.Parameters, s.Body.Statements, false)
+		c.emit(OpClosure, c.addFunction(fn))
+		c.emit(OpDefine, c.scope.slots[s.Name.Value])
+	case *ast.BlockStatement:
+		c.compileBlock(s)
+	case *ast.ExpressionStatement:
+		c.compileExpression(s.Expression)
+		c.emit(OpPop)
+	default:
+		c.fail("tipo de nodo no soportado: %T", stmt)
+	}
+}
+
+func (c *compiler) addFunction(fn *Function) int {
+	c.program.Functions = append(c.program.Functions, fn)
+	return len(c.program.Functions) - 1
+}
+
+func (c *compiler) compileIf(s *ast.IfStatement) {
+	c.compileExpression(s.Condition)
+	skipThen := c.emit(OpJumpIfFalse, 0)
+	c.compileBlock(s.Then)
+	if s.Else == nil {
+		c.patchOperand(skipThen, 0, c.pos())
+		return
+	}
+	skipElse := c.emit(OpJump, 0)
+	c.patchOperand(skipThen, 0, c.pos())
+	c.compileBlock(s.Else)
+	c.patchOperand(skipElse, 0, c.pos())
+}
+
+func (c *compiler) compileWhile(s *ast.WhileStatement) {
+	top := c.pos()
+	c.compileExpression(s.Condition)
+	exit := c.emit(OpJumpIfFalse, 0)
+
+	l := c.pushLoop(s.Label)
+	c.compileBlock(s.Body)
+	c.popLoop()
+	// 'continuar' pasa también por el salto hacia atrás, que es donde la VM
+	// comprueba si se canceló la ejecución
+	back := c.emitAt(s, OpJump, top)
+
+	c.patchLoop(l, c.pos(), back)
+	c.patchOperand(exit, 0, c.pos())
+}
+
+// compileRepeat guarda el contador y el límite en casillas auxiliares: el
+// cuerpo puede cambiar la variable del bucle sin alterar las iteraciones,
+// igual que en el evaluador
+func (c *compiler) compileRepeat(s *ast.RepeatStatement) {
+	c.compileExpression(s.From)
+	c.compileExpression(s.To)
+	counter := c.temp(2)
+	c.emitAt(s.Variable, OpRepeatInit, counter)
+
+	top := c.pos()
+	next := c.emit(OpRepeatNext, counter, 0)
+	c.emit(OpDefine, c.scope.slots[s.Variable.Value])
+
+	l := c.pushLoop(s.Label)
+	c.compileBlock(s.Body)
+	c.popLoop()
+	step := c.pos()
+	c.emit(OpRepeatStep, counter)
+	c.emitAt(s, OpJump, top)
+
+	c.patchLoop(l, c.pos(), step)
+	c.patchOperand(next, 1, c.pos())
+}
+
+func (c *compiler) pushLoop(label *ast.Identifier) *loop {
+	l := &loop{tries: len(c.tries)}
+	if label != nil {
+		l.label = label.Value
+	}
+	c.loops = append(c.loops, l)
+	return l
+}
+
+func (c *compiler) popLoop() {
+	c.loops = c.loops[:len(c.loops)-1]
+}
+
+func (c *compiler) patchLoop(l *loop, exit, next int) {
+	for _, pos := range l.breaks {
+		c.patchOperand(pos, 0, exit)
+	}
+	for _, pos := range l.continues {
+		c.patchOperand(pos, 0, next)
+	}
+}
+
+// compileLoopExit compila 'salir' o 'continuar'. El parser ya comprobó que
+// están dentro de un bucle con esa etiqueta.
+func (c *compiler) compileLoopExit(label *ast.Identifier, isBreak bool) {
+	var target *loop
+	for i := len(c.loops) - 1; i >= 0 && target == nil; i-- {
+		if label == nil || c.loops[i].label == label.Value {
+			target = c.loops[i]
+		}
+	}
+	if target == nil {
+		c.fail("'salir' o 'continuar' fuera de un bucle")
+		return
+	}
+	c.exitTries(target.tries, func() {
+		jump := c.emit(OpJump, 0)
+		if isBreak {
+			target.breaks = append(target.breaks, jump)
+		} else {
+			target.continues = append(target.continues, jump)
+		}
+	})
+}
+
+func (c *compiler) compileReturn(s *ast.ReturnStatement) {
+	if s.Value != nil {
+		c.compileExpression(s.Value)
+	} else {
+		c.emit(OpNull)
+	}
+
+	if c.statementEnd != nil {
+		// Fuera de una función, el valor se descarta y el programa sigue
+		c.emit(OpPop)
+		ends := c.statementEnd
+		c.exitTries(0, func() {
+			*ends = append(*ends, c.emit(OpJump, 0))
+		})
+		return
+	}
+	if !c.hasFinally() {
+		c.emit(OpReturn)
+		return
+	}
+	// El valor espera en una casilla mientras se ejecutan los 'finalmente'
+	result := c.temp(1)
+	c.emit(OpSetTemp, result)
+	c.exitTries(0, func() {
+		c.emit(OpGetTemp, result)
+		c.emit(OpReturn)
+	})
+}
+
+func (c *compiler) hasFinally() bool {
+	for _, t := range c.tries {
+		if t.finally != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// exitTries sale de los 'intentar' abiertos a partir de depth, del más
+// interno al más externo, ejecutando sus bloques 'finalmente', y emite el
+// salto con jump. Cada 'finalmente' queda fuera de la protección de su
+// 'intentar' pero dentro de la de los exteriores, como en el evaluador.
+func (c *compiler) exitTries(depth int, jump func()) {
+	tries, loops := c.tries, c.loops
+	for i := len(tries) - 1; i >= depth; i-- {
+		t := tries[i]
+		c.suspend(t.zone)
+		if t.finally != nil {
+			c.tries, c.loops = tries[:i], loops[:t.loops]
+			c.compileBlock(t.finally)
+		}
+	}
+	c.tries, c.loops = tries, loops
+	jump()
+	for i := depth; i < len(tries); i++ {
+		c.resume(tries[i].zone)
+	}
+}
+
+// compileTry compila 'intentar'. Los errores del cuerpo van a 'capturar'
+// (o directamente a 'finalmente', que después relanza el error); los de
+// 'capturar', a 'finalmente'. Al terminar sin error se ejecuta una copia
+// de 'finalmente' y se salta al final.
+func (c *compiler) compileTry(s *ast.TryStatement) {
+	if s.Catch == nil && s.Finally == nil {
+		c.compileBlock(s.Body)
+		return
+	}
+	t := &tryBlock{finally: s.Finally, loops: len(c.loops)}
+	body := c.protect(t, s.Body)
+	c.compileBlock(s.Finally)
+	ends := []int{c.emit(OpJump, 0)}
+	c.patchZone(body, c.pos())
+
+	if s.Catch != nil {
+		c.emit(OpCatch)
+		if s.CatchName != nil {
+			c.emit(OpDefine, c.scope.slots[s.CatchName.Value])
+		} else {
+			c.emit(OpPop)
+		}
+		if s.Finally == nil {
+			c.compileBlock(s.Catch)
+		} else {
+			catch := c.protect(t, s.Catch)
+			c.compileBlock(s.Finally)
+			ends = append(ends, c.emit(OpJump, 0))
+			c.patchZone(catch, c.pos())
+		}
+	}
+	if s.Finally != nil {
+		// Con un error pendiente: 'finalmente' y después se relanza
+		pending := c.temp(1)
+		c.emit(OpSetTemp, pending)
+		c.compileBlock(s.Finally)
+		c.emit(OpGetTemp, pending)
+		c.emit(OpRaise)
+	}
+
+	for _, pos := range ends {
+		c.patchOperand(pos, 0, c.pos())
+	}
+}
+
+// protect compila un bloque protegido por el 'intentar' t
+func (c *compiler) protect(t *tryBlock, block *ast.BlockStatement) *zone {
+	z := &zone{}
+	c.resume(z)
+	t.zone = z
+	c.tries = append(c.tries, t)
+	c.compileBlock(block)
+	c.tries = c.tries[:len(c.tries)-1]
+	c.suspend(z)
+	t.zone = nil
+	return z
+}
+
+// suspend cierra el intervalo abierto de una zona
+func (c *compiler) suspend(z *zone) {
+	if z == nil || !z.open {
+		return
+	}
+	z.open = false
+	if c.pos() > z.start {
+		z.entries = append(z.entries, len(c.fn.Handlers))
+		c.fn.Handlers = append(c.fn.Handlers, Handler{Start: z.start, End: c.pos()})
+	}
+}
+
+// resume abre un nuevo intervalo de una zona
+func (c *compiler) resume(z *zone) {
+	if z == nil {
+		return
+	}
+	z.start = c.pos()
+	z.open = true
+}
+
+// patchZone completa el destino de los manejadores de una zona
+func (c *compiler) patchZone(z *zone, target int) {
+	for _, entry := range z.entries {
+		c.fn.Handlers[entry].Target = target
+	}
+}
+
+// Expresiones
+
+// operators son las instrucciones de cada operador binario, con sus dos
+// formas (Unicode y ASCII)
+var operators = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"%":  OpMod,
+	"↔":  OpEqual,
+	"==": OpEqual,
+	"≠":  OpNotEqual,
+	"!=": OpNotEqual,
+	"<":  OpLess,
+	">":  OpGreater,
+	"≤":  OpLessEqual,
+	"<=": OpLessEqual,
+	"≥":  OpGreaterEqual,
+	">=": OpGreaterEqual,
+	"∧":  OpAnd,
+	"&&": OpAnd,
+	"∨":  OpOr,
+	"||": OpOr,
+}
+
+func (c *compiler) compileExpression(expr ast.Expression) {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		c.emit(OpConstant, c.constant(e.Value))
+	case *ast.FloatLiteral:
+		c.emit(OpConstant, c.constant(e.Value))
+	case *ast.StringLiteral:
+		c.emit(OpConstant, c.constant(e.Value))
+	case *ast.BooleanLiteral:
+		if e.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+	case *ast.Identifier:
+		c.emitAt(e, OpGetVar, c.resolve(e.Value, false))
+	case *ast.InfixExpression:
+		op, ok := operators[e.Operator]
+		if !ok {
+			c.fail("operador desconocido '%s'", e.Operator)
+			return
+		}
+		// Ambos operandos se evalúan siempre, también en '∧' y '∨'
+		c.compileExpression(e.Left)
+		c.compileExpression(e.Right)
+		c.emitAt(e, op)
+	case *ast.PrefixExpression:
+		c.compileExpression(e.Right)
+		switch e.Operator {
+		case "¬", "!":
+			c.emitAt(e, OpNot)
+		case "-":
+			c.emitAt(e, OpNeg)
+		default:
+			c.fail("operador desconocido '%s'", e.Operator)
+		}
+	case *ast.ListLiteral:
+		for _, el := range e.Elements {
+			c.compileExpression(el)
+		}
+		c.emit(OpList, len(e.Elements))
+	case *ast.DictLiteral:
+		for _, pair := range e.Pairs {
+			c.compileExpression(pair.Key)
+			c.emitAt(pair.Key, OpCheckKey)
+			c.compileExpression(pair.Value)
+		}
+		c.emit(OpDict, len(e.Pairs))
+	case *ast.InterpolatedString:
+		for _, part := range e.Parts {
+			c.compileExpression(part)
+		}
+		c.emit(OpConcat, len(e.Parts))
+	case *ast.IndexExpression:
+		c.compileExpression(e.Left)
+		c.compileExpression(e.Index)
+		c.emitAt(e, OpIndex)
+	case *ast.FunctionLiteral:
+		fn := c.compileFunction("", e.Parameters, e.Body.Statements, false)
+		c.emit(OpClosure, c.addFunction(fn))
+	case *ast.CallExpression:
+		if ident, ok := e.Function.(*ast.Identifier); ok {
+			c.emitAt(ident, OpGetVar, c.resolve(ident.Value, true))
+		} else {
+			c.compileExpression(e.Function)
+		}
+		for _, arg := range e.Arguments {
+			c.compileExpression(arg)
+		}
+		c.emitAt(e, OpCall, len(e.Arguments))
+	default:
+		c.fail("tipo de expresión no soportado: %T", expr)
+	}
+}
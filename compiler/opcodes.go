@@ -0,0 +1,154 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Opcode es la operación de una instrucción. Cada instrucción ocupa un byte
+// seguido de sus operandos, de dos bytes cada uno.
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // Apila una constante
+	OpNull                   // Apila nulo
+	OpTrue
+	OpFalse
+	OpPop // Descarta el valor de la cima de la pila
+
+	OpGetVar      // Apila el valor de un nombre (operando: referencia)
+	OpAssign      // Asigna al nombre donde fue declarado (operando: referencia)
+	OpDefine      // Define una variable en el scope actual (operando: casilla)
+	OpDefineConst // Define una constante en el scope actual (operando: casilla)
+	OpGetTemp     // Apila una casilla auxiliar del scope actual
+	OpSetTemp     // Guarda la cima de la pila en una casilla auxiliar
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpGreater
+	OpLessEqual
+	OpGreaterEqual
+	OpAnd // Sin cortocircuito: ambos operandos ya están evaluados
+	OpOr
+	OpNot
+	OpNeg
+
+	OpList     // Crea una lista con los n valores de la cima (operando: n)
+	OpCheckKey // Comprueba que la cima sirva como clave de un diccionario
+	OpDict     // Crea un diccionario con los n pares de la cima (operando: n)
+	OpConcat   // Une los n valores de la cima en una cadena, como 'mostrar' (operando: n)
+	OpIndex    // contenedor, índice → elemento
+	OpSetIndex // contenedor, índice, valor → (nada)
+
+	OpJump        // Salta a la posición indicada
+	OpJumpIfFalse // Desapila la condición y salta si es falsa
+	OpRepeatInit  // Desapila 'desde' y 'hasta' y los guarda en dos casillas auxiliares
+	OpRepeatNext  // Apila el contador o salta al final si ya pasó de 'hasta' (operandos: casilla, salto)
+	OpRepeatStep  // Incrementa el contador (operando: casilla)
+
+	OpClosure    // Crea una función con el scope actual (operando: función)
+	OpCall       // Llama a la función bajo los n argumentos de la cima (operando: n)
+	OpReturn     // Retorna la cima de la pila
+	OpReturnNull // Retorna sin valor
+	OpShow       // Muestra la cima de la pila
+	OpThrow      // Lanza un error con la cima de la pila
+	OpCatch      // Convierte el error capturado en el diccionario que recibe 'capturar'
+	OpRaise      // Vuelve a lanzar un error capturado
+)
+
+type definition struct {
+	name     string
+	operands int // Número de operandos de dos bytes
+}
+
+// definitions está indexado por código para que leerla sea inmediato
+var definitions = [...]definition{
+	OpConstant:     {"CONSTANTE", 1},
+	OpNull:         {"NULO", 0},
+	OpTrue:         {"VERDADERO", 0},
+	OpFalse:        {"FALSO", 0},
+	OpPop:          {"DESCARTAR", 0},
+	OpGetVar:       {"LEER", 1},
+	OpAssign:       {"ASIGNAR", 1},
+	OpDefine:       {"DEFINIR", 1},
+	OpDefineConst:  {"DEFINIR_CONSTANTE", 1},
+	OpGetTemp:      {"LEER_AUX", 1},
+	OpSetTemp:      {"GUARDAR_AUX", 1},
+	OpAdd:          {"SUMAR", 0},
+	OpSub:          {"RESTAR", 0},
+	OpMul:          {"MULTIPLICAR", 0},
+	OpDiv:          {"DIVIDIR", 0},
+	OpMod:          {"MODULO", 0},
+	OpEqual:        {"IGUAL", 0},
+	OpNotEqual:     {"DISTINTO", 0},
+	OpLess:         {"MENOR", 0},
+	OpGreater:      {"MAYOR", 0},
+	OpLessEqual:    {"MENOR_IGUAL", 0},
+	OpGreaterEqual: {"MAYOR_IGUAL", 0},
+	OpAnd:          {"Y", 0},
+	OpOr:           {"O", 0},
+	OpNot:          {"NO", 0},
+	OpNeg:          {"NEGAR", 0},
+	OpList:         {"LISTA", 1},
+	OpCheckKey:     {"COMPROBAR_CLAVE", 0},
+	OpDict:         {"DICCIONARIO", 1},
+	OpConcat:       {"CONCATENAR", 1},
+	OpIndex:        {"INDICE", 0},
+	OpSetIndex:     {"ASIGNAR_INDICE", 0},
+	OpJump:         {"SALTAR", 1},
+	OpJumpIfFalse:  {"SALTAR_SI_FALSO", 1},
+	OpRepeatInit:   {"REPETIR_INICIO", 1},
+	OpRepeatNext:   {"REPETIR_SIGUIENTE", 2},
+	OpRepeatStep:   {"REPETIR_AVANCE", 1},
+	OpClosure:      {"FUNCION", 1},
+	OpCall:         {"LLAMAR", 1},
+	OpReturn:       {"RETORNAR", 0},
+	OpReturnNull:   {"RETORNAR_NULO", 0},
+	OpShow:         {"MOSTRAR", 0},
+	OpThrow:        {"LANZAR", 0},
+	OpCatch:        {"CAPTURAR", 0},
+	OpRaise:        {"RELANZAR", 0},
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(definitions) {
+		return definitions[op].name
+	}
+	return fmt.Sprintf("OP_%d", byte(op))
+}
+
+// Width devuelve cuántos bytes ocupa una instrucción con este código
+func (op Opcode) Width() int {
+	return 1 + 2*definitions[op].operands
+}
+
+// maxOperand es el mayor valor que cabe en un operando
+const maxOperand = 1<<16 - 1
+
+// ReadOperand lee el operando de dos bytes que empieza en code[i]
+func ReadOperand(code []byte, i int) int {
+	return int(binary.BigEndian.Uint16(code[i:]))
+}
+
+// Disassemble devuelve el código de una función en forma legible, una
+// instrucción por línea
+func Disassemble(fn *Function) string {
+	var sb strings.Builder
+	for ip := 0; ip < len(fn.Code); {
+		op := Opcode(fn.Code[ip])
+		fmt.Fprintf(&sb, "%04d %s", ip, op)
+		for i := 0; i < definitions[op].operands; i++ {
+			fmt.Fprintf(&sb, " %d", ReadOperand(fn.Code, ip+1+2*i))
+		}
+		sb.WriteByte('\n')
+		ip += op.Width()
+	}
+	return sb.String()
+}
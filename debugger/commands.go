@@ -0,0 +1,344 @@
+package debugger
+
+import (
+	"flux/ast"
+	"flux/evaluator"
+	"flux/lexer"
+	"flux/parser"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const promptText = "(depurar) "
+
+// contextLines es cuántas líneas se muestran antes y después de la actual
+const contextLines = 4
+
+const help = `Órdenes (entre paréntesis, la forma corta):
+  paso (p)            ejecuta la siguiente sentencia, entrando en las funciones
+  siguiente (s)       ejecuta la siguiente sentencia sin entrar en las funciones
+  fuera (f)           continúa hasta volver de la función actual
+  continuar (c)       continúa hasta el siguiente punto de parada
+  parar N (b)         pone un punto de parada en la línea N
+  quitar N            quita el punto de parada de la línea N
+  puntos              muestra los puntos de parada
+  variables (v)       muestra las variables de todos los scopes visibles
+  imprimir expr (i)   evalúa una expresión en el scope actual
+  vigilar expr (w)    evalúa una expresión en cada parada
+  olvidar N           deja de vigilar la expresión número N
+  pila (bt)           muestra la pila de llamadas
+  lista (l)           muestra el código alrededor de la línea actual
+  ayuda (h)           muestra esta ayuda
+  terminar (q)        detiene el programa
+Una línea vacía repite la última orden.
+`
+
+// prompt lee y ejecuta órdenes hasta que una reanuda la ejecución. Si la
+// entrada se acaba, el programa sigue hasta el final sin detenerse.
+func (d *Debugger) prompt() error {
+	for {
+		fmt.Fprint(d.out, promptText)
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			d.mode = modeFinish
+			return nil
+		}
+		input := strings.TrimSpace(d.in.Text())
+		if input == "" {
+			if input = d.last; input == "" {
+				continue
+			}
+		}
+		d.last = input
+
+		name, arg, _ := strings.Cut(input, " ")
+		resume, err := d.command(name, strings.TrimSpace(arg))
+		if err != nil {
+			return err
+		}
+		if resume {
+			return nil
+		}
+	}
+}
+
+// command ejecuta una orden. Devuelve true si la ejecución debe seguir.
+func (d *Debugger) command(name, arg string) (resume bool, err error) {
+	switch name {
+	case "paso", "p":
+		d.resume(modeStep)
+		return true, nil
+	case "siguiente", "s":
+		d.resume(modeNext)
+		return true, nil
+	case "fuera", "f":
+		d.resume(modeOut)
+		return true, nil
+	case "continuar", "c":
+		d.resume(modeContinue)
+		return true, nil
+	case "terminar", "q":
+		return false, ErrStopped
+	case "parar", "b":
+		d.setBreakpoint(arg)
+	case "quitar":
+		d.clearBreakpoint(arg)
+	case "puntos":
+		d.listBreakpoints()
+	case "variables", "v":
+		d.showVariables()
+	case "imprimir", "i":
+		d.printExpression(arg)
+	case "vigilar", "w":
+		d.addWatch(arg)
+	case "olvidar":
+		d.removeWatch(arg)
+	case "pila", "bt":
+		d.showStack()
+	case "lista", "l":
+		d.showSource()
+	case "ayuda", "h":
+		fmt.Fprint(d.out, help)
+	default:
+		fmt.Fprintf(d.out, "orden desconocida '%s' (escribe 'ayuda' para ver las órdenes)\n", name)
+	}
+	return false, nil
+}
+
+// Puntos de parada
+
+// lineArgument lee un número de línea válido del programa
+func (d *Debugger) lineArgument(arg, usage string) (int, bool) {
+	line, err := strconv.Atoi(arg)
+	if err != nil {
+		fmt.Fprintf(d.out, "uso: %s\n", usage)
+		return 0, false
+	}
+	if line < 1 || line > len(d.lines) {
+		fmt.Fprintf(d.out, "la línea %d no existe (el programa tiene %d líneas)\n", line, len(d.lines))
+		return 0, false
+	}
+	return line, true
+}
+
+// setBreakpoint pone un punto de parada. Si la línea no tiene código (está
+// vacía o es un comentario), se usa la siguiente que lo tenga.
+func (d *Debugger) setBreakpoint(arg string) {
+	line, ok := d.lineArgument(arg, "parar número-de-línea")
+	if !ok {
+		return
+	}
+	target := line
+	for target <= len(d.lines) && !d.codeLines[target] {
+		target++
+	}
+	if target > len(d.lines) {
+		fmt.Fprintf(d.out, "no hay código en la línea %d ni después\n", line)
+		return
+	}
+	d.breakpoints[target] = true
+	if target != line {
+		fmt.Fprintf(d.out, "la línea %d no tiene código; punto de parada en la línea %d\n", line, target)
+		return
+	}
+	fmt.Fprintf(d.out, "punto de parada en la línea %d\n", target)
+}
+
+func (d *Debugger) clearBreakpoint(arg string) {
+	line, ok := d.lineArgument(arg, "quitar número-de-línea")
+	if !ok {
+		return
+	}
+	if !d.breakpoints[line] {
+		fmt.Fprintf(d.out, "no hay ningún punto de parada en la línea %d\n", line)
+		return
+	}
+	delete(d.breakpoints, line)
+	fmt.Fprintf(d.out, "punto de parada de la línea %d quitado\n", line)
+}
+
+func (d *Debugger) listBreakpoints() {
+	if len(d.breakpoints) == 0 {
+		fmt.Fprintln(d.out, "no hay puntos de parada")
+		return
+	}
+	lines := make([]int, 0, len(d.breakpoints))
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	for _, line := range lines {
+		fmt.Fprintf(d.out, "  línea %d: %s\n", line, strings.TrimSpace(d.sourceLine(line)))
+	}
+}
+
+// Inspección
+
+// showVariables muestra las variables de cada scope, del actual al global.
+// Un nombre que ya apareció en un scope más interno está oculto por él.
+func (d *Debugger) showVariables() {
+	hidden := make(map[string]bool)
+	level := 0
+	for table := d.eval.Scope(); table != nil; table = table.Parent() {
+		title := "scope actual"
+		switch {
+		case table.Parent() == nil && level == 0:
+			title = "global (scope actual)"
+		case table.Parent() == nil:
+			title = "global"
+		case level > 0:
+			title = fmt.Sprintf("scope exterior %d", level)
+		}
+		fmt.Fprintf(d.out, "%s:\n", title)
+
+		names := table.Names()
+		if len(names) == 0 {
+			fmt.Fprintln(d.out, "  (sin variables)")
+		}
+		for _, name := range names {
+			value, _ := table.Get(name)
+			note := ""
+			if table.IsConst(name) {
+				note = " (constante)"
+			}
+			if hidden[name] {
+				note += " (oculta)"
+			}
+			fmt.Fprintf(d.out, "  %s = %s%s\n", name, evaluator.Inspect(value), note)
+			hidden[name] = true
+		}
+		level++
+	}
+}
+
+// evaluate evalúa una expresión escrita por el usuario en el scope actual
+func (d *Debugger) evaluate(source string) (interface{}, error) {
+	l := lexer.New(source)
+	tokens, _ := l.Tokenize()
+	p := parser.New(tokens)
+	program, _ := p.Parse()
+	if diagnostics := append(l.Diagnostics(), p.Errors()...); diagnostics.HasErrors() {
+		diagnostics.Sort()
+		return nil, fmt.Errorf("%s", diagnostics[0].Message)
+	}
+	if len(program.Statements) != 1 {
+		return nil, fmt.Errorf("se esperaba una sola expresión")
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil, fmt.Errorf("solo se pueden evaluar expresiones, no sentencias")
+	}
+
+	d.evaluating = true
+	defer func() { d.evaluating = false }()
+	value, err := d.eval.EvaluateExpression(stmt.Expression)
+	if runtimeErr, ok := err.(*evaluator.RuntimeError); ok {
+		// La posición se refiere a la expresión escrita, no al programa
+		return nil, fmt.Errorf("%s", runtimeErr.Message)
+	}
+	return value, err
+}
+
+func (d *Debugger) printExpression(arg string) {
+	if arg == "" {
+		fmt.Fprintln(d.out, "uso: imprimir expresión")
+		return
+	}
+	value, err := d.evaluate(arg)
+	if err != nil {
+		fmt.Fprintf(d.out, "error: %v\n", err)
+		return
+	}
+	fmt.Fprintln(d.out, evaluator.Inspect(value))
+}
+
+func (d *Debugger) addWatch(arg string) {
+	if arg == "" {
+		fmt.Fprintln(d.out, "uso: vigilar expresión")
+		return
+	}
+	d.watches = append(d.watches, arg)
+	d.showWatch(len(d.watches)-1, arg)
+}
+
+func (d *Debugger) removeWatch(arg string) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(d.watches) {
+		fmt.Fprintf(d.out, "uso: olvidar número (hay %d expresiones vigiladas)\n", len(d.watches))
+		return
+	}
+	fmt.Fprintf(d.out, "ya no se vigila '%s'\n", d.watches[n-1])
+	d.watches = append(d.watches[:n-1], d.watches[n:]...)
+}
+
+func (d *Debugger) showWatches() {
+	for i, watch := range d.watches {
+		d.showWatch(i, watch)
+	}
+}
+
+func (d *Debugger) showWatch(i int, watch string) {
+	value, err := d.evaluate(watch)
+	if err != nil {
+		fmt.Fprintf(d.out, "  [%d] %s: error: %v\n", i+1, watch, err)
+		return
+	}
+	fmt.Fprintf(d.out, "  [%d] %s = %s\n", i+1, watch, evaluator.Inspect(value))
+}
+
+// showStack muestra la pila de llamadas, de la más reciente a la más
+// antigua. Cada nivel indica la función y la línea por la que va.
+func (d *Debugger) showStack() {
+	frames := d.eval.Stack()
+	line := d.currentLine()
+	for i := len(frames) - 1; i >= 0; i-- {
+		fmt.Fprintf(d.out, "  #%d %s, línea %d\n", len(frames)-1-i, frames[i].Function, line)
+		line = frames[i].Line
+	}
+	fmt.Fprintf(d.out, "  #%d <programa>, línea %d\n", len(frames), line)
+}
+
+// Código fuente
+
+func (d *Debugger) sourceLine(line int) string {
+	if line < 1 || line > len(d.lines) {
+		return ""
+	}
+	return strings.TrimRight(d.lines[line-1], "\r")
+}
+
+// showLocation indica dónde se ha detenido la ejecución
+func (d *Debugger) showLocation() {
+	function := "<programa>"
+	if frames := d.eval.Stack(); len(frames) > 0 {
+		function = frames[len(frames)-1].Function
+	}
+	line := d.currentLine()
+	fmt.Fprintf(d.out, "→ %s:%d, en %s\n", d.filename, line, function)
+	fmt.Fprintf(d.out, "%5d | %s\n", line, d.sourceLine(line))
+}
+
+// showSource muestra las líneas alrededor de la actual, marcando la actual
+// con '→' y los puntos de parada con '●'
+func (d *Debugger) showSource() {
+	current := d.currentLine()
+	from, to := current-contextLines, current+contextLines
+	if from < 1 {
+		from = 1
+	}
+	if to > len(d.lines) {
+		to = len(d.lines)
+	}
+	for line := from; line <= to; line++ {
+		marker := "  "
+		if d.breakpoints[line] {
+			marker = "● "
+		}
+		if line == current {
+			marker = marker[:len(marker)-1] + "→"
+		}
+		fmt.Fprintf(d.out, "%s%4d | %s\n", marker, line, d.sourceLine(line))
+	}
+}
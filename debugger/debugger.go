@@ -0,0 +1,157 @@
+// Package debugger implementa el depurador interactivo de Flux (flux
+// depurar). Ejecuta el programa con un evaluator.Hook que se detiene antes
+// de las sentencias según los puntos de parada y el modo de avance, y en
+// cada parada lee órdenes: avanzar, inspeccionar variables, evaluar
+// expresiones vigiladas o ver la pila de llamadas.
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"flux/ast"
+	"flux/evaluator"
+	"flux/symbol"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrStopped es el error con el que termina la ejecución cuando el usuario
+// la detiene desde el depurador
+var ErrStopped = errors.New("ejecución detenida por el depurador")
+
+// mode indica hasta dónde avanzar antes de volver a detenerse
+type mode int
+
+const (
+	modeStep     mode = iota // Detenerse en la siguiente sentencia, aunque esté dentro de una llamada
+	modeNext                 // Detenerse en la siguiente sentencia de la misma función o de quien la llamó
+	modeOut                  // Detenerse al volver a quien llamó a la función actual
+	modeContinue             // Detenerse solo en los puntos de parada
+	modeFinish               // No volver a detenerse (la entrada se acabó)
+)
+
+// Debugger es una sesión de depuración de un programa
+type Debugger struct {
+	filename string
+	lines    []string // Líneas del código fuente, para mostrarlas
+	in       *bufio.Scanner
+	out      io.Writer
+
+	breakpoints map[int]bool
+	leading     map[ast.Statement]bool // Primera sentencia de cada línea
+	codeLines   map[int]bool           // Líneas en las que empieza alguna sentencia
+	watches     []string
+
+	mode       mode
+	depth      int // Profundidad de la pila al dar la última orden de avance
+	evaluating bool
+	last       string // Última orden, que se repite con una línea vacía
+
+	// Estado de la parada actual
+	eval *evaluator.Evaluator
+	stmt ast.Statement
+}
+
+// New prepara la depuración de un programa ya analizado. Las órdenes se
+// leen de in y los mensajes del depurador se escriben en out.
+func New(filename, source string, program *ast.Program, in io.Reader, out io.Writer) *Debugger {
+	d := &Debugger{
+		filename:    filename,
+		lines:       strings.Split(strings.TrimSuffix(source, "\n"), "\n"),
+		in:          bufio.NewScanner(in),
+		out:         out,
+		breakpoints: make(map[int]bool),
+		leading:     make(map[ast.Statement]bool),
+		codeLines:   make(map[int]bool),
+		mode:        modeStep,
+	}
+
+	// Un punto de parada en una línea se activa con la primera sentencia que
+	// empieza en ella, no con cada una de las que comparten la línea
+	seen := make(map[int]bool)
+	ast.Inspect(program, func(node ast.Node) bool {
+		stmt, ok := node.(ast.Statement)
+		if !ok {
+			return true
+		}
+		if _, isBlock := stmt.(*ast.BlockStatement); isBlock {
+			return true
+		}
+		line := stmt.Span().Start.Line
+		d.codeLines[line] = true
+		if !seen[line] {
+			seen[line] = true
+			d.leading[stmt] = true
+		}
+		return true
+	})
+	return d
+}
+
+// Run ejecuta el programa bajo el depurador, que se detiene antes de la
+// primera sentencia. Devuelve el error de ejecución, si lo hubo, o
+// ErrStopped si el usuario detuvo el programa.
+func (d *Debugger) Run(program *ast.Program, table *symbol.Table, opts ...evaluator.Option) error {
+	fmt.Fprintf(d.out, "Depurando %s. Escribe 'ayuda' para ver las órdenes.\n", d.filename)
+	eval := evaluator.New(table, append(opts, evaluator.WithHook(d))...)
+	err := eval.Evaluate(program)
+	if evaluator.IsReturnValue(err) {
+		err = nil
+	}
+	if err == nil {
+		fmt.Fprintln(d.out, "El programa terminó.")
+	}
+	return err
+}
+
+// BeforeStatement implementa evaluator.Hook: decide si hay que detenerse y,
+// si es así, atiende órdenes hasta que una reanude la ejecución
+func (d *Debugger) BeforeStatement(e *evaluator.Evaluator, stmt ast.Statement) error {
+	// Las expresiones vigiladas pueden llamar a funciones; no se depuran
+	if d.evaluating {
+		return nil
+	}
+	depth := len(e.Stack())
+	line := stmt.Span().Start.Line
+
+	stop := false
+	switch d.mode {
+	case modeStep:
+		stop = true
+	case modeNext:
+		stop = depth <= d.depth
+	case modeOut:
+		stop = depth < d.depth
+	}
+	if d.mode != modeFinish && d.breakpoints[line] && d.leading[stmt] {
+		stop = true
+	}
+	if !stop {
+		return nil
+	}
+
+	d.eval, d.stmt = e, stmt
+	defer func() { d.eval, d.stmt = nil, nil }()
+	d.showLocation()
+	d.showWatches()
+	return d.prompt()
+}
+
+// EnterFunction implementa evaluator.Hook. El depurador solo se detiene en
+// las sentencias, así que no hace nada.
+func (d *Debugger) EnterFunction(*evaluator.Evaluator, *evaluator.Function, []interface{}) {}
+
+// ExitFunction implementa evaluator.Hook
+func (d *Debugger) ExitFunction(*evaluator.Evaluator, *evaluator.Function, interface{}, error) {}
+
+// currentLine es la línea de la sentencia en la que está detenido
+func (d *Debugger) currentLine() int {
+	return d.stmt.Span().Start.Line
+}
+
+// resume reanuda la ejecución en el modo indicado
+func (d *Debugger) resume(m mode) {
+	d.mode = m
+	d.depth = len(d.eval.Stack())
+}
@@ -0,0 +1,34 @@
+package diagnostic
+
+// Códigos de los diagnósticos. El primer dígito indica la fase que los
+// produce: 0 léxico, 1 sintáctico, 2 semántico, 3 linter (flux vet). Los
+// del linter son advertencias y empiezan por W.
+const (
+	// Análisis léxico
+	CodeUnexpectedCharacter   = "E0001" // Carácter que no forma parte del lenguaje
+	CodeUnterminatedString    = "E0002" // Cadena sin comilla de cierre
+	CodeInvalidEscape         = "E0004" // Secuencia de escape desconocida o mal formada
+	CodeUnclosedInterpolation = "E0005" // '${' sin la llave de cierre
+
+	// Análisis sintáctico
+	CodeUnexpectedToken    = "E0100" // Token que no puede empezar ni continuar la sentencia
+	CodeExpectedToken      = "E0101" // Falta un token concreto ('=', 'desde', ')'...)
+	CodeUnclosedBlock      = "E0102" // Bloque, lista o diccionario sin cerrar
+	CodeExpectedExpression = "E0103" // Falta una expresión
+	CodeInvalidAssignment  = "E0104" // Lado izquierdo de '=' no asignable
+	CodeInvalidLabel       = "E0105" // Etiqueta repetida o en algo que no es un bucle
+	CodeLoopControl        = "E0106" // 'salir' o 'continuar' fuera de su bucle
+
+	// Análisis semántico
+	CodeUndefinedName = "E0200" // Nombre no declarado
+	CodeConstant      = "E0201" // Reasignación o redeclaración de una constante
+	CodeArgumentCount = "E0202" // Número incorrecto de argumentos
+
+	// Linter
+	CodeUnreachable       = "W0300" // Código después de retornar, lanzar, salir o continuar
+	CodeUnusedVariable    = "W0301" // Variable declarada con 'definir' que nunca se lee
+	CodeUnusedFunction    = "W0302" // Función que nunca se llama
+	CodeConstantCondition = "W0303" // Condición que no depende de ningún valor variable
+	CodeLoopShadow        = "W0304" // Variable de 'repetir' que pisa un nombre existente
+	CodeEmptyIf           = "W0305" // 'si' sin sentencias
+)
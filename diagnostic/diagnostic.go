@@ -0,0 +1,101 @@
+// Package diagnostic describe los problemas encontrados al analizar un
+// programa de Flux y los muestra junto al fragmento de código que los produjo.
+package diagnostic
+
+import (
+	"flux/ast"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity indica la gravedad de un diagnóstico
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "advertencia"
+	case Note:
+		return "nota"
+	default:
+		return "error"
+	}
+}
+
+// MarshalText hace que la gravedad aparezca por su nombre en JSON
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic es un problema en el código fuente
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"` // Código estable del problema (ver codes.go)
+	Message  string   `json:"message"`
+	Span     ast.Span `json:"span"`
+	Hint     string   `json:"hint,omitempty"` // Sugerencia opcional para corregirlo
+}
+
+// Errorf crea un diagnóstico de gravedad Error
+func Errorf(code string, span ast.Span, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{Severity: Error, Code: code, Message: fmt.Sprintf(format, args...), Span: span}
+}
+
+// Warningf crea un diagnóstico de gravedad Warning
+func Warningf(code string, span ast.Span, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{Severity: Warning, Code: code, Message: fmt.Sprintf(format, args...), Span: span}
+}
+
+// WithHint añade una sugerencia al diagnóstico y lo devuelve
+func (d *Diagnostic) WithHint(format string, args ...interface{}) *Diagnostic {
+	d.Hint = fmt.Sprintf(format, args...)
+	return d
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("línea %d, columna %d: %s", d.Span.Start.Line, d.Span.Start.Column, d.Message)
+}
+
+// List es un conjunto de diagnósticos. Implementa error para que las fases
+// del compilador puedan devolverla directamente.
+type List []*Diagnostic
+
+func (l List) Error() string {
+	messages := make([]string, len(l))
+	for i, d := range l {
+		messages[i] = d.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// HasErrors indica si algún diagnóstico tiene gravedad Error
+func (l List) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Err devuelve la lista como error si contiene algún error, o nil si no
+func (l List) Err() error {
+	if l.HasErrors() {
+		return l
+	}
+	return nil
+}
+
+// Sort ordena los diagnósticos por su posición en el código
+func (l List) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Span.Start.Offset < l[j].Span.Start.Offset
+	})
+}
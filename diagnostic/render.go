@@ -0,0 +1,105 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Render escribe el diagnóstico con la línea de código que lo produjo y el
+// fragmento subrayado:
+//
+//	error[E0101]: se esperaba 'desde'
+//	 --> programa.flux:3:11
+//	  |
+//	3 | repetir i 1 hasta 5 hacer
+//	  |           ^
+//	  = ayuda: la forma es 'repetir i desde 1 hasta 5 hacer'
+func Render(w io.Writer, filename, source string, d *Diagnostic) {
+	if d.Code != "" {
+		fmt.Fprintf(w, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+	} else {
+		fmt.Fprintf(w, "%s: %s\n", d.Severity, d.Message)
+	}
+
+	start := d.Span.Start
+	if start.Line == 0 {
+		// Sin posición no hay nada que mostrar del código
+		if d.Hint != "" {
+			fmt.Fprintf(w, "  = ayuda: %s\n", d.Hint)
+		}
+		return
+	}
+
+	gutter := strings.Repeat(" ", len(strconv.Itoa(start.Line)))
+	fmt.Fprintf(w, "%s--> %s:%d:%d\n", gutter, filename, start.Line, start.Column)
+
+	line, ok := sourceLine(source, start.Line)
+	if ok {
+		fmt.Fprintf(w, "%s |\n", gutter)
+		fmt.Fprintf(w, "%d | %s\n", start.Line, line)
+		fmt.Fprintf(w, "%s | %s\n", gutter, underline(line, start.Column, underlineWidth(d, line)))
+	}
+	if d.Hint != "" {
+		fmt.Fprintf(w, "%s = ayuda: %s\n", gutter, d.Hint)
+	}
+}
+
+// RenderAll escribe todos los diagnósticos separados por una línea en blanco
+func RenderAll(w io.Writer, filename, source string, list List) {
+	for i, d := range list {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		Render(w, filename, source, d)
+	}
+}
+
+// sourceLine devuelve la línea indicada (desde 1) sin el salto de línea
+func sourceLine(source string, number int) (string, bool) {
+	lines := strings.Split(source, "\n")
+	if number < 1 || number > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[number-1], "\r"), true
+}
+
+// underlineWidth calcula cuántos caracteres subrayar. Si el fragmento ocupa
+// varias líneas se subraya hasta el final de la primera.
+func underlineWidth(d *Diagnostic, line string) int {
+	start, end := d.Span.Start, d.Span.End
+	width := end.Column - start.Column
+	if end.Line != start.Line {
+		width = utf8.RuneCountInString(line) - start.Column + 1
+	}
+	if width < 1 {
+		width = 1
+	}
+	return width
+}
+
+// underline construye la línea de '^' alineada bajo la columna indicada.
+// Los tabuladores de la línea original se copian para que la alineación
+// coincida en cualquier terminal.
+func underline(line string, column, width int) string {
+	var sb strings.Builder
+	col := 1
+	for _, r := range line {
+		if col >= column {
+			break
+		}
+		if r == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+		col++
+	}
+	for ; col < column; col++ {
+		sb.WriteRune(' ')
+	}
+	sb.WriteString(strings.Repeat("^", width))
+	return sb.String()
+}
@@ -0,0 +1,83 @@
+package diagnostic
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Distance devuelve la distancia de edición entre a y b: el número de
+// inserciones, eliminaciones, sustituciones o intercambios de dos letras
+// contiguas necesarios para pasar de una a otra. Se cuenta por caracteres,
+// no por bytes.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// Tres filas de la tabla: la actual y las dos anteriores (para los intercambios)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
+// MaxDistance es la distancia máxima a la que una sugerencia sigue siendo
+// útil para un nombre de esa longitud. Los nombres muy cortos no reciben
+// sugerencias: casi cualquier otro nombre corto está a un paso.
+func MaxDistance(name string) int {
+	switch n := utf8.RuneCountInString(name); {
+	case n < 3:
+		return 0
+	case n <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// accents quita las tildes para que 'funcion' y 'función' se consideren iguales
+var accents = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u",
+	"Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ü", "U")
+
+// Normalize prepara un nombre para compararlo: minúsculas y sin tildes
+func Normalize(name string) string {
+	return accents.Replace(strings.ToLower(name))
+}
+
+// Closest devuelve el candidato más parecido a name si está como mucho a
+// maxDistance (comparando sin mayúsculas ni tildes). Los empates se resuelven
+// por orden alfabético. Nunca sugiere el propio name.
+func Closest(name string, candidates []string, maxDistance int) (string, bool) {
+	if maxDistance <= 0 {
+		return "", false
+	}
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+
+	target := Normalize(name)
+	best, bestDistance := "", maxDistance+1
+	for _, candidate := range sorted {
+		if candidate == name {
+			continue
+		}
+		if d := Distance(target, Normalize(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,156 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// Builtin es una función predefinida implementada en Go
+type Builtin struct {
+	Name string
+	Fn   func(args []interface{}) (interface{}, error)
+	// Stateful sustituye a Fn en las funciones que usan el estado del
+	// programa: su entrada y salida o sus números aleatorios
+	Stateful func(rt *Runtime, args []interface{}) (interface{}, error)
+}
+
+// Invoke llama a la función con el estado del programa que la llama
+func (b *Builtin) Invoke(rt *Runtime, args []interface{}) (interface{}, error) {
+	if b.Stateful != nil {
+		return b.Stateful(rt, args)
+	}
+	return b.Fn(args)
+}
+
+func (b *Builtin) String() string {
+	return fmt.Sprintf("<función predefinida %s>", b.Name)
+}
+
+// builtins contiene las funciones predefinidas. Se consultan cuando el
+// programa no define un nombre propio con el mismo identificador. Cada
+// módulo de la biblioteca estándar (entrada, matemáticas...) añade las
+// suyas con register al iniciarse el paquete.
+var builtins = map[string]*Builtin{
+	"longitud": {Name: "longitud", Fn: builtinLength},
+	"claves":   {Name: "claves", Fn: builtinKeys},
+	"valores":  {Name: "valores", Fn: builtinValues},
+}
+
+// constants contiene los valores predefinidos, como PI. Se consultan igual
+// que las funciones predefinidas.
+var constants = map[string]interface{}{}
+
+// register añade las funciones de un módulo a las predefinidas
+func register(fns ...*Builtin) {
+	for _, fn := range fns {
+		if _, ok := builtins[fn.Name]; ok {
+			panic("función predefinida duplicada: " + fn.Name)
+		}
+		builtins[fn.Name] = fn
+	}
+}
+
+// Predefined busca una función o una constante predefinida
+func Predefined(name string) (interface{}, bool) {
+	if builtin, ok := builtins[name]; ok {
+		return builtin, true
+	}
+	value, ok := constants[name]
+	return value, ok
+}
+
+// WithBuiltins añade funciones predefinidas del programa anfitrión. Se
+// consultan antes que las de Flux, así que pueden reemplazarlas. El mapa no
+// se copia: lo que se añada después también queda disponible.
+func WithBuiltins(extra map[string]*Builtin) Option {
+	return func(e *Evaluator) {
+		e.hostBuiltins = extra
+	}
+}
+
+// predefined busca una función o constante predefinida, primero entre las
+// funciones del anfitrión
+func (e *Evaluator) predefined(name string) (interface{}, bool) {
+	if builtin, ok := e.hostBuiltins[name]; ok {
+		return builtin, true
+	}
+	return Predefined(name)
+}
+
+// builtinNames devuelve los nombres de todas las funciones y constantes
+// predefinidas disponibles, incluidas las del anfitrión
+func (e *Evaluator) builtinNames() []string {
+	names := append(BuiltinNames(), ConstantNames()...)
+	for name := range e.hostBuiltins {
+		if _, ok := Predefined(name); !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BuiltinNames devuelve los nombres de las funciones predefinidas, ordenados
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConstantNames devuelve los nombres de las constantes predefinidas, como
+// PI, ordenados
+func ConstantNames() []string {
+	names := make([]string, 0, len(constants))
+	for name := range constants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func builtinLength(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errorf(ErrArgumentCount, "longitud() espera 1 argumento, pero recibió %d", len(args))
+	}
+	switch v := args[0].(type) {
+	case string:
+		return int64(utf8.RuneCountInString(v)), nil
+	case *List:
+		return int64(len(v.Elements)), nil
+	case *Dict:
+		return int64(v.Len()), nil
+	default:
+		return nil, errorf(ErrTypeMismatch, "longitud() no admite un valor de tipo %s", typeName(v))
+	}
+}
+
+func builtinKeys(args []interface{}) (interface{}, error) {
+	dict, err := dictArgument("claves", args)
+	if err != nil {
+		return nil, err
+	}
+	return &List{Elements: dict.Keys()}, nil
+}
+
+func builtinValues(args []interface{}) (interface{}, error) {
+	dict, err := dictArgument("valores", args)
+	if err != nil {
+		return nil, err
+	}
+	return &List{Elements: dict.Values()}, nil
+}
+
+func dictArgument(name string, args []interface{}) (*Dict, error) {
+	if len(args) != 1 {
+		return nil, errorf(ErrArgumentCount, "%s() espera 1 argumento, pero recibió %d", name, len(args))
+	}
+	dict, ok := args[0].(*Dict)
+	if !ok {
+		return nil, errorf(ErrTypeMismatch, "%s() espera un diccionario, pero recibió un valor de tipo %s", name, typeName(args[0]))
+	}
+	return dict, nil
+}
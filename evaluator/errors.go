@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"flux/ast"
+	"fmt"
+	"strings"
+)
+
+// ErrorCode identifica la clase de un error de ejecución
+type ErrorCode string
+
+const (
+	ErrDivisionByZero  ErrorCode = "division_por_cero"
+	ErrTypeMismatch    ErrorCode = "tipo_incorrecto"
+	ErrUndefinedName   ErrorCode = "nombre_no_definido"
+	ErrNotCallable     ErrorCode = "no_es_funcion"
+	ErrArgumentCount   ErrorCode = "numero_de_argumentos"
+	ErrInvalidArgument ErrorCode = "argumento_invalido"
+	ErrIndexOutOfRange ErrorCode = "indice_fuera_de_rango"
+	ErrKeyNotFound     ErrorCode = "clave_no_encontrada"
+	ErrConstant        ErrorCode = "constante"
+	ErrNullValue       ErrorCode = "valor_nulo"
+	ErrThrown          ErrorCode = "lanzado" // Error lanzado con 'lanzar'
+	ErrEndOfInput      ErrorCode = "fin_de_entrada"
+	ErrDomain          ErrorCode = "fuera_de_dominio" // Argumento para el que la función matemática no está definida
+	ErrOverflow        ErrorCode = "desbordamiento"   // El resultado no cabe en un entero
+	ErrInternal        ErrorCode = "interno"
+
+	// Límites de ejecución (ver limits.go)
+	ErrCancelled  ErrorCode = "cancelado" // Se canceló el contexto o venció su plazo
+	ErrStepLimit  ErrorCode = "limite_de_pasos"
+	ErrDepthLimit ErrorCode = "limite_de_profundidad"
+	ErrSizeLimit  ErrorCode = "limite_de_tamano"
+)
+
+// Frame es una llamada a función activa en el momento de un error
+type Frame struct {
+	Function string `json:"function"` // Nombre de la función llamada
+	Line     int    `json:"line"`     // Posición de la llamada; 0 si se hizo desde Go
+	Column   int    `json:"column"`
+}
+
+// RuntimeError es un error producido al ejecutar un programa de Flux.
+// Stack contiene las llamadas activas, de la más externa a la más interna.
+type RuntimeError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Line    int       `json:"line"`
+	Column  int       `json:"column"`
+	Span    ast.Span  `json:"span"` // Fragmento de código que produjo el error
+	Stack   []Frame   `json:"stack"`
+	Hint    string    `json:"hint,omitempty"` // Sugerencia opcional para corregirlo
+}
+
+func (r *RuntimeError) Error() string {
+	return fmt.Sprintf("línea %d, columna %d: %s", r.Line, r.Column, r.Message)
+}
+
+// Traceback devuelve el error junto con la pila de llamadas de Flux,
+// con la llamada más reciente al final
+func (r *RuntimeError) Traceback() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s] %s\n", r.Code, r.Error())
+	if len(r.Stack) > 0 {
+		sb.WriteString("Traza de llamadas (la más reciente al final):\n")
+		caller := "<programa>"
+		// Una recursión profunda repite la misma línea miles de veces: se
+		// muestran las primeras y se resume el resto
+		var previous string
+		repeated := 0
+		for _, frame := range r.Stack {
+			line := fmt.Sprintf("  línea %d, columna %d, en %s: llamada a '%s'\n", frame.Line, frame.Column, caller, frame.Function)
+			if frame.Line == 0 {
+				// Llamada desde Go (ver Evaluator.Call)
+				line = fmt.Sprintf("  desde Go, en %s: llamada a '%s'\n", caller, frame.Function)
+			}
+			caller = frame.Function
+			if line == previous {
+				repeated++
+				if repeated >= maxRepeatedFrames {
+					continue
+				}
+			} else {
+				writeRepeated(&sb, repeated)
+				previous, repeated = line, 0
+			}
+			sb.WriteString(line)
+		}
+		writeRepeated(&sb, repeated)
+		fmt.Fprintf(&sb, "  línea %d, columna %d, en %s: %s\n", r.Line, r.Column, caller, r.Message)
+	}
+	if r.Hint != "" {
+		fmt.Fprintf(&sb, "  = ayuda: %s\n", r.Hint)
+	}
+	return sb.String()
+}
+
+// maxRepeatedFrames es cuántas veces seguidas se muestra la misma llamada
+// en una traza antes de resumir las repeticiones
+const maxRepeatedFrames = 3
+
+func writeRepeated(sb *strings.Builder, repeated int) {
+	if hidden := repeated - maxRepeatedFrames + 1; hidden > 0 {
+		fmt.Fprintf(sb, "  [la llamada anterior se repite %d veces más]\n", hidden)
+	}
+}
+
+// newError crea un error de ejecución en la posición del nodo indicado con
+// la pila de llamadas actual
+func (e *Evaluator) newError(code ErrorCode, node ast.Node, format string, args ...interface{}) *RuntimeError {
+	span := node.Span()
+	return &RuntimeError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+		Line:    span.Start.Line,
+		Column:  span.Start.Column,
+		Span:    span,
+		Stack:   e.stackTrace(),
+	}
+}
+
+// locate completa un error que aún no tiene posición (por ejemplo, uno
+// devuelto por una función predefinida). Las señales de control de flujo y
+// los errores que ya tienen posición se devuelven sin cambios.
+func (e *Evaluator) locate(err error, node ast.Node) error {
+	switch r := err.(type) {
+	case nil, *ReturnValue, *BreakSignal, *ContinueSignal:
+		return err
+	case *RuntimeError:
+		if r.Line == 0 {
+			r.Span = node.Span()
+			r.Line = r.Span.Start.Line
+			r.Column = r.Span.Start.Column
+			r.Stack = e.stackTrace()
+		}
+		return r
+	default:
+		return e.newError(ErrInvalidArgument, node, "%s", err.Error())
+	}
+}
+
+func (e *Evaluator) stackTrace() []Frame {
+	stack := make([]Frame, len(e.frames))
+	copy(stack, e.frames)
+	return stack
+}
+
+// errorf crea un error sin posición; quien lo reciba lo ubica con locate
+func errorf(code ErrorCode, format string, args ...interface{}) *RuntimeError {
+	return &RuntimeError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Claves del diccionario con el que 'capturar' recibe un error
+const (
+	errorKeyMessage = "mensaje"
+	errorKeyCode    = "codigo"
+	errorKeyLine    = "linea"
+	errorKeyColumn  = "columna"
+)
+
+// errorValue convierte un error de ejecución en el valor que recibe la
+// variable de 'capturar': un diccionario con su mensaje, código y posición
+func errorValue(r *RuntimeError) *Dict {
+	d := NewDict()
+	d.Set(errorKeyMessage, r.Message)
+	d.Set(errorKeyCode, string(r.Code))
+	d.Set(errorKeyLine, int64(r.Line))
+	d.Set(errorKeyColumn, int64(r.Column))
+	return d
+}
+
+// errorFromValue reconstruye el error a partir de un valor creado por
+// errorValue, para que 'lanzar e' dentro de 'capturar' relance el error
+// original. Devuelve nil si el valor no tiene esa forma.
+func errorFromValue(value interface{}) *RuntimeError {
+	d, ok := value.(*Dict)
+	if !ok || d.Len() != 4 {
+		return nil
+	}
+	message, ok1 := d.values[errorKeyMessage].(string)
+	code, ok2 := d.values[errorKeyCode].(string)
+	line, ok3 := d.values[errorKeyLine].(int64)
+	column, ok4 := d.values[errorKeyColumn].(int64)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil
+	}
+	return &RuntimeError{
+		Code:    ErrorCode(code),
+		Message: message,
+		Line:    int(line),
+		Column:  int(column),
+	}
+}
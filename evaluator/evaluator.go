@@ -3,21 +3,76 @@ package evaluator
 import (
 	"fmt"
 	"flux/ast"
+	"flux/diagnostic"
 	"flux/symbol"
+	"io"
+	"os"
+	"strings"
 )
 
 type Evaluator struct {
-	symbolTable *symbol.Table
-	parentScope *symbol.Table // Para manejar scopes anidados
+	symbolTable  *symbol.Table
+	dynamicScope bool    // Compatibilidad: resolver los nombres por el scope de quien llama
+	frames       []Frame // Llamadas a funciones de Flux en curso
+	hook         Hook    // nil si nadie observa la ejecución
+	out          io.Writer
+	in           io.Reader
+	seed         *int64   // nil: semilla según la hora
+	runtime      *Runtime // Estado del programa, creado a partir de in, out y seed
+	hostBuiltins map[string]*Builtin // Funciones registradas por el programa anfitrión
+	limits       limits
 }
 
-func New(symbolTable *symbol.Table) *Evaluator {
-	return &Evaluator{
+// Option configura un Evaluator al crearlo
+type Option func(*Evaluator)
+
+// WithDynamicScope activa el comportamiento de las versiones anteriores:
+// el cuerpo de una función ve las variables de quien la llama y asignar
+// a una variable exterior crea una copia local. Solo existe para que los
+// programas escritos para ese comportamiento sigan funcionando.
+func WithDynamicScope() Option {
+	return func(e *Evaluator) {
+		e.dynamicScope = true
+	}
+}
+
+// WithOutput hace que 'mostrar' escriba en w en lugar de en la salida estándar
+func WithOutput(w io.Writer) Option {
+	return func(e *Evaluator) {
+		e.out = w
+	}
+}
+
+func New(symbolTable *symbol.Table, opts ...Option) *Evaluator {
+	e := &Evaluator{
 		symbolTable: symbolTable,
+		out:         os.Stdout,
+		in:          os.Stdin,
+		limits:      limits{maxDepth: DefaultMaxDepth},
+	}
+	for _, opt := range opts {
+		opt(e)
 	}
+	e.runtime = NewRuntime(e.in, e.out, e.seed)
+	e.runtime.maxSize = e.limits.maxSize
+	e.runtime.call = e.Call
+	return e
 }
 
 func (e *Evaluator) Evaluate(node ast.Node) error {
+	if stmt, ok := node.(ast.Statement); ok && (e.hook != nil || e.limits.budgeted()) {
+		if _, isBlock := stmt.(*ast.BlockStatement); !isBlock {
+			if err := e.checkBudget(stmt); err != nil {
+				return err
+			}
+			if e.hook != nil {
+				if err := e.hook.BeforeStatement(e, stmt); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
 	switch n := node.(type) {
 	case *ast.Program:
 		return e.evaluateProgram(n)
@@ -35,16 +90,26 @@ func (e *Evaluator) Evaluate(node ast.Node) error {
 		return e.evaluateShowStatement(n)
 	case *ast.ReturnStatement:
 		return e.evaluateReturnStatement(n)
+	case *ast.BreakStatement:
+		return &BreakSignal{Label: labelName(n.Label)}
+	case *ast.ContinueStatement:
+		return &ContinueSignal{Label: labelName(n.Label)}
+	case *ast.TryStatement:
+		return e.evaluateTryStatement(n)
+	case *ast.ThrowStatement:
+		return e.evaluateThrowStatement(n)
 	case *ast.FunctionStatement:
 		return e.evaluateFunctionStatement(n)
 	case *ast.BlockStatement:
 		return e.evaluateBlockStatement(n)
+	case *ast.IndexAssignStatement:
+		return e.evaluateIndexAssignStatement(n)
 	case *ast.ExpressionStatement:
 		// Evaluar la expresión pero ignorar el resultado (para llamadas a función sin asignación)
-		e.evaluateExpression(n.Expression)
-		return nil
+		_, err := e.evaluateExpression(n.Expression)
+		return err
 	default:
-		return fmt.Errorf("tipo de nodo no soportado: %T", node)
+		return errorf(ErrInternal, "tipo de nodo no soportado: %T", node)
 	}
 }
 
@@ -63,9 +128,13 @@ func (e *Evaluator) evaluateProgram(program *ast.Program) error {
 }
 
 func (e *Evaluator) evaluateDeclareStatement(stmt *ast.DeclareStatement) error {
-	value := e.evaluateExpression(stmt.Value)
+	value, err := e.evaluateExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
 	if value == nil {
-		return fmt.Errorf("no se pudo evaluar el valor de la declaración")
+		return e.newError(ErrNullValue, stmt.Name,
+			"la expresión asignada a '%s' no produjo ningún valor", stmt.Name.Value)
 	}
 	
 	if stmt.IsConst {
@@ -78,17 +147,67 @@ func (e *Evaluator) evaluateDeclareStatement(stmt *ast.DeclareStatement) error {
 }
 
 func (e *Evaluator) evaluateAssignStatement(stmt *ast.AssignStatement) error {
-	value := e.evaluateExpression(stmt.Value)
+	value, err := e.evaluateExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
 	if value == nil {
-		return fmt.Errorf("no se pudo evaluar el valor de la asignación")
+		return e.newError(ErrNullValue, stmt.Name,
+			"la expresión asignada a '%s' no produjo ningún valor", stmt.Name.Value)
+	}
+	
+	if e.dynamicScope {
+		e.symbolTable.Set(stmt.Name.Value, value)
+		return nil
 	}
 	
-	e.symbolTable.Set(stmt.Name.Value, value)
+	// Actualizar la variable donde fue declarada, aunque sea en un scope exterior
+	if err := e.symbolTable.Assign(stmt.Name.Value, value); err != nil {
+		return e.newError(ErrConstant, stmt.Name, "%s", err.Error())
+	}
 	return nil
 }
 
+func (e *Evaluator) evaluateIndexAssignStatement(stmt *ast.IndexAssignStatement) error {
+	container, err := e.evaluateExpression(stmt.Target.Left)
+	if err != nil {
+		return err
+	}
+	index, err := e.evaluateExpression(stmt.Target.Index)
+	if err != nil {
+		return err
+	}
+	value, err := e.evaluateExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	
+	target := stmt.Target
+	switch c := container.(type) {
+	case *List:
+		i, err := c.resolveIndex(index)
+		if err != nil {
+			return e.locate(err, target)
+		}
+		c.Elements[i] = value
+		return nil
+	case *Dict:
+		if err := checkDictKey(index); err != nil {
+			return e.locate(err, target)
+		}
+		c.Set(index, value)
+		return e.checkSize(c, target)
+	default:
+		return e.newError(ErrTypeMismatch, target,
+			"no se puede asignar un elemento a un valor de tipo %s", typeName(container))
+	}
+}
+
 func (e *Evaluator) evaluateIfStatement(stmt *ast.IfStatement) error {
-	condition := e.evaluateExpression(stmt.Condition)
+	condition, err := e.evaluateExpression(stmt.Condition)
+	if err != nil {
+		return err
+	}
 	
 	if isTruthy(condition) {
 		if stmt.Then != nil {
@@ -113,16 +232,26 @@ func (e *Evaluator) evaluateIfStatement(stmt *ast.IfStatement) error {
 
 func (e *Evaluator) evaluateWhileStatement(stmt *ast.WhileStatement) error {
 	for {
-		condition := e.evaluateExpression(stmt.Condition)
+		condition, err := e.evaluateExpression(stmt.Condition)
+		if err != nil {
+			return err
+		}
 		if !isTruthy(condition) {
 			break
 		}
 		
 		if err := e.Evaluate(stmt.Body); err != nil {
-			// Si es un ReturnValue, propagarlo
-			if IsReturnValue(err) {
+			// 'salir' y 'continuar' dirigidos a este bucle se consumen aquí
+			stop, err := loopControl(err, stmt.Label)
+			if err != nil {
 				return err
 			}
+			if stop {
+				break
+			}
+		}
+		// Cada vuelta cuenta como un paso, aunque el cuerpo esté vacío
+		if err := e.checkBudget(stmt); err != nil {
 			return err
 		}
 	}
@@ -131,23 +260,37 @@ func (e *Evaluator) evaluateWhileStatement(stmt *ast.WhileStatement) error {
 }
 
 func (e *Evaluator) evaluateRepeatStatement(stmt *ast.RepeatStatement) error {
-	from := e.evaluateExpression(stmt.From)
-	to := e.evaluateExpression(stmt.To)
+	from, err := e.evaluateExpression(stmt.From)
+	if err != nil {
+		return err
+	}
+	to, err := e.evaluateExpression(stmt.To)
+	if err != nil {
+		return err
+	}
 	
 	fromVal := getIntValue(from)
 	toVal := getIntValue(to)
 	
 	if fromVal == nil || toVal == nil {
-		return fmt.Errorf("los valores de 'desde' y 'hasta' deben ser enteros")
+		return e.newError(ErrTypeMismatch, stmt.Variable,
+			"los valores de 'desde' y 'hasta' deben ser enteros, pero son %s y %s", typeName(from), typeName(to))
 	}
 	
 	for i := *fromVal; i <= *toVal; i++ {
 		e.symbolTable.Set(stmt.Variable.Value, int64(i))
 		if err := e.Evaluate(stmt.Body); err != nil {
-			// Si es un ReturnValue, propagarlo (para retornos dentro de bucles en funciones)
-			if IsReturnValue(err) {
+			// Los ReturnValue y las señales de otros bucles se propagan
+			stop, err := loopControl(err, stmt.Label)
+			if err != nil {
 				return err
 			}
+			if stop {
+				break
+			}
+		}
+		// Cada vuelta cuenta como un paso, aunque el cuerpo esté vacío
+		if err := e.checkBudget(stmt); err != nil {
 			return err
 		}
 	}
@@ -156,8 +299,11 @@ func (e *Evaluator) evaluateRepeatStatement(stmt *ast.RepeatStatement) error {
 }
 
 func (e *Evaluator) evaluateShowStatement(stmt *ast.ShowStatement) error {
-	value := e.evaluateExpression(stmt.Value)
-	fmt.Println(value)
+	value, err := e.evaluateExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.runtime.out, inspect(value))
 	return nil
 }
 
@@ -176,25 +322,135 @@ func IsReturnValue(err error) bool {
 	return ok
 }
 
+// BreakSignal es un error especial para indicar que se debe salir de un bucle
+type BreakSignal struct {
+	Label string // Vacío si se refiere al bucle más interno
+}
+
+func (b *BreakSignal) Error() string {
+	return "salir"
+}
+
+// ContinueSignal es un error especial para pasar a la siguiente iteración de un bucle
+type ContinueSignal struct {
+	Label string // Vacío si se refiere al bucle más interno
+}
+
+func (c *ContinueSignal) Error() string {
+	return "continuar"
+}
+
+// loopControl interpreta el error devuelto por el cuerpo de un bucle.
+// Devuelve stop=true si el bucle debe terminar, o el error a propagar si
+// la señal no pertenece a este bucle (o no es una señal de bucle).
+func loopControl(err error, label *ast.Identifier) (stop bool, propagate error) {
+	switch sig := err.(type) {
+	case *BreakSignal:
+		if sig.Label == "" || sig.Label == labelName(label) {
+			return true, nil
+		}
+	case *ContinueSignal:
+		if sig.Label == "" || sig.Label == labelName(label) {
+			return false, nil
+		}
+	}
+	return false, err
+}
+
+func labelName(label *ast.Identifier) string {
+	if label == nil {
+		return ""
+	}
+	return label.Value
+}
+
 func (e *Evaluator) evaluateReturnStatement(stmt *ast.ReturnStatement) error {
 	var value interface{}
 	if stmt.Value != nil {
-		value = e.evaluateExpression(stmt.Value)
+		var err error
+		value, err = e.evaluateExpression(stmt.Value)
+		if err != nil {
+			return err
+		}
 	}
 	return &ReturnValue{Value: value}
 }
 
-// Tipo para representar funciones
+// evaluateTryStatement ejecuta un bloque 'intentar'. Los errores de ejecución
+// viajan como error igual que ReturnValue; aquí se interceptan los
+// *RuntimeError y se dejan pasar las señales de control de flujo.
+func (e *Evaluator) evaluateTryStatement(stmt *ast.TryStatement) error {
+	err := e.Evaluate(stmt.Body)
+	
+	// La cancelación y el límite de pasos no se capturan ni ejecutan 'finalmente'
+	if IsFatal(err) {
+		return err
+	}
+	if runtimeErr, ok := err.(*RuntimeError); ok && stmt.Catch != nil {
+		if stmt.CatchName != nil {
+			e.symbolTable.Set(stmt.CatchName.Value, errorValue(runtimeErr))
+		}
+		err = e.Evaluate(stmt.Catch)
+		if IsFatal(err) {
+			return err
+		}
+	}
+	
+	// 'finalmente' se ejecuta siempre. Si termina con su propio error o con
+	// una señal ('retornar', 'salir'...), ésta sustituye a la pendiente.
+	if stmt.Finally != nil {
+		if finallyErr := e.Evaluate(stmt.Finally); finallyErr != nil {
+			return finallyErr
+		}
+	}
+	
+	return err
+}
+
+func (e *Evaluator) evaluateThrowStatement(stmt *ast.ThrowStatement) error {
+	value, err := e.evaluateExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	// Volver a lanzar un error capturado conserva su código y su posición
+	if rethrown := errorFromValue(value); rethrown != nil {
+		rethrown.Stack = e.stackTrace()
+		return rethrown
+	}
+	message, ok := value.(string)
+	if !ok {
+		message = inspect(value)
+	}
+	return e.newError(ErrThrown, stmt, "%s", message)
+}
+
+// Tipo para representar funciones. Env es el scope donde se definió la
+// función: las variables libres del cuerpo se resuelven ahí (clausura).
 type Function struct {
+	Name       string // Vacío para las funciones anónimas
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
+	Env        *symbol.Table
+}
+
+func (f *Function) String() string {
+	return fmt.Sprintf("<función %s>", f.displayName())
+}
+
+func (f *Function) displayName() string {
+	if f.Name == "" {
+		return "anónima"
+	}
+	return f.Name
 }
 
 func (e *Evaluator) evaluateFunctionStatement(stmt *ast.FunctionStatement) error {
 	// Registrar la función en la tabla de símbolos
 	fn := &Function{
+		Name:       stmt.Name.Value,
 		Parameters: stmt.Parameters,
 		Body:       stmt.Body,
+		Env:        e.symbolTable,
 	}
 	e.symbolTable.Set(stmt.Name.Value, fn)
 	return nil
@@ -214,154 +470,327 @@ func (e *Evaluator) evaluateBlockStatement(stmt *ast.BlockStatement) error {
 	return nil
 }
 
-func (e *Evaluator) evaluateExpression(expr ast.Expression) interface{} {
+// EvaluateExpression evalúa una expresión en el scope actual y devuelve su
+// valor. La usa el REPL para mostrar el resultado de las expresiones sueltas.
+func (e *Evaluator) EvaluateExpression(expr ast.Expression) (interface{}, error) {
+	return e.evaluateExpression(expr)
+}
+
+func (e *Evaluator) evaluateExpression(expr ast.Expression) (interface{}, error) {
 	switch ex := expr.(type) {
 	case *ast.IntegerLiteral:
-		return ex.Value
+		return ex.Value, nil
 	case *ast.FloatLiteral:
-		return ex.Value
+		return ex.Value, nil
 	case *ast.StringLiteral:
-		return ex.Value
+		return ex.Value, nil
 	case *ast.BooleanLiteral:
-		return ex.Value
+		return ex.Value, nil
+	case *ast.InterpolatedString:
+		return e.evaluateInterpolatedString(ex)
+	case *ast.ListLiteral:
+		return e.evaluateListLiteral(ex)
+	case *ast.DictLiteral:
+		return e.evaluateDictLiteral(ex)
+	case *ast.FunctionLiteral:
+		return &Function{
+			Parameters: ex.Parameters,
+			Body:       ex.Body,
+			Env:        e.symbolTable,
+		}, nil
 	case *ast.Identifier:
 		// Buscar en el scope actual (que buscará recursivamente en los padres)
 		val, ok := e.symbolTable.Get(ex.Value)
 		if ok {
-			return val
+			return val, nil
 		}
-		return nil
+		if value, ok := e.predefined(ex.Value); ok {
+			return value, nil
+		}
+		err := e.newError(ErrUndefinedName, ex, "el nombre '%s' no está definido", ex.Value)
+		candidates := append(e.symbolTable.VisibleNames(), e.builtinNames()...)
+		if suggestion, ok := diagnostic.Closest(ex.Value, candidates, diagnostic.MaxDistance(ex.Value)); ok {
+			err.Hint = fmt.Sprintf("¿quisiste decir '%s'?", suggestion)
+		}
+		return nil, err
 	case *ast.InfixExpression:
 		return e.evaluateInfixExpression(ex)
 	case *ast.PrefixExpression:
 		return e.evaluatePrefixExpression(ex)
+	case *ast.IndexExpression:
+		return e.evaluateIndexExpression(ex)
 	case *ast.CallExpression:
 		return e.evaluateCallExpression(ex)
 	default:
-		return nil
+		return nil, errorf(ErrInternal, "tipo de expresión no soportado: %T", expr)
+	}
+}
+
+// evaluateInterpolatedString une el texto y los valores de las expresiones
+// ${...}, escritos como los escribe 'mostrar'
+func (e *Evaluator) evaluateInterpolatedString(str *ast.InterpolatedString) (interface{}, error) {
+	values := make([]interface{}, len(str.Parts))
+	for i, part := range str.Parts {
+		val, err := e.evaluateExpression(part)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = val
+	}
+	if err := e.checkText(str, values...); err != nil {
+		return nil, err
+	}
+	var text strings.Builder
+	for _, val := range values {
+		text.WriteString(inspect(val))
+	}
+	return text.String(), nil
+}
+
+func (e *Evaluator) evaluateListLiteral(lit *ast.ListLiteral) (interface{}, error) {
+	elements := make([]interface{}, len(lit.Elements))
+	for i, el := range lit.Elements {
+		val, err := e.evaluateExpression(el)
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = val
+	}
+	return &List{Elements: elements}, nil
+}
+
+func (e *Evaluator) evaluateDictLiteral(lit *ast.DictLiteral) (interface{}, error) {
+	dict := NewDict()
+	for _, pair := range lit.Pairs {
+		key, err := e.evaluateExpression(pair.Key)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkDictKey(key); err != nil {
+			return nil, e.locate(err, pair.Key)
+		}
+		value, err := e.evaluateExpression(pair.Value)
+		if err != nil {
+			return nil, err
+		}
+		dict.Set(key, value)
+	}
+	return dict, nil
+}
+
+func (e *Evaluator) evaluateIndexExpression(expr *ast.IndexExpression) (interface{}, error) {
+	container, err := e.evaluateExpression(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+	index, err := e.evaluateExpression(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+	
+	switch c := container.(type) {
+	case *List:
+		i, err := c.resolveIndex(index)
+		if err != nil {
+			return nil, e.locate(err, expr)
+		}
+		return c.Elements[i], nil
+	case string:
+		char, err := stringIndex(c, index)
+		if err != nil {
+			return nil, e.locate(err, expr)
+		}
+		return char, nil
+	case *Dict:
+		if err := checkDictKey(index); err != nil {
+			return nil, e.locate(err, expr)
+		}
+		val, ok := c.Get(index)
+		if !ok {
+			return nil, e.newError(ErrKeyNotFound, expr,
+				"la clave %s no existe en el diccionario", inspectElement(index))
+		}
+		return val, nil
+	default:
+		return nil, e.newError(ErrTypeMismatch, expr,
+			"no se puede indexar un valor de tipo %s", typeName(container))
 	}
 }
 
-func (e *Evaluator) evaluateInfixExpression(expr *ast.InfixExpression) interface{} {
-	left := e.evaluateExpression(expr.Left)
-	right := e.evaluateExpression(expr.Right)
+func (e *Evaluator) evaluateInfixExpression(expr *ast.InfixExpression) (interface{}, error) {
+	left, err := e.evaluateExpression(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.evaluateExpression(expr.Right)
+	if err != nil {
+		return nil, err
+	}
 	
+	var result interface{}
 	switch expr.Operator {
 	case "+":
-		return add(left, right)
+		// Sumar a una cadena escribe el otro valor, que puede ser enorme
+		if _, ok := left.(string); ok {
+			if err := e.checkText(expr, left, right); err != nil {
+				return nil, err
+			}
+		}
+		result = add(left, right)
+		if err := e.checkSize(result, expr); err != nil {
+			return nil, err
+		}
 	case "-":
-		return subtract(left, right)
+		result = subtract(left, right)
 	case "*":
-		return multiply(left, right)
-	case "/":
-		return divide(left, right)
-	case "%":
-		return modulo(left, right)
+		result = multiply(left, right)
+	case "/", "%":
+		if isZero(right) {
+			return nil, e.newError(ErrDivisionByZero, expr, "división por cero")
+		}
+		if expr.Operator == "/" {
+			result = divide(left, right)
+		} else {
+			result = modulo(left, right)
+		}
 	case "↔", "==":
-		return left == right
+		return valuesEqual(left, right), nil
 	case "≠", "!=":
-		return left != right
-	case "<":
-		return lessThan(left, right)
-	case ">":
-		return greaterThan(left, right)
-	case "≤", "<=":
-		return lessOrEqual(left, right)
-	case "≥", ">=":
-		return greaterOrEqual(left, right)
+		return !valuesEqual(left, right), nil
+	case "<", ">", "≤", "<=", "≥", ">=":
+		cmp, ok := compare(left, right)
+		if !ok {
+			break
+		}
+		switch expr.Operator {
+		case "<":
+			return cmp < 0, nil
+		case ">":
+			return cmp > 0, nil
+		case "≤", "<=":
+			return cmp <= 0, nil
+		default:
+			return cmp >= 0, nil
+		}
 	case "∧", "&&":
-		return isTruthy(left) && isTruthy(right)
+		return isTruthy(left) && isTruthy(right), nil
 	case "∨", "||":
-		return isTruthy(left) || isTruthy(right)
+		return isTruthy(left) || isTruthy(right), nil
 	default:
-		return nil
+		return nil, e.newError(ErrInternal, expr, "operador desconocido '%s'", expr.Operator)
 	}
+	
+	// Las operaciones entre tipos incompatibles no producen valor
+	if result == nil {
+		return nil, e.newError(ErrTypeMismatch, expr,
+			"no se puede aplicar '%s' a %s y %s", expr.Operator, typeName(left), typeName(right))
+	}
+	return result, nil
 }
 
-func (e *Evaluator) evaluatePrefixExpression(expr *ast.PrefixExpression) interface{} {
-	right := e.evaluateExpression(expr.Right)
+func (e *Evaluator) evaluatePrefixExpression(expr *ast.PrefixExpression) (interface{}, error) {
+	right, err := e.evaluateExpression(expr.Right)
+	if err != nil {
+		return nil, err
+	}
 	
 	switch expr.Operator {
 	case "¬", "!":
-		return !isTruthy(right)
+		return !isTruthy(right), nil
 	case "-":
 		if val, ok := right.(int64); ok {
-			return -val
+			return -val, nil
 		}
 		if val, ok := right.(float64); ok {
-			return -val
+			return -val, nil
 		}
 	}
 	
-	return nil
+	return nil, e.newError(ErrTypeMismatch, expr,
+		"no se puede aplicar '%s' a un valor de tipo %s", expr.Operator, typeName(right))
 }
 
-func (e *Evaluator) evaluateCallExpression(expr *ast.CallExpression) interface{} {
-	// Obtener el nombre de la función
-	var fnName string
-	if ident, ok := expr.Function.(*ast.Identifier); ok {
-		fnName = ident.Value
-	} else {
-		return nil
-	}
-	
-	// Buscar la función en la tabla de símbolos
-	// Primero buscar en el scope actual
-	val, ok := e.symbolTable.Get(fnName)
-	
-	// Si no está en el scope actual, buscar en el scope padre (variables globales)
-	if !ok && e.parentScope != nil {
-		val, ok = e.parentScope.Get(fnName)
-	}
-	
-	// Si aún no está, buscar recursivamente en los scopes padres
-	if !ok {
-		parent := e.parentScope
-		for parent != nil {
-			val, ok = parent.Get(fnName)
-			if ok {
-				break
+func (e *Evaluator) evaluateCallExpression(expr *ast.CallExpression) (interface{}, error) {
+	// La función puede venir de cualquier expresión: un nombre, un
+	// elemento de una lista, el resultado de otra llamada...
+	val, err := e.evaluateExpression(expr.Function)
+	if err != nil {
+		if r, ok := err.(*RuntimeError); ok && r.Code == ErrUndefinedName {
+			if ident, ok := expr.Function.(*ast.Identifier); ok {
+				r.Message = fmt.Sprintf("la función '%s' no está definida", ident.Value)
 			}
-			// En una implementación completa, tendríamos un campo parentScope en Table
-			// Por ahora, solo buscamos en el scope padre inmediato
-			break
 		}
-	}
-	
-	if !ok {
-		// Función no encontrada - esto podría ser un error
-		return nil
-	}
-	
-	fn, ok := val.(*Function)
-	if !ok {
-		return nil
+		return nil, err
 	}
 	
 	// Evaluar los argumentos
 	args := make([]interface{}, len(expr.Arguments))
 	for i, arg := range expr.Arguments {
-		args[i] = e.evaluateExpression(arg)
+		argVal, err := e.evaluateExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = argVal
 	}
 	
+	switch fn := val.(type) {
+	case *Builtin:
+		// Las funciones predefinidas también cuentan: las del anfitrión
+		// pueden volver a llamar a funciones de Flux
+		if err := e.checkDepth(expr); err != nil {
+			return nil, err
+		}
+		e.frames = append(e.frames, Frame{Function: fn.Name, Line: expr.Loc.Start.Line, Column: expr.Loc.Start.Column})
+		result, err := fn.Invoke(e.runtime, args)
+		err = e.locate(err, expr)
+		if err == nil {
+			err = e.checkSize(result, expr)
+		}
+		e.frames = e.frames[:len(e.frames)-1]
+		return result, err
+	case *Function:
+		if len(args) != len(fn.Parameters) {
+			return nil, e.newError(ErrArgumentCount, expr,
+				"la función '%s' espera %d argumentos, pero recibió %d", fn.displayName(), len(fn.Parameters), len(args))
+		}
+		if err := e.checkDepth(expr); err != nil {
+			return nil, err
+		}
+		e.frames = append(e.frames, Frame{Function: fn.displayName(), Line: expr.Loc.Start.Line, Column: expr.Loc.Start.Column})
+		result, err := e.callFunction(fn, args)
+		e.frames = e.frames[:len(e.frames)-1]
+		return result, err
+	default:
+		return nil, e.newError(ErrNotCallable, expr,
+			"un valor de tipo %s no se puede llamar como función", typeName(val))
+	}
+}
+
+// callFunction ejecuta una función de Flux con los argumentos ya evaluados
+func (e *Evaluator) callFunction(fn *Function, args []interface{}) (interface{}, error) {
 	// Guardar el scope actual
 	oldTable := e.symbolTable
-	oldParent := e.parentScope
 	
-	// Crear un nuevo scope para los parámetros con el scope anterior como padre
-	newTable := symbol.NewTableWithParent(oldTable)
+	// El scope de la llamada cuelga del scope donde se definió la función,
+	// no del de quien la llama (salvo en modo de compatibilidad)
+	parent := fn.Env
+	if e.dynamicScope {
+		parent = oldTable
+	}
+	newTable := symbol.NewTableWithParent(parent)
 	e.symbolTable = newTable
-	e.parentScope = oldTable // El scope anterior es el padre
 	
 	// Asignar los argumentos a los parámetros
 	for i, param := range fn.Parameters {
-		if i < len(args) {
-			newTable.Set(param.Value, args[i])
-		}
+		newTable.Set(param.Value, args[i])
+	}
+	if e.hook != nil {
+		e.hook.EnterFunction(e, fn, args)
 	}
 	
 	// Ejecutar el cuerpo de la función
 	var result interface{}
+	var callErr error
 	
 	// Ejecutar todas las sentencias del cuerpo
 	for _, stmt := range fn.Body.Statements {
@@ -372,19 +801,66 @@ func (e *Evaluator) evaluateCallExpression(expr *ast.CallExpression) interface{}
 				result = retVal.Value
 				break
 			}
-			// Si es otro error, continuar (en producción se manejaría mejor)
+			// Los errores de ejecución interrumpen la llamada
+			callErr = err
+			break
 		}
 	}
 	
+	if e.hook != nil {
+		e.hook.ExitFunction(e, fn, result, callErr)
+	}
+	
 	// Restaurar el scope anterior
 	e.symbolTable = oldTable
-	e.parentScope = oldParent
 	
-	return result
+	return result, callErr
+}
+
+// Call llama a una función de Flux (o predefinida) desde Go, con los
+// argumentos ya convertidos a valores de Flux. La llamada cuenta para la
+// profundidad máxima y aparece en la pila sin posición, porque no está en
+// el código; los errores de una función predefinida, de aridad o de
+// profundidad tampoco tienen posición.
+func (e *Evaluator) Call(fn interface{}, args []interface{}) (interface{}, error) {
+	var name string
+	switch f := fn.(type) {
+	case *Builtin:
+		name = f.Name
+	case *Function:
+		if len(args) != len(f.Parameters) {
+			return nil, errorf(ErrArgumentCount,
+				"la función '%s' espera %d argumentos, pero recibió %d", f.displayName(), len(f.Parameters), len(args))
+		}
+		name = f.displayName()
+	default:
+		return nil, errorf(ErrNotCallable, "un valor de tipo %s no se puede llamar como función", typeName(fn))
+	}
+	// Una función del anfitrión que recibe una función de Flux puede
+	// llevar a una recursión que no pasa por evaluateCallExpression
+	if err := e.checkDepth(nil); err != nil {
+		return nil, err
+	}
+	e.frames = append(e.frames, Frame{Function: name})
+	var result interface{}
+	var err error
+	if builtin, ok := fn.(*Builtin); ok {
+		result, err = builtin.Invoke(e.runtime, args)
+	} else {
+		result, err = e.callFunction(fn.(*Function), args)
+	}
+	e.frames = e.frames[:len(e.frames)-1]
+	return result, err
 }
 
 // Funciones auxiliares
 func isTruthy(obj interface{}) bool {
+	if list, ok := obj.(*List); ok {
+		return len(list.Elements) > 0
+	}
+	if dict, ok := obj.(*Dict); ok {
+		return dict.Len() > 0
+	}
 	switch obj {
 	case nil:
 		return false
@@ -425,7 +901,15 @@ func add(left, right interface{}) interface{} {
 			return l + float64(r)
 		}
 	case string:
-		return l + fmt.Sprintf("%v", right)
+		return l + inspect(right)
+	case *List:
+		// Concatenación de listas: produce una lista nueva
+		if r, ok := right.(*List); ok {
+			elements := make([]interface{}, 0, len(l.Elements)+len(r.Elements))
+			elements = append(elements, l.Elements...)
+			elements = append(elements, r.Elements...)
+			return &List{Elements: elements}
+		}
 	}
 	return nil
 }
@@ -514,35 +998,47 @@ func modulo(left, right interface{}) interface{} {
 	return nil
 }
 
-func lessThan(left, right interface{}) bool {
-	switch l := left.(type) {
-	case int64:
-		if r, ok := right.(int64); ok {
-			return l < r
-		}
-		if r, ok := right.(float64); ok {
-			return float64(l) < r
-		}
-	case float64:
-		if r, ok := right.(float64); ok {
-			return l < r
-		}
-		if r, ok := right.(int64); ok {
-			return l < float64(r)
+// compare ordena dos números o dos cadenas. ok es falso si los valores
+// no se pueden comparar entre sí.
+func compare(left, right interface{}) (cmp int, ok bool) {
+	if l, isStr := left.(string); isStr {
+		r, isStr := right.(string)
+		if !isStr {
+			return 0, false
 		}
+		return strings.Compare(l, r), true
+	}
+	l, lok := toFloat(left)
+	r, rok := toFloat(right)
+	if !lok || !rok {
+		return 0, false
+	}
+	switch {
+	case l < r:
+		return -1, true
+	case l > r:
+		return 1, true
+	default:
+		return 0, true
 	}
-	return false
-}
-
-func greaterThan(left, right interface{}) bool {
-	return lessThan(right, left)
 }
 
-func lessOrEqual(left, right interface{}) bool {
-	return !greaterThan(left, right)
+func toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
 }
 
-func greaterOrEqual(left, right interface{}) bool {
-	return !lessThan(left, right)
+func isZero(val interface{}) bool {
+	switch v := val.(type) {
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	}
+	return false
 }
-
@@ -0,0 +1,43 @@
+package evaluator
+
+import (
+	"flux/ast"
+	"flux/symbol"
+)
+
+// Hook observa la ejecución de un programa. El depurador lo usa para
+// detenerse antes de ejecutar una sentencia y la traza para registrar cada
+// paso.
+type Hook interface {
+	// BeforeStatement se llama antes de ejecutar cada sentencia (los
+	// bloques no cuentan, sí las sentencias que contienen). Si devuelve un
+	// error, la ejecución se interrumpe con ese error.
+	BeforeStatement(e *Evaluator, stmt ast.Statement) error
+
+	// EnterFunction se llama al empezar una llamada a una función de Flux,
+	// con su scope ya creado y los parámetros asignados. La llamada ya está
+	// en Stack.
+	EnterFunction(e *Evaluator, fn *Function, args []interface{})
+
+	// ExitFunction se llama al terminar la llamada, antes de volver al scope
+	// de quien llamó. err es el error que interrumpió la llamada, si lo hubo.
+	ExitFunction(e *Evaluator, fn *Function, result interface{}, err error)
+}
+
+// WithHook instala un Hook que se llama durante la ejecución
+func WithHook(hook Hook) Option {
+	return func(e *Evaluator) {
+		e.hook = hook
+	}
+}
+
+// Scope devuelve la tabla de símbolos del scope que se está ejecutando
+func (e *Evaluator) Scope() *symbol.Table {
+	return e.symbolTable
+}
+
+// Stack devuelve las llamadas en curso, de la más antigua a la más
+// reciente. Cada Frame indica la función llamada y dónde se la llamó.
+func (e *Evaluator) Stack() []Frame {
+	return e.stackTrace()
+}
@@ -0,0 +1,117 @@
+package evaluator
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Funciones de entrada: leen de la entrada del programa (ver WithInput)
+func init() {
+	register(
+		&Builtin{Name: "leer", Stateful: builtinRead},
+		&Builtin{Name: "leer_numero", Stateful: builtinReadNumber},
+		&Builtin{Name: "hay_entrada", Stateful: builtinHasInput},
+		&Builtin{Name: "lineas", Stateful: builtinLines},
+	)
+}
+
+// readLine lee la siguiente línea sin el salto de línea. ok es falso si la
+// entrada ya se acabó.
+func (rt *Runtime) readLine() (line string, ok bool, err error) {
+	line, err = rt.in.ReadString('\n')
+	if err == io.EOF {
+		if line == "" {
+			return "", false, nil
+		}
+		err = nil
+	}
+	if err != nil {
+		return "", false, errorf(ErrInternal, "no se pudo leer la entrada: %v", err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), true, nil
+}
+
+// prompt muestra el mensaje opcional de 'leer' y 'leer_numero'
+func (rt *Runtime) prompt(name string, args []interface{}) error {
+	if len(args) > 1 {
+		return errorf(ErrArgumentCount, "%s() espera como mucho 1 argumento, pero recibió %d", name, len(args))
+	}
+	if len(args) == 1 {
+		io.WriteString(rt.out, inspect(args[0]))
+	}
+	return nil
+}
+
+func endOfInput(name string) error {
+	return errorf(ErrEndOfInput, "%s(): no quedan datos en la entrada", name)
+}
+
+// builtinRead lee una línea de la entrada, después de mostrar el mensaje
+// si lo hay
+func builtinRead(rt *Runtime, args []interface{}) (interface{}, error) {
+	if err := rt.prompt("leer", args); err != nil {
+		return nil, err
+	}
+	line, ok, err := rt.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, endOfInput("leer")
+	}
+	return line, nil
+}
+
+// builtinReadNumber lee una línea y la convierte en un entero o, si tiene
+// parte decimal, en un decimal
+func builtinReadNumber(rt *Runtime, args []interface{}) (interface{}, error) {
+	if err := rt.prompt("leer_numero", args); err != nil {
+		return nil, err
+	}
+	line, ok, err := rt.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, endOfInput("leer_numero")
+	}
+	text := strings.TrimSpace(line)
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXpPnN_") {
+		return f, nil
+	}
+	return nil, errorf(ErrInvalidArgument, "leer_numero() esperaba un número, pero leyó '%s'", text)
+}
+
+// builtinHasInput indica si quedan datos por leer, para recorrer la
+// entrada línea a línea con 'mientras hay_entrada() hacer'
+func builtinHasInput(rt *Runtime, args []interface{}) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, errorf(ErrArgumentCount, "hay_entrada() no espera argumentos, pero recibió %d", len(args))
+	}
+	_, err := rt.in.Peek(1)
+	return err == nil, nil
+}
+
+// builtinLines lee el resto de la entrada y la devuelve como una lista de
+// líneas
+func builtinLines(rt *Runtime, args []interface{}) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, errorf(ErrArgumentCount, "lineas() no espera argumentos, pero recibió %d", len(args))
+	}
+	lines := []interface{}{}
+	for {
+		line, ok, err := rt.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return &List{Elements: lines}, nil
+		}
+		lines = append(lines, line)
+	}
+}
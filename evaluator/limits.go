@@ -0,0 +1,182 @@
+package evaluator
+
+import (
+	"context"
+	"flux/ast"
+	"unicode/utf8"
+)
+
+// DefaultMaxDepth es la profundidad máxima de llamadas si no se indica
+// otra. Cada llamada de Flux usa la pila de Go, así que sin este límite una
+// recursión infinita terminaría el proceso en lugar de dar un error.
+const DefaultMaxDepth = 10000
+
+// limits son los límites de ejecución de un Evaluator. Salvo maxDepth, que
+// siempre tiene un valor, cero significa sin límite.
+type limits struct {
+	done     <-chan struct{} // Se cierra cuando se cancela el contexto
+	ctx      context.Context
+	maxSteps int
+	steps    int // Sentencias ejecutadas hasta ahora
+	maxDepth int
+	maxSize  int
+}
+
+// WithContext interrumpe la ejecución cuando el contexto se cancela o
+// vence su plazo, con un error ErrCancelled
+func WithContext(ctx context.Context) Option {
+	return func(e *Evaluator) {
+		e.limits.ctx = ctx
+		e.limits.done = ctx.Done()
+	}
+}
+
+// WithMaxSteps limita el número de sentencias que se ejecutan (los bloques
+// no cuentan, sí las sentencias que contienen, y cada vuelta de un bucle
+// cuenta como una más). Al superarlo la ejecución se interrumpe con un
+// error ErrStepLimit.
+func WithMaxSteps(n int) Option {
+	return func(e *Evaluator) {
+		e.limits.maxSteps = n
+	}
+}
+
+// WithMaxDepth cambia la profundidad máxima de llamadas a funciones de Flux
+// (por defecto DefaultMaxDepth). Superarla produce un error ErrDepthLimit.
+// Con n <= 0 se usa el valor por defecto: no se puede quitar el límite.
+func WithMaxDepth(n int) Option {
+	return func(e *Evaluator) {
+		if n <= 0 {
+			n = DefaultMaxDepth
+		}
+		e.limits.maxDepth = n
+	}
+}
+
+// WithMaxSize limita la longitud de las cadenas (en caracteres) y el número
+// de elementos de las listas y diccionarios que crea el programa. Superarlo
+// produce un error ErrSizeLimit.
+func WithMaxSize(n int) Option {
+	return func(e *Evaluator) {
+		e.limits.maxSize = n
+	}
+}
+
+// budgeted indica si hay que contar los pasos o vigilar el contexto
+func (l *limits) budgeted() bool {
+	return l.done != nil || l.maxSteps > 0
+}
+
+// checkBudget comprueba, antes de ejecutar una sentencia, que no se haya
+// cancelado la ejecución ni agotado el número de pasos
+func (e *Evaluator) checkBudget(stmt ast.Statement) error {
+	if !e.limits.budgeted() {
+		return nil
+	}
+	if e.limits.done != nil {
+		select {
+		case <-e.limits.done:
+			err := e.newError(ErrCancelled, stmt, "la ejecución se interrumpió: %v", e.limits.ctx.Err())
+			if e.limits.ctx.Err() == context.DeadlineExceeded {
+				err.Message = "la ejecución superó el tiempo máximo"
+			}
+			return err
+		default:
+		}
+	}
+	if e.limits.maxSteps > 0 {
+		e.limits.steps++
+		if e.limits.steps > e.limits.maxSteps {
+			err := e.newError(ErrStepLimit, stmt, "la ejecución superó el máximo de %d pasos", e.limits.maxSteps)
+			err.Hint = "¿hay un bucle que no termina?"
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDepth comprueba que se pueda hacer una llamada más. call es nil en
+// las llamadas desde Go (ver Call): el error no tiene posición y lo ubica
+// la llamada del código que llevó hasta allí.
+func (e *Evaluator) checkDepth(call *ast.CallExpression) error {
+	if len(e.frames) < e.limits.maxDepth {
+		return nil
+	}
+	var err *RuntimeError
+	if call != nil {
+		err = e.newError(ErrDepthLimit, call, "se superó la profundidad máxima de %d llamadas", e.limits.maxDepth)
+	} else {
+		err = errorf(ErrDepthLimit, "se superó la profundidad máxima de %d llamadas", e.limits.maxDepth)
+	}
+	err.Hint = "comprueba que las llamadas recursivas lleguen a un caso base"
+	return err
+}
+
+// checkSize comprueba que un valor recién creado no supere el tamaño máximo
+func (e *Evaluator) checkSize(value interface{}, node ast.Node) error {
+	if e.limits.maxSize <= 0 {
+		return nil
+	}
+	// Una cadena nunca tiene más caracteres que bytes: si los bytes caben,
+	// no hace falta contarlos
+	if s, ok := value.(string); ok && len(s) <= e.limits.maxSize {
+		return nil
+	}
+	if size, kind := sizeOf(value); size > e.limits.maxSize {
+		return e.newError(ErrSizeLimit, node, "%s de %d %s supera el tamaño máximo de %d", kind, size, sizeUnit(value), e.limits.maxSize)
+	}
+	return nil
+}
+
+// checkText comprueba, antes de crearla, que la cadena que resulta de
+// escribir values uno tras otro como los muestra 'mostrar' no supere el
+// tamaño máximo. Así una lista con muchas copias de otra no llega a
+// convertirse en una cadena enorme para descubrir después que no cabe.
+func (e *Evaluator) checkText(node ast.Node, values ...interface{}) error {
+	if e.limits.maxSize <= 0 {
+		return nil
+	}
+	m := newMeasurer(int64(e.limits.maxSize))
+	var size int64
+	for _, value := range values {
+		size = addLength(size, m.length(value))
+	}
+	if size > int64(e.limits.maxSize) {
+		return e.newError(ErrSizeLimit, node, "la cadena resultante supera el tamaño máximo de %d caracteres", e.limits.maxSize)
+	}
+	return nil
+}
+
+// sizeOf devuelve el tamaño de una cadena (en caracteres) o de una
+// colección (en elementos) y el nombre de su tipo con artículo ("una
+// cadena"). Los demás valores tienen tamaño cero.
+func sizeOf(value interface{}) (int, string) {
+	switch v := value.(type) {
+	case string:
+		return utf8.RuneCountInString(v), "una cadena"
+	case *List:
+		return len(v.Elements), "una lista"
+	case *Dict:
+		return v.Len(), "un diccionario"
+	default:
+		return 0, ""
+	}
+}
+
+func sizeUnit(value interface{}) string {
+	if _, ok := value.(string); ok {
+		return "caracteres"
+	}
+	return "elementos"
+}
+
+// IsFatal indica si un error detiene el programa sin que 'intentar' pueda
+// capturarlo ni se ejecuten los bloques 'finalmente': la cancelación y el
+// límite de pasos. Los imponen quienes ejecutan el programa, así que el
+// propio programa no debe poder saltárselos. Los límites de profundidad y
+// de tamaño sí se pueden capturar, porque al producirse ya no consumen
+// recursos.
+func IsFatal(err error) bool {
+	r, ok := err.(*RuntimeError)
+	return ok && (r.Code == ErrCancelled || r.Code == ErrStepLimit)
+}
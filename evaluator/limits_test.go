@@ -0,0 +1,96 @@
+package evaluator
+
+import (
+	"flux/ast"
+	"flux/lexer"
+	"flux/parser"
+	"flux/symbol"
+	"io"
+	"math"
+	"runtime"
+	"testing"
+	"unicode/utf8"
+)
+
+// parse analiza un programa que no debe tener errores
+func parse(t *testing.T, source string) *ast.Program {
+	t.Helper()
+	tokens, err := lexer.New(source).Tokenize()
+	if err != nil {
+		t.Fatalf("error del lexer: %v", err)
+	}
+	program, err := parser.New(tokens).Parse()
+	if err != nil {
+		t.Fatalf("error del parser: %v", err)
+	}
+	return program
+}
+
+// measurer debe dar exactamente lo que mide el texto de inspect
+func TestMeasurerMatchesInspect(t *testing.T) {
+	shared := &List{Elements: []interface{}{"a", int64(1)}}
+	cyclic := &List{Elements: []interface{}{int64(1)}}
+	cyclic.Elements = append(cyclic.Elements, cyclic, &List{Elements: []interface{}{cyclic}})
+	dict := NewDict()
+	dict.Set("clave", shared)
+	dict.Set(int64(2), dict)
+	dict.Set(true, nil)
+
+	values := []interface{}{
+		nil, true, int64(-42), 3.5, 1e21, "", "hola", "ñandú 😀",
+		&List{},
+		NewDict(),
+		&List{Elements: []interface{}{"comillas \" y \\", "salto\n\ttab", "\x01\x7f", "\xff\xfe", "­", "\U000e0001", "😀"}},
+		&List{Elements: []interface{}{shared, shared, &List{Elements: []interface{}{shared}}}},
+		cyclic,
+		dict,
+		&List{Elements: []interface{}{&Builtin{Name: "abs"}, &Function{Name: "f"}}},
+	}
+	for _, value := range values {
+		want := int64(utf8.RuneCountInString(inspect(value)))
+		if got := newMeasurer(math.MaxInt64).length(value); got != want {
+			t.Errorf("%s: mide %d, pero inspect escribe %d caracteres", inspect(value), got, want)
+		}
+	}
+}
+
+// Con un tamaño máximo, las cadenas que se crean a partir de listas se
+// rechazan antes de crearlas, aunque la lista contenga muchas veces otra
+func TestSizeLimitBeforeBuilding(t *testing.T) {
+	const setup = `definir s = repetir_cadena("x", 10000)
+definir l = []
+repetir i desde 1 hasta 1000 hacer
+    l = l + [s]
+fin
+definir m = [l, l, l, l, l, l, l, l, l, l]
+`
+	for _, expr := range []string{`unir(l)`, `"${l}"`, `"x" + l`, `unir(m, ", ")`, `"${m}"`, `"x" + m`} {
+		e := New(symbol.NewTable(), WithOutput(io.Discard), WithMaxSize(20000))
+		if err := e.Evaluate(parse(t, setup)); err != nil {
+			t.Fatal(err)
+		}
+		program := parse(t, "definir r = "+expr)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		err := e.Evaluate(program)
+		runtime.ReadMemStats(&after)
+
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok || runtimeErr.Code != ErrSizeLimit {
+			t.Errorf("%s: se esperaba un error %s, pero llegó %v", expr, ErrSizeLimit, err)
+		}
+		// El resultado tendría 10 millones de caracteres o más
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("%s: se reservaron %d bytes antes de dar el error", expr, allocated)
+		}
+	}
+
+	// Lo que cabe se sigue creando
+	for _, expr := range []string{`unir(["a", 1, [2]], "-")`, `"${[s]}"`, `"x" + [1, "a"]`} {
+		e := New(symbol.NewTable(), WithOutput(io.Discard), WithMaxSize(20000))
+		if err := e.Evaluate(parse(t, `definir s = repetir_cadena("x", 19990)
+definir r = `+expr)); err != nil {
+			t.Errorf("%s: error inesperado %v", expr, err)
+		}
+	}
+}
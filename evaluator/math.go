@@ -0,0 +1,370 @@
+package evaluator
+
+import (
+	"math"
+)
+
+// Módulo de matemáticas. Las funciones aceptan enteros y decimales; las que
+// pueden dar un resultado exacto (abs, potencia, min, max...) conservan los
+// enteros, y las que redondean (piso, techo, redondear) devuelven enteros.
+func init() {
+	register(
+		&Builtin{Name: "raiz", Fn: builtinSqrt},
+		&Builtin{Name: "potencia", Fn: builtinPow},
+		&Builtin{Name: "abs", Fn: builtinAbs},
+		&Builtin{Name: "piso", Fn: builtinFloor},
+		&Builtin{Name: "techo", Fn: builtinCeil},
+		&Builtin{Name: "redondear", Fn: builtinRound},
+		&Builtin{Name: "min", Fn: func(args []interface{}) (interface{}, error) { return extreme("min", args, -1) }},
+		&Builtin{Name: "max", Fn: func(args []interface{}) (interface{}, error) { return extreme("max", args, 1) }},
+		&Builtin{Name: "log", Fn: builtinLog},
+		trig("sen", math.Sin, nil),
+		trig("cos", math.Cos, nil),
+		trig("tan", math.Tan, nil),
+		trig("asen", math.Asin, unitInterval),
+		trig("acos", math.Acos, unitInterval),
+		trig("atan", math.Atan, nil),
+		&Builtin{Name: "aleatorio", Stateful: builtinRandom},
+		&Builtin{Name: "semilla", Stateful: builtinSeed},
+	)
+	constants["PI"] = math.Pi
+	constants["E"] = math.E
+}
+
+// checkArgs comprueba que una función reciba exactamente n argumentos
+func checkArgs(name string, args []interface{}, n int) error {
+	if len(args) == n {
+		return nil
+	}
+	if n == 1 {
+		return errorf(ErrArgumentCount, "%s() espera 1 argumento, pero recibió %d", name, len(args))
+	}
+	return errorf(ErrArgumentCount, "%s() espera %d argumentos, pero recibió %d", name, n, len(args))
+}
+
+// numberArg convierte un argumento numérico en decimal
+func numberArg(name string, value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, errorf(ErrTypeMismatch, "%s() espera un número, pero recibió un valor de tipo %s", name, typeName(value))
+	}
+}
+
+// intArg exige un argumento entero
+func intArg(name string, value interface{}) (int64, error) {
+	if v, ok := value.(int64); ok {
+		return v, nil
+	}
+	return 0, errorf(ErrTypeMismatch, "%s() espera un entero, pero recibió un valor de tipo %s", name, typeName(value))
+}
+
+// floatToInt convierte un decimal ya redondeado en entero, si cabe
+func floatToInt(name string, f float64) (interface{}, error) {
+	if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return nil, errorf(ErrOverflow, "%s(): el resultado %v no cabe en un entero", name, f)
+	}
+	return int64(f), nil
+}
+
+func builtinSqrt(args []interface{}) (interface{}, error) {
+	if err := checkArgs("raiz", args, 1); err != nil {
+		return nil, err
+	}
+	x, err := numberArg("raiz", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if x < 0 {
+		return nil, errorf(ErrDomain, "raiz() no está definida para números negativos (recibió %s)", inspect(args[0]))
+	}
+	return math.Sqrt(x), nil
+}
+
+// builtinPow eleva un número a otro. Entre enteros con exponente no
+// negativo el resultado es un entero exacto.
+func builtinPow(args []interface{}) (interface{}, error) {
+	if err := checkArgs("potencia", args, 2); err != nil {
+		return nil, err
+	}
+	base, baseIsInt := args[0].(int64)
+	exp, expIsInt := args[1].(int64)
+	if baseIsInt && expIsInt && exp >= 0 {
+		result, ok := intPow(base, exp)
+		if !ok {
+			return nil, errorf(ErrOverflow, "potencia(): el resultado de %d elevado a %d no cabe en un entero", base, exp)
+		}
+		return result, nil
+	}
+
+	b, err := numberArg("potencia", args[0])
+	if err != nil {
+		return nil, err
+	}
+	e, err := numberArg("potencia", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if b == 0 && e < 0 {
+		return nil, errorf(ErrDomain, "potencia(): 0 no se puede elevar a un exponente negativo")
+	}
+	result := math.Pow(b, e)
+	if math.IsNaN(result) {
+		return nil, errorf(ErrDomain, "potencia(): un número negativo no se puede elevar a un exponente no entero")
+	}
+	return result, nil
+}
+
+// intPow calcula base^exp por cuadrados sucesivos. ok es falso si el
+// resultado se desborda.
+func intPow(base, exp int64) (result int64, ok bool) {
+	result = 1
+	for exp > 0 {
+		if exp&1 == 1 {
+			if result, ok = mulInt(result, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		if exp > 0 {
+			if base, ok = mulInt(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return result, true
+}
+
+func mulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	return c, true
+}
+
+func builtinAbs(args []interface{}) (interface{}, error) {
+	if err := checkArgs("abs", args, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case int64:
+		if v == math.MinInt64 {
+			return nil, errorf(ErrOverflow, "abs(): el resultado no cabe en un entero")
+		}
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	default:
+		x, err := numberArg("abs", v)
+		if err != nil {
+			return nil, err
+		}
+		return math.Abs(x), nil
+	}
+}
+
+func builtinFloor(args []interface{}) (interface{}, error) {
+	return rounding("piso", args, math.Floor)
+}
+
+func builtinCeil(args []interface{}) (interface{}, error) {
+	return rounding("techo", args, math.Ceil)
+}
+
+// rounding aplica una función de redondeo y devuelve un entero
+func rounding(name string, args []interface{}, round func(float64) float64) (interface{}, error) {
+	if err := checkArgs(name, args, 1); err != nil {
+		return nil, err
+	}
+	if v, ok := args[0].(int64); ok {
+		return v, nil
+	}
+	x, err := numberArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return floatToInt(name, round(x))
+}
+
+// builtinRound redondea al entero más cercano (los medios, lejos del cero).
+// Con un segundo argumento redondea a ese número de decimales y el
+// resultado sigue siendo decimal; si es negativo, redondea a decenas,
+// centenas...
+func builtinRound(args []interface{}) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errorf(ErrArgumentCount, "redondear() espera 1 o 2 argumentos, pero recibió %d", len(args))
+	}
+	if len(args) == 1 {
+		return rounding("redondear", args, math.Round)
+	}
+
+	x, err := numberArg("redondear", args[0])
+	if err != nil {
+		return nil, err
+	}
+	digits, err := intArg("redondear", args[1])
+	if err != nil {
+		return nil, err
+	}
+	scale := math.Pow(10, float64(digits))
+	rounded := math.Round(x*scale) / scale
+	if _, isInt := args[0].(int64); isInt {
+		return floatToInt("redondear", rounded)
+	}
+	return rounded, nil
+}
+
+// extreme devuelve el menor (sign -1) o el mayor (sign 1) de sus
+// argumentos, o de los elementos de una lista si recibe solo una
+func extreme(name string, args []interface{}, sign int) (interface{}, error) {
+	values := args
+	if len(args) == 1 {
+		if list, ok := args[0].(*List); ok {
+			values = list.Elements
+			if len(values) == 0 {
+				return nil, errorf(ErrInvalidArgument, "%s() recibió una lista vacía", name)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil, errorf(ErrArgumentCount, "%s() espera al menos 1 argumento, pero recibió 0", name)
+	}
+
+	best := values[0]
+	for _, value := range values[1:] {
+		cmp, ok := compare(value, best)
+		if !ok {
+			return nil, errorf(ErrTypeMismatch, "%s() no puede comparar un valor de tipo %s con uno de tipo %s", name, typeName(value), typeName(best))
+		}
+		if cmp*sign > 0 {
+			best = value
+		}
+	}
+	if _, ok := compare(best, best); !ok {
+		return nil, errorf(ErrTypeMismatch, "%s() no admite un valor de tipo %s", name, typeName(best))
+	}
+	return best, nil
+}
+
+// builtinLog calcula el logaritmo natural o, con un segundo argumento, en
+// esa base
+func builtinLog(args []interface{}) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errorf(ErrArgumentCount, "log() espera 1 o 2 argumentos, pero recibió %d", len(args))
+	}
+	x, err := numberArg("log", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if x <= 0 {
+		return nil, errorf(ErrDomain, "log() solo está definido para números positivos (recibió %s)", inspect(args[0]))
+	}
+	if len(args) == 1 {
+		return math.Log(x), nil
+	}
+	base, err := numberArg("log", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if base <= 0 || base == 1 {
+		return nil, errorf(ErrDomain, "log(): la base debe ser positiva y distinta de 1 (recibió %s)", inspect(args[1]))
+	}
+	return math.Log(x) / math.Log(base), nil
+}
+
+// trig crea una función trigonométrica de un argumento (en radianes).
+// domain, si no es nil, devuelve un error para los argumentos no válidos.
+func trig(name string, fn func(float64) float64, domain func(name string, x float64) error) *Builtin {
+	return &Builtin{Name: name, Fn: func(args []interface{}) (interface{}, error) {
+		if err := checkArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		x, err := numberArg(name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if domain != nil {
+			if err := domain(name, x); err != nil {
+				return nil, err
+			}
+		}
+		return fn(x), nil
+	}}
+}
+
+func unitInterval(name string, x float64) error {
+	if x < -1 || x > 1 {
+		return errorf(ErrDomain, "%s() solo está definida entre -1 y 1 (recibió %v)", name, x)
+	}
+	return nil
+}
+
+// builtinRandom devuelve un decimal entre 0 y 1 sin argumentos, un entero
+// entre 0 y n-1 con uno, o un entero entre a y b (ambos incluidos) con dos
+func builtinRandom(rt *Runtime, args []interface{}) (interface{}, error) {
+	switch len(args) {
+	case 0:
+		return rt.rand.Float64(), nil
+	case 1:
+		n, err := intArg("aleatorio", args[0])
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return nil, errorf(ErrInvalidArgument, "aleatorio() espera un límite positivo, pero recibió %d", n)
+		}
+		return rt.rand.Int63n(n), nil
+	case 2:
+		from, err := intArg("aleatorio", args[0])
+		if err != nil {
+			return nil, err
+		}
+		to, err := intArg("aleatorio", args[1])
+		if err != nil {
+			return nil, err
+		}
+		if from > to {
+			return nil, errorf(ErrInvalidArgument, "aleatorio(): el mínimo %d es mayor que el máximo %d", from, to)
+		}
+		span := uint64(to-from) + 1
+		switch {
+		case span == 0:
+			// El intervalo abarca todos los enteros: cualquiera vale
+			return int64(rt.rand.Uint64()), nil
+		case span > math.MaxInt64:
+			// Int63n no llega a tanto: se descartan los números fuera del
+			// intervalo, que son menos de la mitad
+			for {
+				if v := int64(rt.rand.Uint64()); from <= v && v <= to {
+					return v, nil
+				}
+			}
+		default:
+			return from + rt.rand.Int63n(int64(span)), nil
+		}
+	default:
+		return nil, errorf(ErrArgumentCount, "aleatorio() espera como mucho 2 argumentos, pero recibió %d", len(args))
+	}
+}
+
+// builtinSeed reinicia el generador de 'aleatorio' para que la secuencia de
+// números se repita
+func builtinSeed(rt *Runtime, args []interface{}) (interface{}, error) {
+	if err := checkArgs("semilla", args, 1); err != nil {
+		return nil, err
+	}
+	seed, err := intArg("semilla", args[0])
+	if err != nil {
+		return nil, err
+	}
+	rt.rand.Seed(seed)
+	return nil, nil
+}
@@ -0,0 +1,53 @@
+package evaluator
+
+// Operaciones sobre los valores de Flux para otros motores de ejecución
+// (la máquina virtual de flux/vm). Son las mismas que usa el evaluador, así
+// que ambos motores dan los mismos resultados y los mismos errores.
+
+// Add, Subtract, Multiply, Divide y Modulo aplican un operador aritmético.
+// Devuelven nil si los tipos no son compatibles.
+func Add(left, right interface{}) interface{}      { return add(left, right) }
+func Subtract(left, right interface{}) interface{} { return subtract(left, right) }
+func Multiply(left, right interface{}) interface{} { return multiply(left, right) }
+func Divide(left, right interface{}) interface{}   { return divide(left, right) }
+func Modulo(left, right interface{}) interface{}   { return modulo(left, right) }
+
+// IsZero indica si un valor es el número cero (divisor no válido)
+func IsZero(value interface{}) bool { return isZero(value) }
+
+// Compare ordena dos números o dos cadenas; ok es falso si no se pueden comparar
+func Compare(left, right interface{}) (cmp int, ok bool) { return compare(left, right) }
+
+// Equal compara dos valores como '=='
+func Equal(left, right interface{}) bool { return valuesEqual(left, right) }
+
+// Truthy indica si un valor cuenta como verdadero en una condición
+func Truthy(value interface{}) bool { return isTruthy(value) }
+
+// InspectElement es como Inspect pero con las cadenas entre comillas
+func InspectElement(value interface{}) string { return inspectElement(value) }
+
+// ResolveIndex convierte un índice de Flux (negativo para contar desde el
+// final) en una posición de la lista, o devuelve un error sin posición
+func (l *List) ResolveIndex(index interface{}) (int, error) { return l.resolveIndex(index) }
+
+// StringIndex devuelve el carácter de una cadena en un índice de Flux, o un
+// error sin posición
+func StringIndex(s string, index interface{}) (string, error) { return stringIndex(s, index) }
+
+// CheckDictKey devuelve un error sin posición si el valor no puede ser clave
+func CheckDictKey(key interface{}) error { return checkDictKey(key) }
+
+// LookupBuiltin busca una función predefinida (sin las constantes, ver
+// Predefined)
+func LookupBuiltin(name string) (*Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// ErrorValue es el diccionario que recibe la variable de 'capturar'
+func ErrorValue(r *RuntimeError) *Dict { return errorValue(r) }
+
+// ErrorFromValue reconstruye el error capturado que 'lanzar' vuelve a
+// lanzar, o devuelve nil si el valor no es un error capturado
+func ErrorFromValue(value interface{}) *RuntimeError { return errorFromValue(value) }
@@ -0,0 +1,68 @@
+package evaluator
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Runtime es el estado de un programa en ejecución que usan algunas
+// funciones predefinidas: su entrada y su salida ('mostrar' escribe en ella
+// y 'leer' lee de ella) y su generador de números aleatorios. Cada
+// evaluador (o máquina virtual) tiene el suyo para que quien lo usa decida
+// de dónde sale y adónde va el texto.
+type Runtime struct {
+	in      *bufio.Reader
+	out     io.Writer
+	rand    *rand.Rand
+	maxSize int // Tamaño máximo de los valores que crea el programa (ver WithMaxSize); 0 si no hay
+	call    func(fn interface{}, args []interface{}) (interface{}, error)
+}
+
+// NewRuntime crea el estado de un programa que lee de in y escribe en out.
+// Los números aleatorios salen de seed, o de la hora actual si es nil.
+func NewRuntime(in io.Reader, out io.Writer, seed *int64) *Runtime {
+	s := time.Now().UnixNano()
+	if seed != nil {
+		s = *seed
+	}
+	return &Runtime{in: bufio.NewReader(in), out: out, rand: rand.New(rand.NewSource(s))}
+}
+
+// Call llama a una función de Flux desde una función predefinida, como
+// Evaluator.Call, por ejemplo cuando el programa se la pasa como argumento.
+// Solo el evaluador de árbol lo permite.
+func (rt *Runtime) Call(fn interface{}, args []interface{}) (interface{}, error) {
+	if rt.call == nil {
+		return nil, errorf(ErrInternal, "este motor no permite llamar a funciones de Flux desde una función predefinida")
+	}
+	return rt.call(fn, args)
+}
+
+// checkSize comprueba, antes de crearla, que una cadena de size caracteres
+// no supere el tamaño máximo. Las funciones que pueden crear cadenas muy
+// grandes a partir de argumentos pequeños lo usan para no reservar la
+// memoria antes de que el evaluador compruebe el resultado.
+func (rt *Runtime) checkSize(name string, size int64) error {
+	if rt.maxSize > 0 && size > int64(rt.maxSize) {
+		return errorf(ErrSizeLimit, "%s(): una cadena de %d caracteres supera el tamaño máximo de %d", name, size, rt.maxSize)
+	}
+	return nil
+}
+
+// WithInput hace que 'leer' y las demás funciones de entrada lean de r en
+// lugar de la entrada estándar
+func WithInput(r io.Reader) Option {
+	return func(e *Evaluator) {
+		e.in = r
+	}
+}
+
+// WithSeed fija la semilla de 'aleatorio' para que cada ejecución dé los
+// mismos números
+func WithSeed(seed int64) Option {
+	return func(e *Evaluator) {
+		e.seed = &seed
+	}
+}
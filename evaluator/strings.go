@@ -0,0 +1,256 @@
+package evaluator
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Funciones de cadenas. Las posiciones y longitudes cuentan caracteres, no
+// bytes, así que "canción" tiene 7 y subcadena("canción", 4) es "ión".
+func init() {
+	register(
+		&Builtin{Name: "mayusculas", Fn: builtinUpper},
+		&Builtin{Name: "minusculas", Fn: builtinLower},
+		&Builtin{Name: "recortar", Fn: builtinTrim},
+		&Builtin{Name: "subcadena", Fn: builtinSubstring},
+		&Builtin{Name: "dividir", Fn: builtinSplit},
+		&Builtin{Name: "unir", Stateful: builtinJoin},
+		&Builtin{Name: "reemplazar", Fn: builtinReplace},
+		&Builtin{Name: "contiene", Fn: builtinContains},
+		&Builtin{Name: "empieza_con", Fn: builtinHasPrefix},
+		&Builtin{Name: "repetir_cadena", Stateful: builtinRepeat},
+	)
+}
+
+// stringArg exige un argumento de tipo cadena
+func stringArg(name string, value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return "", errorf(ErrTypeMismatch, "%s() espera una cadena, pero recibió un valor de tipo %s", name, typeName(value))
+}
+
+// stringArgs comprueba que una función reciba n cadenas y las devuelve
+func stringArgs(name string, args []interface{}, n int) ([]string, error) {
+	if err := checkArgs(name, args, n); err != nil {
+		return nil, err
+	}
+	strs := make([]string, n)
+	for i, arg := range args {
+		s, err := stringArg(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+func builtinUpper(args []interface{}) (interface{}, error) {
+	strs, err := stringArgs("mayusculas", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(strs[0]), nil
+}
+
+func builtinLower(args []interface{}) (interface{}, error) {
+	strs, err := stringArgs("minusculas", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToLower(strs[0]), nil
+}
+
+// builtinTrim quita los espacios, tabuladores y saltos de línea de los
+// extremos
+func builtinTrim(args []interface{}) (interface{}, error) {
+	strs, err := stringArgs("recortar", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return strings.TrimSpace(strs[0]), nil
+}
+
+// builtinSubstring devuelve los caracteres desde la posición 'desde'
+// (incluida) hasta 'hasta' (excluida) o hasta el final. Las posiciones
+// negativas cuentan desde el final, como en los índices de las listas.
+func builtinSubstring(args []interface{}) (interface{}, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errorf(ErrArgumentCount, "subcadena() espera 2 o 3 argumentos, pero recibió %d", len(args))
+	}
+	s, err := stringArg("subcadena", args[0])
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+	from, err := substringBound(args[1], len(runes))
+	if err != nil {
+		return nil, err
+	}
+	to := len(runes)
+	if len(args) == 3 {
+		if to, err = substringBound(args[2], len(runes)); err != nil {
+			return nil, err
+		}
+	}
+	if from >= to {
+		return "", nil
+	}
+	return string(runes[from:to]), nil
+}
+
+// substringBound convierte un extremo de subcadena en una posición entre 0
+// y length, ambos incluidos
+func substringBound(value interface{}, length int) (int, error) {
+	i, err := intArg("subcadena", value)
+	if err != nil {
+		return 0, err
+	}
+	pos := i
+	if pos < 0 {
+		pos += int64(length)
+	}
+	if pos < 0 || pos > int64(length) {
+		return 0, errorf(ErrIndexOutOfRange, "subcadena(): la posición %d está fuera de rango (la cadena tiene %d caracteres)", i, length)
+	}
+	return int(pos), nil
+}
+
+// builtinSplit divide una cadena por un separador. Sin separador la divide
+// por los espacios en blanco, y con el separador "" en caracteres sueltos.
+func builtinSplit(args []interface{}) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errorf(ErrArgumentCount, "dividir() espera 1 o 2 argumentos, pero recibió %d", len(args))
+	}
+	strs, err := stringArgs("dividir", args, len(args))
+	if err != nil {
+		return nil, err
+	}
+	var parts []string
+	if len(strs) == 1 {
+		parts = strings.Fields(strs[0])
+	} else {
+		parts = strings.Split(strs[0], strs[1])
+	}
+	elements := make([]interface{}, len(parts))
+	for i, part := range parts {
+		elements[i] = part
+	}
+	return &List{Elements: elements}, nil
+}
+
+// builtinJoin une los elementos de una lista en una cadena, con el
+// separador entre ellos. Los elementos que no son cadenas se escriben como
+// los mostraría 'mostrar'.
+func builtinJoin(rt *Runtime, args []interface{}) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errorf(ErrArgumentCount, "unir() espera 1 o 2 argumentos, pero recibió %d", len(args))
+	}
+	list, ok := args[0].(*List)
+	if !ok {
+		return nil, errorf(ErrTypeMismatch, "unir() espera una lista, pero recibió un valor de tipo %s", typeName(args[0]))
+	}
+	separator := ""
+	if len(args) == 2 {
+		var err error
+		if separator, err = stringArg("unir", args[1]); err != nil {
+			return nil, err
+		}
+	}
+	if rt.maxSize > 0 {
+		// Se mide antes de unir: los elementos pueden ser listas enormes
+		m := newMeasurer(int64(rt.maxSize))
+		separatorLength := int64(utf8.RuneCountInString(separator))
+		size := int64(0)
+		for i, el := range list.Elements {
+			if i > 0 {
+				size = addLength(size, separatorLength)
+			}
+			if size = addLength(size, m.length(el)); size > int64(rt.maxSize) {
+				return nil, errorf(ErrSizeLimit, "unir(): la cadena resultante supera el tamaño máximo de %d caracteres", rt.maxSize)
+			}
+		}
+	}
+	parts := make([]string, len(list.Elements))
+	for i, el := range list.Elements {
+		parts[i] = inspect(el)
+	}
+	return strings.Join(parts, separator), nil
+}
+
+// builtinReplace reemplaza todas las apariciones de una cadena por otra
+func builtinReplace(args []interface{}) (interface{}, error) {
+	strs, err := stringArgs("reemplazar", args, 3)
+	if err != nil {
+		return nil, err
+	}
+	if strs[1] == "" {
+		return nil, errorf(ErrInvalidArgument, "reemplazar() no puede buscar una cadena vacía")
+	}
+	return strings.ReplaceAll(strs[0], strs[1], strs[2]), nil
+}
+
+// builtinContains indica si una cadena contiene otra o si una lista
+// contiene un valor
+func builtinContains(args []interface{}) (interface{}, error) {
+	if err := checkArgs("contiene", args, 2); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case string:
+		part, err := stringArg("contiene", args[1])
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(v, part), nil
+	case *List:
+		for _, el := range v.Elements {
+			if valuesEqual(el, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return nil, errorf(ErrTypeMismatch, "contiene() espera una cadena o una lista, pero recibió un valor de tipo %s", typeName(args[0]))
+	}
+}
+
+func builtinHasPrefix(args []interface{}) (interface{}, error) {
+	strs, err := stringArgs("empieza_con", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return strings.HasPrefix(strs[0], strs[1]), nil
+}
+
+// builtinRepeat repite una cadena. El tamaño del resultado se comprueba
+// antes de crearlo: repetir una cadena corta muchas veces no debe reservar
+// memoria que el límite de tamaño no permite.
+func builtinRepeat(rt *Runtime, args []interface{}) (interface{}, error) {
+	if err := checkArgs("repetir_cadena", args, 2); err != nil {
+		return nil, err
+	}
+	s, err := stringArg("repetir_cadena", args[0])
+	if err != nil {
+		return nil, err
+	}
+	n, err := intArg("repetir_cadena", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, errorf(ErrInvalidArgument, "repetir_cadena() espera un número de veces no negativo, pero recibió %d", n)
+	}
+	if s == "" || n == 0 {
+		return "", nil
+	}
+	if n > math.MaxInt32/int64(len(s)) {
+		return nil, errorf(ErrOverflow, "repetir_cadena(): el resultado sería demasiado largo")
+	}
+	if err := rt.checkSize("repetir_cadena", int64(utf8.RuneCountInString(s))*n); err != nil {
+		return nil, err
+	}
+	return strings.Repeat(s, int(n)), nil
+}
@@ -0,0 +1,419 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// List es el valor de una lista de Flux. Se maneja por referencia:
+// asignar una lista a otra variable no la copia.
+type List struct {
+	Elements []interface{}
+}
+
+func (l *List) String() string {
+	var sb strings.Builder
+	writeValue(&sb, l, false, make(map[interface{}]bool))
+	return sb.String()
+}
+
+// resolveIndex convierte un índice de Flux (que puede ser negativo para
+// contar desde el final) en una posición válida de la lista
+func (l *List) resolveIndex(index interface{}) (int, error) {
+	i, ok := index.(int64)
+	if !ok {
+		return 0, errorf(ErrTypeMismatch, "el índice de una lista debe ser un entero, no %s", typeName(index))
+	}
+	length := int64(len(l.Elements))
+	pos := i
+	if pos < 0 {
+		pos += length
+	}
+	if pos < 0 || pos >= length {
+		return 0, errorf(ErrIndexOutOfRange, "índice %d fuera de rango (la lista tiene %d elementos)", i, length)
+	}
+	return int(pos), nil
+}
+
+// stringIndex devuelve el carácter de una cadena en un índice de Flux. Las
+// posiciones cuentan caracteres, no bytes, para que "canción"[5] sea "ó".
+func stringIndex(s string, index interface{}) (string, error) {
+	i, ok := index.(int64)
+	if !ok {
+		return "", errorf(ErrTypeMismatch, "el índice de una cadena debe ser un entero, no %s", typeName(index))
+	}
+	runes := []rune(s)
+	length := int64(len(runes))
+	pos := i
+	if pos < 0 {
+		pos += length
+	}
+	if pos < 0 || pos >= length {
+		return "", errorf(ErrIndexOutOfRange, "índice %d fuera de rango (la cadena tiene %d caracteres)", i, length)
+	}
+	return string(runes[pos]), nil
+}
+
+// Dict es el valor de un diccionario de Flux. Conserva el orden de
+// inserción de las claves para que recorrerlo sea determinista.
+type Dict struct {
+	keys   []interface{}
+	values map[interface{}]interface{}
+}
+
+func NewDict() *Dict {
+	return &Dict{values: make(map[interface{}]interface{})}
+}
+
+func (d *Dict) Get(key interface{}) (interface{}, bool) {
+	val, ok := d.values[key]
+	return val, ok
+}
+
+// Set añade o actualiza una clave; las claves nuevas van al final
+func (d *Dict) Set(key, value interface{}) {
+	if _, ok := d.values[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.values[key] = value
+}
+
+func (d *Dict) Len() int {
+	return len(d.keys)
+}
+
+// Keys devuelve las claves en orden de inserción
+func (d *Dict) Keys() []interface{} {
+	keys := make([]interface{}, len(d.keys))
+	copy(keys, d.keys)
+	return keys
+}
+
+// Values devuelve los valores en el orden de sus claves
+func (d *Dict) Values() []interface{} {
+	values := make([]interface{}, len(d.keys))
+	for i, key := range d.keys {
+		values[i] = d.values[key]
+	}
+	return values
+}
+
+func (d *Dict) String() string {
+	var sb strings.Builder
+	writeValue(&sb, d, false, make(map[interface{}]bool))
+	return sb.String()
+}
+
+// writeValue escribe un valor como lo muestra 'mostrar'; quoted pone las
+// cadenas entre comillas. seen son las colecciones que se están escribiendo:
+// una lista que se contiene a sí misma se muestra como [...] la segunda vez,
+// y un diccionario, como {...}.
+func writeValue(sb *strings.Builder, value interface{}, quoted bool, seen map[interface{}]bool) {
+	switch v := value.(type) {
+	case *List:
+		if seen[v] {
+			sb.WriteString("[...]")
+			return
+		}
+		seen[v] = true
+		sb.WriteString("[")
+		for i, el := range v.Elements {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeValue(sb, el, true, seen)
+		}
+		sb.WriteString("]")
+		delete(seen, v)
+	case *Dict:
+		if seen[v] {
+			sb.WriteString("{...}")
+			return
+		}
+		seen[v] = true
+		sb.WriteString("{")
+		for i, key := range v.keys {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeValue(sb, key, true, seen)
+			sb.WriteString(": ")
+			writeValue(sb, v.values[key], true, seen)
+		}
+		sb.WriteString("}")
+		delete(seen, v)
+	default:
+		if quoted {
+			sb.WriteString(inspectElement(v))
+		} else {
+			sb.WriteString(inspect(v))
+		}
+	}
+}
+
+// measurer calcula cuántos caracteres tiene inspect(value) sin crear el
+// texto, para comprobar el tamaño máximo antes de reservar la memoria. Deja
+// de medir en cuanto pasa de limit, así que medir una lista con millones de
+// copias de otra no cuesta más que escribir limit caracteres. seen son las
+// colecciones que se están midiendo, como en writeValue; sizes, lo que mide
+// cada colección ya medida.
+type measurer struct {
+	limit int64
+	seen  map[interface{}]bool
+	sizes map[interface{}]int64
+}
+
+func newMeasurer(limit int64) *measurer {
+	return &measurer{limit: limit, seen: make(map[interface{}]bool), sizes: make(map[interface{}]int64)}
+}
+
+// length devuelve lo que mide inspect(value), o algo mayor que el límite si
+// lo supera
+func (m *measurer) length(value interface{}) int64 {
+	size, _ := m.measure(value, false)
+	return size
+}
+
+// measure devuelve lo que mide value y si contiene alguna colección que ya
+// se estaba midiendo. Lo que mide esa parte ([...] o {...}) depende de
+// dónde esté, así que esas colecciones no se guardan en sizes.
+func (m *measurer) measure(value interface{}, quoted bool) (int64, bool) {
+	switch v := value.(type) {
+	case *List, *Dict:
+		if m.seen[v] {
+			return 5, true // [...] o {...}
+		}
+		if size, ok := m.sizes[v]; ok {
+			return size, false
+		}
+		m.seen[v] = true
+		size, cyclic := m.collection(v)
+		delete(m.seen, v)
+		if !cyclic {
+			m.sizes[v] = size
+		}
+		return size, cyclic
+	case string:
+		if quoted {
+			return quotedLength(v), false
+		}
+		return int64(utf8.RuneCountInString(v)), false
+	default:
+		return int64(utf8.RuneCountInString(inspect(v))), false
+	}
+}
+
+// collection mide una lista o un diccionario con sus corchetes o llaves y
+// separadores, como los escribe writeValue
+func (m *measurer) collection(value interface{}) (int64, bool) {
+	size := int64(2) // [] o {}
+	cyclic := false
+	add := func(part interface{}) {
+		n, c := m.measure(part, true)
+		size = addLength(size, n)
+		cyclic = cyclic || c
+	}
+	switch v := value.(type) {
+	case *List:
+		for i, el := range v.Elements {
+			if size > m.limit {
+				break
+			}
+			if i > 0 {
+				size = addLength(size, 2) // ", "
+			}
+			add(el)
+		}
+	case *Dict:
+		for i, key := range v.keys {
+			if size > m.limit {
+				break
+			}
+			if i > 0 {
+				size = addLength(size, 2)
+			}
+			add(key)
+			size = addLength(size, 2) // ": "
+			add(v.values[key])
+		}
+	}
+	return size, cyclic
+}
+
+// addLength suma dos tamaños sin desbordarse
+func addLength(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+// quotedLength devuelve cuántos caracteres tiene strconv.Quote(s) sin crear
+// la cadena
+func quotedLength(s string) int64 {
+	size := int64(2)
+	for i := 0; i < len(s); {
+		r, width := utf8.DecodeRuneInString(s[i:])
+		i += width
+		switch {
+		case width == 1 && r == utf8.RuneError:
+			size += 4 // \xff
+		case r == '"' || r == '\\':
+			size += 2
+		case strconv.IsPrint(r):
+			size++
+		case r == '\a' || r == '\b' || r == '\f' || r == '\n' || r == '\r' || r == '\t' || r == '\v':
+			size += 2
+		case r < ' ' || r == 0x7f:
+			size += 4 // \x1b
+		case r < 0x10000:
+			size += 6 // \u00ad
+		default:
+			size += 10 // \U000e0001
+		}
+	}
+	return size
+}
+
+// isHashable indica si un valor puede ser clave de un diccionario
+func isHashable(value interface{}) bool {
+	switch value.(type) {
+	case string, int64, float64, bool:
+		return true
+	default:
+		return false
+	}
+}
+
+func checkDictKey(key interface{}) error {
+	if !isHashable(key) {
+		return errorf(ErrTypeMismatch, "no se puede usar un valor de tipo %s como clave de un diccionario", typeName(key))
+	}
+	return nil
+}
+
+// Inspect devuelve el texto con el que 'mostrar' muestra un valor
+func Inspect(value interface{}) string {
+	return inspect(value)
+}
+
+// TypeName devuelve el nombre del tipo de un valor tal como lo ve el usuario
+// ("entero", "lista"...)
+func TypeName(value interface{}) string {
+	return typeName(value)
+}
+
+// inspect convierte un valor en el texto que muestra 'mostrar'
+func inspect(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nulo"
+	case string:
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// inspectElement es como inspect pero muestra las cadenas entre comillas,
+// para que se distingan dentro de una colección
+func inspectElement(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return inspect(value)
+}
+
+// TypedValue es un valor creado fuera del evaluador (como las funciones
+// compiladas de flux/vm) que indica su nombre de tipo
+type TypedValue interface {
+	TypeName() string
+}
+
+// typeName devuelve el nombre del tipo de un valor tal como lo ve el usuario
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "nulo"
+	case int64:
+		return "entero"
+	case float64:
+		return "decimal"
+	case string:
+		return "cadena"
+	case bool:
+		return "booleano"
+	case *List:
+		return "lista"
+	case *Dict:
+		return "diccionario"
+	case *Function, *Builtin:
+		return "función"
+	case TypedValue:
+		return value.(TypedValue).TypeName()
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// valuesEqual compara dos valores; las listas y los diccionarios se
+// comparan elemento a elemento
+func valuesEqual(left, right interface{}) bool {
+	return equalValues(left, right, make(map[[2]interface{}]bool))
+}
+
+// equalValues compara dos valores. comparing son los pares de colecciones
+// que se están comparando: si un par vuelve a aparecer es porque las dos
+// colecciones se contienen a sí mismas de la misma forma, y ese par se da
+// por igual para no entrar en un ciclo infinito.
+func equalValues(left, right interface{}, comparing map[[2]interface{}]bool) bool {
+	l, lok := left.(*List)
+	r, rok := right.(*List)
+	if lok && rok {
+		if l == r {
+			return true
+		}
+		if len(l.Elements) != len(r.Elements) {
+			return false
+		}
+		pair := [2]interface{}{l, r}
+		if comparing[pair] {
+			return true
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+		for i := range l.Elements {
+			if !equalValues(l.Elements[i], r.Elements[i], comparing) {
+				return false
+			}
+		}
+		return true
+	}
+	ld, lok := left.(*Dict)
+	rd, rok := right.(*Dict)
+	if lok && rok {
+		if ld == rd {
+			return true
+		}
+		if ld.Len() != rd.Len() {
+			return false
+		}
+		pair := [2]interface{}{ld, rd}
+		if comparing[pair] {
+			return true
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+		for _, key := range ld.keys {
+			rv, ok := rd.Get(key)
+			if !ok || !equalValues(ld.values[key], rv, comparing) {
+				return false
+			}
+		}
+		return true
+	}
+	return left == right
+}
@@ -0,0 +1,154 @@
+// Package formatter escribe programas de Flux en su forma canónica: cuatro
+// espacios de sangría, un espacio alrededor de los operadores binarios,
+// operadores ASCII ('=' en lugar de '→', '==' en lugar de '↔'...), 'mostrar'
+// con paréntesis y como mucho una línea en blanco entre sentencias. Los
+// comentarios se conservan. Formatear un programa ya formateado no lo cambia.
+package formatter
+
+import (
+	"flux/ast"
+	"flux/lexer"
+	"flux/parser"
+	"sort"
+	"strings"
+)
+
+const indentUnit = "    "
+
+// Format devuelve el código formateado. Si el programa tiene errores léxicos
+// o sintácticos no se formatea y se devuelven los diagnósticos como error
+// (una diagnostic.List).
+func Format(source string) (string, error) {
+	l := lexer.New(source)
+	tokens, _ := l.Tokenize()
+	par := parser.New(tokens)
+	program, _ := par.Parse()
+	diagnostics := append(l.Diagnostics(), par.Errors()...)
+	if diagnostics.HasErrors() {
+		diagnostics.Sort()
+		return "", diagnostics
+	}
+
+	p := &printer{source: source, tokens: tokens, comments: l.Comments()}
+	p.statements(program.Statements, len(source))
+	p.flushComments(len(source) + 1)
+	return p.result(), nil
+}
+
+// printer escribe el programa formateado. Los comentarios se intercalan
+// según su posición en el código original: antes de la sentencia que los
+// sigue o al final de la línea en la que aparecen.
+type printer struct {
+	source   string
+	tokens   []lexer.Token
+	comments []lexer.Comment
+	next     int // Índice del siguiente comentario por escribir
+
+	buf         strings.Builder
+	indent      int
+	atLineStart bool
+	lastLine    int // Última línea del código original ya escrita; 0 al empezar un bloque
+}
+
+// write escribe texto, sangrando la línea si es el principio de una
+func (p *printer) write(text string) {
+	if p.atLineStart && text != "" {
+		p.buf.WriteString(strings.Repeat(indentUnit, p.indent))
+		p.atLineStart = false
+	}
+	p.buf.WriteString(text)
+}
+
+func (p *printer) newline() {
+	p.buf.WriteString("\n")
+	p.atLineStart = true
+}
+
+// separate deja una línea en blanco si en el código original había al menos
+// una entre lo último escrito y lo que empieza en line
+func (p *printer) separate(line int) {
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.newline()
+	}
+}
+
+// flushComments escribe en líneas propias los comentarios pendientes que
+// empiezan antes de offset
+func (p *printer) flushComments(offset int) {
+	for p.next < len(p.comments) && p.comments[p.next].Offset < offset {
+		c := p.comments[p.next]
+		p.next++
+		if !p.atLineStart {
+			p.newline()
+		}
+		p.separate(c.Line)
+		p.write(c.Text)
+		p.newline()
+		p.lastLine = c.EndLine
+	}
+}
+
+// lineComments añade al final de la línea actual los comentarios pendientes
+// que en el código original estaban en la línea line
+func (p *printer) lineComments(line int) {
+	for p.next < len(p.comments) && p.comments[p.next].Line == line {
+		p.write(" " + p.comments[p.next].Text)
+		p.next++
+	}
+}
+
+// endStatement termina la línea de una sentencia que acaba en end. Los
+// comentarios de su última línea quedan al final de la línea; los que
+// estaban entre sus partes pasan a las líneas siguientes.
+func (p *printer) endStatement(end ast.Position) {
+	for p.next < len(p.comments) && p.comments[p.next].Offset < end.Offset {
+		c := p.comments[p.next]
+		if c.Line == end.Line {
+			break
+		}
+		p.next++
+		p.newline()
+		p.write(c.Text)
+	}
+	p.lineComments(end.Line)
+	p.newline()
+	p.lastLine = end.Line
+}
+
+// tokenAfter devuelve el primer token del tipo dado que empieza en offset o
+// después. Sirve para encontrar 'sino', 'capturar', 'fin'... que el árbol no
+// guarda.
+func (p *printer) tokenAfter(offset int, tokType lexer.TokenType) lexer.Token {
+	i := sort.Search(len(p.tokens), func(i int) bool { return p.tokens[i].Offset >= offset })
+	for ; i < len(p.tokens); i++ {
+		if p.tokens[i].Type == tokType {
+			return p.tokens[i]
+		}
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+// closingToken devuelve el token que termina en end (el 'fin' de un bloque,
+// el ']' de una lista...)
+func (p *printer) closingToken(end ast.Position) lexer.Token {
+	i := sort.Search(len(p.tokens), func(i int) bool { return p.tokens[i].EndOffset >= end.Offset })
+	if i < len(p.tokens) {
+		return p.tokens[i]
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+// text devuelve el código original de un nodo
+func (p *printer) text(node ast.Node) string {
+	span := node.Span()
+	return p.source[span.Start.Offset:span.End.Offset]
+}
+
+func (p *printer) result() string {
+	out := strings.TrimLeft(p.buf.String(), "\n")
+	out = strings.TrimRight(out, "\n")
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
@@ -0,0 +1,108 @@
+package formatter
+
+import (
+	"flux/ast"
+	"flux/diagnostic"
+	"flux/lexer"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+)
+
+// Un programa con errores no se formatea: se devuelven sus diagnósticos
+func TestFormatMalformed(t *testing.T) {
+	tests := []struct {
+		source string
+		code   string
+	}{
+		{"si entonces\n mostrar 1\nfin", diagnostic.CodeExpectedExpression},
+		{"mientras hacer\nfin", diagnostic.CodeExpectedExpression},
+		{"repetir i desde hasta 3 hacer\nfin", diagnostic.CodeExpectedExpression},
+		{"mostrar()", diagnostic.CodeExpectedExpression},
+		{"f(1, )", diagnostic.CodeExpectedExpression},
+		{"definir x = [1, ", diagnostic.CodeExpectedExpression},
+		{"si x > 1 entonces\n mostrar x", diagnostic.CodeUnclosedBlock},
+		{"mostrar(\"sin cerrar)", diagnostic.CodeUnterminatedString},
+	}
+	for _, tt := range tests {
+		out, err := Format(tt.source)
+		if out != "" {
+			t.Errorf("%q: no debería formatearse, pero dio %q", tt.source, out)
+		}
+		diagnostics, ok := err.(diagnostic.List)
+		if !ok || !diagnostics.HasErrors() {
+			t.Errorf("%q: se esperaban diagnósticos, pero llegó %v", tt.source, err)
+			continue
+		}
+		found := false
+		for _, d := range diagnostics {
+			found = found || d.Code == tt.code
+		}
+		if !found {
+			t.Errorf("%q: se esperaba un error %s, pero llegó %v", tt.source, tt.code, diagnostics)
+		}
+	}
+}
+
+// Cortar un ejemplo en cualquier punto da un programa con errores o uno
+// válido, pero el formateador nunca debe fallar. Si el programa es válido,
+// formatearlo dos veces da lo mismo que una.
+func TestFormatTruncated(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "*.flux"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range files {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := string(data)
+		for end := 0; end <= len(source); end++ {
+			if end < len(source) && !utf8.RuneStart(source[end]) {
+				continue
+			}
+			prefix := source[:end]
+			out, err := format(t, prefix)
+			if err != nil {
+				continue
+			}
+			again, err := format(t, out)
+			if err != nil || again != out {
+				t.Errorf("%s cortado en %d: formatear otra vez dio %q, %v; se esperaba %q",
+					filepath.Base(filename), end, again, err, out)
+			}
+		}
+	}
+}
+
+// format llama a Format convirtiendo un pánico en un fallo del test
+func format(t *testing.T, source string) (out string, err error) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("Format falló con %q: %v", source, r)
+		}
+	}()
+	return Format(source)
+}
+
+// Aunque al árbol le falten nodos, el formateador escribe lo que hay
+func TestPrinterNilNodes(t *testing.T) {
+	var missing *ast.ExpressionStatement
+	stmts := []ast.Statement{
+		&ast.IfStatement{Then: &ast.BlockStatement{}},
+		&ast.WhileStatement{},
+		&ast.ExpressionStatement{Expression: &ast.ListLiteral{Elements: []ast.Expression{nil}}},
+		&ast.ExpressionStatement{Expression: &ast.DictLiteral{Pairs: []*ast.DictPair{{}}}},
+		missing,
+		nil,
+	}
+	p := &printer{tokens: []lexer.Token{{Type: lexer.TOKEN_EOF}}}
+	p.statements(stmts, 0)
+	want := "si  entonces\nfin\nmientras  hacer\nfin\n[]\n{: }\n"
+	if got := p.result(); got != want {
+		t.Errorf("se escribió %q, se esperaba %q", got, want)
+	}
+}
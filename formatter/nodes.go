@@ -0,0 +1,363 @@
+package formatter
+
+import (
+	"flux/ast"
+	"flux/lexer"
+	"flux/parser"
+	"reflect"
+	"strings"
+)
+
+// statements escribe una lista de sentencias. end es la posición donde
+// termina el bloque (su 'fin', 'sino'...): los comentarios anteriores a esa
+// posición se escriben dentro del bloque.
+func (p *printer) statements(stmts []ast.Statement, end int) {
+	for _, stmt := range stmts {
+		if isNil(stmt) {
+			continue
+		}
+		start := stmt.Span().Start
+		p.flushComments(start.Offset)
+		p.separate(start.Line)
+		p.statement(stmt)
+		p.endStatement(stmt.Span().End)
+	}
+	p.flushComments(end)
+}
+
+// block escribe el cuerpo de una sentencia con un nivel más de sangría.
+// header es la línea del código original en la que se abrió el bloque;
+// close es la palabra que lo cierra.
+func (p *printer) block(body *ast.BlockStatement, header int, close lexer.Token) {
+	p.lineComments(header)
+	p.newline()
+	p.indent++
+	p.lastLine = 0
+	if body != nil {
+		p.statements(body.Statements, close.Offset)
+	} else {
+		p.flushComments(close.Offset)
+	}
+	p.indent--
+}
+
+// bodyEnd devuelve la posición tras la última sentencia del bloque, o from
+// si el bloque está vacío
+func bodyEnd(body *ast.BlockStatement, from int) int {
+	if body == nil || len(body.Statements) == 0 {
+		return from
+	}
+	return body.Statements[len(body.Statements)-1].Span().End.Offset
+}
+
+// isNil indica si falta un nodo. El parser no deja nodos nil en un programa
+// sin errores, pero el formateador no debe fallar si alguna vez llega uno.
+func isNil(node ast.Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// spanOf devuelve el fragmento de una expresión, o uno vacío en at si falta
+func spanOf(expr ast.Expression, at ast.Position) ast.Span {
+	if isNil(expr) {
+		return ast.Span{Start: at, End: at}
+	}
+	return expr.Span()
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.DeclareStatement:
+		if s.IsConst {
+			p.write("constante ")
+		} else {
+			p.write("definir ")
+		}
+		p.write(s.Name.Value + " = ")
+		p.expression(s.Value)
+	case *ast.AssignStatement:
+		p.write(s.Name.Value + " = ")
+		p.expression(s.Value)
+	case *ast.IndexAssignStatement:
+		p.expression(s.Target)
+		p.write(" = ")
+		p.expression(s.Value)
+	case *ast.IfStatement:
+		p.write("si ")
+		p.expression(s.Condition)
+		p.write(" entonces")
+		fin := p.closingToken(s.Loc.End)
+		thenEnd := bodyEnd(s.Then, spanOf(s.Condition, s.Loc.Start).End.Offset)
+		if s.Else != nil {
+			sino := p.tokenAfter(thenEnd, lexer.TOKEN_SINO)
+			p.block(s.Then, s.Loc.Start.Line, sino)
+			p.write("sino")
+			p.block(s.Else, sino.Line, fin)
+		} else {
+			p.block(s.Then, s.Loc.Start.Line, fin)
+		}
+		p.write("fin")
+	case *ast.WhileStatement:
+		p.label(s.Label)
+		p.write("mientras ")
+		p.expression(s.Condition)
+		p.write(" hacer")
+		p.block(s.Body, spanOf(s.Condition, s.Loc.Start).Start.Line, p.closingToken(s.Loc.End))
+		p.write("fin")
+	case *ast.RepeatStatement:
+		p.label(s.Label)
+		p.write("repetir " + s.Variable.Value + " desde ")
+		p.expression(s.From)
+		p.write(" hasta ")
+		p.expression(s.To)
+		p.write(" hacer")
+		p.block(s.Body, s.Variable.Loc.Start.Line, p.closingToken(s.Loc.End))
+		p.write("fin")
+	case *ast.FunctionStatement:
+		p.write("función " + s.Name.Value)
+		p.parameters(s.Parameters)
+		p.write(" hacer")
+		p.block(s.Body, s.Name.Loc.Start.Line, p.closingToken(s.Loc.End))
+		p.write("fin")
+	case *ast.ShowStatement:
+		p.write("mostrar(")
+		if s.Value != nil {
+			p.expression(s.Value)
+		}
+		p.write(")")
+	case *ast.ReturnStatement:
+		p.write("retornar")
+		if s.Value != nil {
+			p.write(" ")
+			p.expression(s.Value)
+		}
+	case *ast.BreakStatement:
+		p.write("salir")
+		if s.Label != nil {
+			p.write(" " + s.Label.Value)
+		}
+	case *ast.ContinueStatement:
+		p.write("continuar")
+		if s.Label != nil {
+			p.write(" " + s.Label.Value)
+		}
+	case *ast.TryStatement:
+		p.tryStatement(s)
+	case *ast.ThrowStatement:
+		p.write("lanzar ")
+		p.expression(s.Value)
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression)
+	case *ast.BlockStatement:
+		p.statements(s.Statements, s.Loc.End.Offset)
+	}
+}
+
+func (p *printer) tryStatement(s *ast.TryStatement) {
+	p.write("intentar")
+	fin := p.closingToken(s.Loc.End)
+	header := s.Loc.Start.Line
+	end := bodyEnd(s.Body, s.Loc.Start.Offset)
+	body := s.Body
+
+	if s.Catch != nil {
+		capturar := p.tokenAfter(end, lexer.TOKEN_CAPTURAR)
+		p.block(body, header, capturar)
+		p.write("capturar")
+		if s.CatchName != nil {
+			p.write(" " + s.CatchName.Value + " hacer")
+		}
+		header, body = capturar.Line, s.Catch
+		end = bodyEnd(s.Catch, capturar.EndOffset)
+	}
+	if s.Finally != nil {
+		finalmente := p.tokenAfter(end, lexer.TOKEN_FINALMENTE)
+		p.block(body, header, finalmente)
+		p.write("finalmente")
+		header, body = finalmente.Line, s.Finally
+	}
+	p.block(body, header, fin)
+	p.write("fin")
+}
+
+func (p *printer) label(label *ast.Identifier) {
+	if label != nil {
+		p.write(label.Value + ": ")
+	}
+}
+
+func (p *printer) parameters(params []*ast.Identifier) {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Value
+	}
+	p.write("(" + strings.Join(names, ", ") + ")")
+}
+
+// Precedencias para decidir los paréntesis. Los literales, nombres, llamadas
+// e índices nunca los necesitan; las funciones anónimas siempre que formen
+// parte de otra expresión.
+const (
+	lowestPrecedence  = 0
+	highestPrecedence = 100
+)
+
+func precedence(expr ast.Expression) int {
+	switch e := expr.(type) {
+	case *ast.InfixExpression:
+		return parser.OperatorPrecedence(e.Operator)
+	case *ast.PrefixExpression:
+		return parser.PrefixPrecedence
+	case *ast.FunctionLiteral:
+		return lowestPrecedence
+	default:
+		return highestPrecedence
+	}
+}
+
+// operand escribe una expresión que forma parte de otra, entre paréntesis
+// si su precedencia es menor que min
+func (p *printer) operand(expr ast.Expression, min int) {
+	if precedence(expr) < min {
+		p.write("(")
+		p.expression(expr)
+		p.write(")")
+		return
+	}
+	p.expression(expr)
+}
+
+func (p *printer) expression(expr ast.Expression) {
+	if isNil(expr) {
+		return
+	}
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.InterpolatedString:
+		// Se conserva la forma original (comillas, ceros, escapes y expresiones
+		// ${...}): reescribir una cadena de varias líneas cambiaría su valor
+		p.write(p.text(e))
+	case *ast.BooleanLiteral:
+		if e.Value {
+			p.write("verdadero")
+		} else {
+			p.write("falso")
+		}
+	case *ast.InfixExpression:
+		prec := parser.OperatorPrecedence(e.Operator)
+		// Los operadores asocian por la izquierda: a - (b - c) necesita paréntesis
+		p.operand(e.Left, prec)
+		p.write(" " + e.Operator + " ")
+		p.operand(e.Right, prec+1)
+	case *ast.PrefixExpression:
+		p.write(e.Operator)
+		p.operand(e.Right, parser.PrefixPrecedence)
+	case *ast.CallExpression:
+		p.operand(e.Function, highestPrecedence)
+		p.write("(")
+		for i, arg := range e.Arguments {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(arg)
+		}
+		p.write(")")
+	case *ast.IndexExpression:
+		p.operand(e.Left, highestPrecedence)
+		p.write("[")
+		p.expression(e.Index)
+		p.write("]")
+	case *ast.ListLiteral:
+		spans := make([]ast.Span, len(e.Elements))
+		for i, el := range e.Elements {
+			spans[i] = spanOf(el, e.Loc.Start)
+		}
+		p.elements("[", "]", e.Loc, spans, func(i int) {
+			p.expression(e.Elements[i])
+		})
+	case *ast.DictLiteral:
+		spans := make([]ast.Span, len(e.Pairs))
+		for i, pair := range e.Pairs {
+			spans[i] = ast.Span{Start: spanOf(pair.Key, e.Loc.Start).Start, End: spanOf(pair.Value, e.Loc.Start).End}
+		}
+		p.elements("{", "}", e.Loc, spans, func(i int) {
+			p.expression(e.Pairs[i].Key)
+			p.write(": ")
+			p.expression(e.Pairs[i].Value)
+		})
+	case *ast.FunctionLiteral:
+		p.functionLiteral(e)
+	}
+}
+
+// elements escribe los elementos de una lista o un diccionario, que ocupan
+// los fragmentos spans. Si en el código original la lista ocupaba varias
+// líneas, se escribe un elemento por línea.
+func (p *printer) elements(open, close string, loc ast.Span, spans []ast.Span, element func(i int)) {
+	p.write(open)
+	if loc.Start.Line == loc.End.Line || len(spans) == 0 {
+		for i := range spans {
+			if i > 0 {
+				p.write(", ")
+			}
+			element(i)
+		}
+		p.write(close)
+		return
+	}
+
+	p.newline()
+	p.indent++
+	p.lastLine = 0
+	for i, span := range spans {
+		p.flushComments(span.Start.Offset)
+		element(i)
+		if i < len(spans)-1 {
+			p.write(",")
+		}
+		p.lineComments(span.End.Line)
+		p.newline()
+		p.lastLine = span.End.Line
+	}
+	p.flushComments(loc.End.Offset - 1)
+	p.indent--
+	p.write(close)
+}
+
+// functionLiteral escribe una función anónima en su forma corta si se
+// escribió así (x => x * 2) o con su bloque completo
+func (p *printer) functionLiteral(f *ast.FunctionLiteral) {
+	if value, ok := arrowBody(f); ok {
+		if len(f.Parameters) == 1 {
+			p.write(f.Parameters[0].Value)
+		} else {
+			p.parameters(f.Parameters)
+		}
+		p.write(" => ")
+		p.expression(value)
+		return
+	}
+	p.write("función")
+	p.parameters(f.Parameters)
+	p.write(" hacer")
+	p.block(f.Body, f.Loc.Start.Line, p.closingToken(f.Loc.End))
+	p.write("fin")
+}
+
+// arrowBody devuelve la expresión de una función corta. El parser la
+// representa con un 'retornar' implícito que ocupa lo mismo que la expresión;
+// un 'retornar' escrito empieza antes.
+func arrowBody(f *ast.FunctionLiteral) (ast.Expression, bool) {
+	if f.Body == nil || len(f.Body.Statements) != 1 {
+		return nil, false
+	}
+	ret, ok := f.Body.Statements[0].(*ast.ReturnStatement)
+	if !ok || isNil(ret.Value) || ret.Loc != ret.Value.Span() {
+		return nil, false
+	}
+	return ret.Value, true
+}
@@ -0,0 +1,522 @@
+package interpreter
+
+import (
+	"errors"
+	"flux/evaluator"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// ToFlux convierte un valor de Go en un valor de Flux:
+//
+//   - nil, bool y string se conservan
+//   - cualquier entero es un entero de Flux (int64) y cualquier float un
+//     decimal (float64)
+//   - los slices y arrays son listas, y los mapas con claves de esos tipos
+//     son diccionarios, con las claves ordenadas
+//   - las funciones se convierten como en RegisterBuiltin
+//   - los valores que ya son de Flux (*evaluator.List, *evaluator.Dict,
+//     funciones...) se usan sin copiarlos
+func ToFlux(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, bool, string, int64, float64,
+		*evaluator.List, *evaluator.Dict, *evaluator.Function, *evaluator.Builtin, evaluator.TypedValue:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	}
+	return fromReflect(reflect.ValueOf(value))
+}
+
+func fromReflect(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("el entero %d no cabe en un entero de Flux", v.Uint())
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return &evaluator.List{Elements: []interface{}{}}, nil
+		}
+		elements := make([]interface{}, v.Len())
+		for i := range elements {
+			element, err := ToFlux(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return &evaluator.List{Elements: elements}, nil
+	case reflect.Map:
+		return dictFromMap(v)
+	case reflect.Func:
+		fn, err := wrapFunction("<go>", v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return &evaluator.Builtin{Name: "<go>", Stateful: fn}, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return ToFlux(v.Elem().Interface())
+	}
+	return nil, fmt.Errorf("no se puede convertir un valor de tipo %s a Flux", v.Type())
+}
+
+// dictFromMap convierte un mapa de Go en un diccionario. Los mapas de Go no
+// tienen orden, así que las claves se insertan ordenadas para que el
+// resultado sea siempre el mismo.
+func dictFromMap(v reflect.Value) (interface{}, error) {
+	type entry struct {
+		key, value interface{}
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := ToFlux(iter.Key().Interface())
+		if err != nil {
+			return nil, err
+		}
+		if err := evaluator.CheckDictKey(key); err != nil {
+			return nil, err
+		}
+		value, err := ToFlux(iter.Value().Interface())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{key, value})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].key, entries[j].key
+		if cmp, ok := evaluator.Compare(a, b); ok {
+			return cmp < 0
+		}
+		return evaluator.TypeName(a) < evaluator.TypeName(b)
+	})
+
+	dict := evaluator.NewDict()
+	for _, e := range entries {
+		dict.Set(e.key, e.value)
+	}
+	return dict, nil
+}
+
+// ToGo convierte un valor de Flux en un valor de Go:
+//
+//   - nulo es nil; los enteros son int64, los decimales float64, las
+//     cadenas string y los booleanos bool
+//   - las listas son []interface{}
+//   - los diccionarios son map[string]interface{} si todas sus claves son
+//     cadenas, y map[interface{}]interface{} si no
+//   - las funciones se devuelven sin convertir, para pasarlas a Call
+//
+// Las colecciones se copian: modificar el resultado no cambia el programa.
+// Si una colección se contiene a sí misma, su copia también.
+func ToGo(value interface{}) interface{} {
+	return toGo(value, make(map[interface{}]interface{}))
+}
+
+// toGo convierte un valor. copies son las copias de las colecciones ya
+// empezadas: una colección que se contiene a sí misma da una copia que
+// también se contiene a sí misma, en lugar de una recursión infinita.
+func toGo(value interface{}, copies map[interface{}]interface{}) interface{} {
+	switch v := value.(type) {
+	case *evaluator.List:
+		if existing, ok := copies[v]; ok {
+			return existing
+		}
+		elements := make([]interface{}, len(v.Elements))
+		copies[v] = elements
+		for i, element := range v.Elements {
+			elements[i] = toGo(element, copies)
+		}
+		return elements
+	case *evaluator.Dict:
+		if existing, ok := copies[v]; ok {
+			return existing
+		}
+		keys := v.Keys()
+		if allStrings(keys) {
+			m := make(map[string]interface{}, len(keys))
+			copies[v] = m
+			for _, key := range keys {
+				value, _ := v.Get(key)
+				m[key.(string)] = toGo(value, copies)
+			}
+			return m
+		}
+		m := make(map[interface{}]interface{}, len(keys))
+		copies[v] = m
+		for _, key := range keys {
+			value, _ := v.Get(key)
+			m[key] = toGo(value, copies)
+		}
+		return m
+	default:
+		return value
+	}
+}
+
+func allStrings(values []interface{}) bool {
+	for _, value := range values {
+		if _, ok := value.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	rawType   = reflect.TypeOf(func([]interface{}) (interface{}, error) { return nil, nil })
+)
+
+// goFunction es la forma en que se ejecuta una función de Go desde Flux:
+// recibe el estado del programa para poder llamar a las funciones de Flux
+// que se le pasen como argumento
+type goFunction func(rt *evaluator.Runtime, args []interface{}) (interface{}, error)
+
+// wrapFunction adapta una función de Go a la forma de las funciones
+// predefinidas de Flux
+func wrapFunction(name string, fn interface{}) (goFunction, error) {
+	if fn == nil {
+		return nil, fmt.Errorf("la función '%s' es nil", name)
+	}
+	if raw, ok := fn.(func([]interface{}) (interface{}, error)); ok {
+		return guard(name, func(rt *evaluator.Runtime, args []interface{}) (interface{}, error) {
+			return raw(args)
+		}), nil
+	}
+
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("'%s' debe ser una función, no %s", name, t)
+	}
+	if t.ConvertibleTo(rawType) {
+		raw := v.Convert(rawType).Interface().(func([]interface{}) (interface{}, error))
+		return guard(name, func(rt *evaluator.Runtime, args []interface{}) (interface{}, error) {
+			return raw(args)
+		}), nil
+	}
+	returnsError, results := resultShape(t)
+	if results > 1 {
+		return nil, fmt.Errorf("la función '%s' devuelve demasiados valores (como mucho un valor y un error)", name)
+	}
+
+	return guard(name, func(rt *evaluator.Runtime, args []interface{}) (interface{}, error) {
+		in, err := goArguments(rt, name, t, args)
+		if err != nil {
+			return nil, err
+		}
+		out := v.Call(in)
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return nil, err
+			}
+		}
+		if results == 0 {
+			return nil, nil
+		}
+		result, err := ToFlux(out[0].Interface())
+		if err != nil {
+			return nil, &evaluator.RuntimeError{Code: evaluator.ErrInternal, Message: fmt.Sprintf("%s(): %v", name, err)}
+		}
+		return result, nil
+	}), nil
+}
+
+// resultShape indica si la función de tipo t termina devolviendo un error y
+// cuántos valores devuelve además de él
+func resultShape(t reflect.Type) (returnsError bool, results int) {
+	returnsError = t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	results = t.NumOut()
+	if returnsError {
+		results--
+	}
+	return returnsError, results
+}
+
+// callbackError lleva el error de una función de Flux llamada desde Go
+// hasta guard, cuando la función de Go que la recibió no puede devolver
+// errores
+type callbackError struct {
+	err error
+}
+
+// guard convierte un pánico de la función de Go en un error de ejecución,
+// para que un fallo del anfitrión no termine el programa que lo usa
+func guard(name string, fn goFunction) goFunction {
+	return func(rt *evaluator.Runtime, args []interface{}) (result interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				result = nil
+				if cb, ok := r.(callbackError); ok {
+					err = cb.err
+					return
+				}
+				err = &evaluator.RuntimeError{Code: evaluator.ErrInternal, Message: fmt.Sprintf("%s() falló: %v", name, r)}
+			}
+		}()
+		return fn(rt, args)
+	}
+}
+
+// goArguments convierte los argumentos de Flux a los tipos de los
+// parámetros de la función
+func goArguments(rt *evaluator.Runtime, name string, t reflect.Type, args []interface{}) ([]reflect.Value, error) {
+	fixed := t.NumIn()
+	if t.IsVariadic() {
+		fixed--
+	}
+	if len(args) < fixed || (!t.IsVariadic() && len(args) != fixed) {
+		expected := fmt.Sprintf("%d", fixed)
+		if t.IsVariadic() {
+			expected = "al menos " + expected
+		}
+		return nil, &evaluator.RuntimeError{Code: evaluator.ErrArgumentCount,
+			Message: fmt.Sprintf("%s() espera %s %s, pero recibió %d", name, expected, pluralArguments(fixed), len(args))}
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var target reflect.Type
+		if i < fixed {
+			target = t.In(i)
+		} else {
+			target = t.In(fixed).Elem()
+		}
+		value, err := toType(rt, arg, target)
+		if err != nil {
+			return nil, &evaluator.RuntimeError{Code: evaluator.ErrTypeMismatch,
+				Message: fmt.Sprintf("%s() espera %s como argumento %d, pero %s", name, describe(target), i+1, err.(*mismatch).reason())}
+		}
+		in[i] = value
+	}
+	return in, nil
+}
+
+func pluralArguments(n int) string {
+	if n == 1 {
+		return "argumento"
+	}
+	return "argumentos"
+}
+
+// mismatch es el error de toType: el valor, o el elemento de una colección,
+// que no tiene el tipo esperado
+type mismatch struct {
+	path     string // Dónde está el valor dentro del convertido, como [0]["a"]; vacío si es él mismo
+	key      bool   // El valor es una clave de diccionario, no un elemento
+	value    interface{}
+	expected reflect.Type
+}
+
+func (m *mismatch) Error() string {
+	return "se esperaba " + describe(m.expected) + ", pero " + m.reason()
+}
+
+// reason explica qué valor no es del tipo esperado
+func (m *mismatch) reason() string {
+	switch {
+	case m.path == "":
+		return "recibió un valor de tipo " + evaluator.TypeName(m.value)
+	case m.key:
+		return fmt.Sprintf("la clave %s es un valor de tipo %s en lugar de %s", m.path, evaluator.TypeName(m.value), describe(m.expected))
+	default:
+		return fmt.Sprintf("el elemento %s es un valor de tipo %s en lugar de %s", m.path, evaluator.TypeName(m.value), describe(m.expected))
+	}
+}
+
+// within añade al camino de un error la posición del elemento que lo
+// contiene
+func within(err error, step string) error {
+	m := err.(*mismatch)
+	return &mismatch{path: step + m.path, key: m.key, value: m.value, expected: m.expected}
+}
+
+// keyPath escribe una clave de diccionario como en el código: [1] o ["a"]
+func keyPath(key interface{}) string {
+	if s, ok := key.(string); ok {
+		return fmt.Sprintf("[%q]", s)
+	}
+	return "[" + evaluator.Inspect(key) + "]"
+}
+
+// toType convierte un valor de Flux al tipo de Go indicado, o devuelve un
+// *mismatch si no es posible
+func toType(rt *evaluator.Runtime, value interface{}, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface {
+		if value == nil {
+			return reflect.Zero(t), nil
+		}
+		converted := reflect.ValueOf(ToGo(value))
+		if !converted.Type().Implements(t) {
+			return reflect.Value{}, &mismatch{value: value, expected: t}
+		}
+		return converted.Convert(t), nil
+	}
+
+	switch v := value.(type) {
+	case int64:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			out := reflect.New(t).Elem()
+			if out.OverflowInt(v) {
+				return reflect.Value{}, &mismatch{value: value, expected: t}
+			}
+			out.SetInt(v)
+			return out, nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			out := reflect.New(t).Elem()
+			if v < 0 || out.OverflowUint(uint64(v)) {
+				return reflect.Value{}, &mismatch{value: value, expected: t}
+			}
+			out.SetUint(uint64(v))
+			return out, nil
+		case reflect.Float32, reflect.Float64:
+			return reflect.ValueOf(float64(v)).Convert(t), nil
+		}
+	case float64:
+		if t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64 {
+			return reflect.ValueOf(v).Convert(t), nil
+		}
+	case string:
+		if t.Kind() == reflect.String {
+			return reflect.ValueOf(v).Convert(t), nil
+		}
+	case bool:
+		if t.Kind() == reflect.Bool {
+			return reflect.ValueOf(v).Convert(t), nil
+		}
+	case *evaluator.List:
+		if t.Kind() == reflect.Slice {
+			out := reflect.MakeSlice(t, len(v.Elements), len(v.Elements))
+			for i, element := range v.Elements {
+				converted, err := toType(rt, element, t.Elem())
+				if err != nil {
+					return reflect.Value{}, within(err, fmt.Sprintf("[%d]", i))
+				}
+				out.Index(i).Set(converted)
+			}
+			return out, nil
+		}
+	case *evaluator.Dict:
+		if t.Kind() == reflect.Map {
+			out := reflect.MakeMapWithSize(t, v.Len())
+			for _, key := range v.Keys() {
+				k, err := toType(rt, key, t.Key())
+				if err != nil {
+					return reflect.Value{}, &mismatch{path: keyPath(key), key: true, value: key, expected: t.Key()}
+				}
+				element, _ := v.Get(key)
+				e, err := toType(rt, element, t.Elem())
+				if err != nil {
+					return reflect.Value{}, within(err, keyPath(key))
+				}
+				out.SetMapIndex(k, e)
+			}
+			return out, nil
+		}
+	case *evaluator.Function, *evaluator.Builtin:
+		if t.Kind() == reflect.Func {
+			return callback(rt, v, t)
+		}
+	}
+	if value != nil && reflect.TypeOf(value).AssignableTo(t) {
+		return reflect.ValueOf(value), nil
+	}
+	return reflect.Value{}, &mismatch{value: value, expected: t}
+}
+
+// callback convierte una función de Flux en una función de Go del tipo t.
+// Sus argumentos se convierten con ToFlux y su resultado al tipo que
+// devuelve t. Si la función de Flux falla, el error se devuelve si t
+// termina en error; si no, interrumpe la función de Go que la llamó y se
+// convierte en el error de esa llamada.
+func callback(rt *evaluator.Runtime, fn interface{}, t reflect.Type) (reflect.Value, error) {
+	returnsError, results := resultShape(t)
+	if results > 1 {
+		return reflect.Value{}, &mismatch{value: fn, expected: t}
+	}
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		fail := func(err error) []reflect.Value {
+			if !returnsError {
+				panic(callbackError{err})
+			}
+			if r, ok := err.(*evaluator.RuntimeError); ok && r.Line == 0 {
+				// Como en Interpreter.Call, un error sin posición no está en el código
+				err = errors.New(r.Message)
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		args := make([]interface{}, len(in))
+		for i, arg := range in {
+			converted, err := ToFlux(arg.Interface())
+			if err != nil {
+				return fail(&evaluator.RuntimeError{Code: evaluator.ErrTypeMismatch, Message: err.Error()})
+			}
+			args[i] = converted
+		}
+		result, err := rt.Call(fn, args)
+		if err != nil {
+			return fail(err)
+		}
+		if results == 1 {
+			converted, err := toType(rt, result, t.Out(0))
+			if err != nil {
+				reason := err.(*mismatch).reason()
+				if err.(*mismatch).path == "" {
+					reason = "devolvió un valor de tipo " + evaluator.TypeName(result)
+				}
+				return fail(&evaluator.RuntimeError{Code: evaluator.ErrTypeMismatch,
+					Message: fmt.Sprintf("%s debe devolver %s, pero %s", evaluator.Inspect(fn), describe(t.Out(0)), reason)})
+			}
+			out[0] = converted
+		}
+		return out
+	}), nil
+}
+
+// describe nombra un tipo de Go con el nombre del tipo de Flux que acepta
+func describe(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "un entero"
+	case reflect.Float32, reflect.Float64:
+		return "un número"
+	case reflect.String:
+		return "una cadena"
+	case reflect.Bool:
+		return "un booleano"
+	case reflect.Slice:
+		return "una lista"
+	case reflect.Map:
+		return "un diccionario"
+	case reflect.Func:
+		return "una función"
+	default:
+		return "un valor de tipo " + t.String()
+	}
+}
@@ -0,0 +1,246 @@
+package interpreter
+
+import (
+	"errors"
+	"flux/evaluator"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestToFlux(t *testing.T) {
+	five := 5
+	var nilPointer *int
+	tests := []struct {
+		value interface{}
+		want  string // Como lo muestra 'mostrar'
+		err   string
+	}{
+		{value: nil, want: "nulo"},
+		{value: int8(-3), want: "-3"},
+		{value: uint16(7), want: "7"},
+		{value: uint64(math.MaxUint64), err: "el entero 18446744073709551615 no cabe en un entero de Flux"},
+		{value: float32(1.5), want: "1.5"},
+		{value: []string{"a", "b"}, want: `["a", "b"]`},
+		{value: [2]int{1, 2}, want: "[1, 2]"},
+		{value: []int(nil), want: "[]"},
+		{value: [][]interface{}{{1, "x"}, nil}, want: `[[1, "x"], []]`},
+		{value: []interface{}{1, make(chan int)}, err: "no se puede convertir un valor de tipo chan int a Flux"},
+		{value: map[string]int{"b": 2, "a": 1}, want: `{"a": 1, "b": 2}`},
+		{value: map[interface{}]int{"a": 1, 2: 2}, want: `{"a": 1, 2: 2}`},
+		{value: map[string][]int{"a": {1}}, want: `{"a": [1]}`},
+		{value: map[[1]int]int{{1}: 1}, err: "no se puede usar un valor de tipo lista como clave de un diccionario"},
+		{value: map[string]interface{}{"a": struct{}{}}, err: "no se puede convertir un valor de tipo struct {} a Flux"},
+		{value: &five, want: "5"},
+		{value: nilPointer, want: "nulo"},
+		{value: struct{ X int }{1}, err: "no se puede convertir un valor de tipo struct { X int } a Flux"},
+		{value: func(n int) int { return n }, want: "<función predefinida <go>>"},
+		{value: func() (int, int, error) { return 0, 0, nil }, err: "la función '<go>' devuelve demasiados valores (como mucho un valor y un error)"},
+	}
+	for _, tt := range tests {
+		got, err := ToFlux(tt.value)
+		if tt.err != "" {
+			if message(err) != tt.err {
+				t.Errorf("ToFlux(%#v): error %v, se esperaba %q", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || evaluator.Inspect(got) != tt.want {
+			t.Errorf("ToFlux(%#v) = %s, %v; se esperaba %s", tt.value, evaluator.Inspect(got), err, tt.want)
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	strings := evaluator.NewDict()
+	strings.Set("a", &evaluator.List{Elements: []interface{}{int64(1), nil}})
+	mixed := evaluator.NewDict()
+	mixed.Set("a", 1.5)
+	mixed.Set(int64(2), true)
+
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{int64(1), int64(1)},
+		{"hola", "hola"},
+		{&evaluator.List{Elements: []interface{}{int64(1), "a"}}, []interface{}{int64(1), "a"}},
+		{strings, map[string]interface{}{"a": []interface{}{int64(1), nil}}},
+		{mixed, map[interface{}]interface{}{"a": 1.5, int64(2): true}},
+	}
+	for _, tt := range tests {
+		if got := ToGo(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ToGo(%s) = %#v, se esperaba %#v", evaluator.Inspect(tt.value), got, tt.want)
+		}
+	}
+
+	// Una lista que se contiene a sí misma da un slice que se contiene a sí
+	// mismo, y la copia no comparte nada con el original
+	list := &evaluator.List{Elements: []interface{}{int64(1)}}
+	list.Elements = append(list.Elements, list)
+	copied := ToGo(list).([]interface{})
+	inner, ok := copied[1].([]interface{})
+	if !ok || &inner[0] != &copied[0] {
+		t.Errorf("la copia de una lista que se contiene a sí misma no se contiene a sí misma: %#v", copied)
+	}
+	copied[0] = int64(2)
+	if list.Elements[0] != int64(1) {
+		t.Error("modificar la copia cambió la lista original")
+	}
+}
+
+// Los argumentos de Flux se convierten al tipo de cada parámetro de la
+// función del anfitrión. Si no se puede, el error dice qué argumento (y qué
+// elemento dentro de él) no tiene el tipo esperado.
+func TestHostArguments(t *testing.T) {
+	tests := []struct {
+		fn      interface{}
+		call    string
+		want    interface{}
+		code    evaluator.ErrorCode
+		message string
+	}{
+		// Números, cadenas y booleanos
+		{fn: func(n int) int { return n * 2 }, call: "f(21)", want: int64(42)},
+		{fn: func(n int) int { return n }, call: `f("a")`, code: evaluator.ErrTypeMismatch,
+			message: "f() espera un entero como argumento 1, pero recibió un valor de tipo cadena"},
+		{fn: func(n int8) int8 { return n }, call: "f(300)", code: evaluator.ErrTypeMismatch,
+			message: "f() espera un entero como argumento 1, pero recibió un valor de tipo entero"},
+		{fn: func(n uint) uint { return n }, call: "f(-1)", code: evaluator.ErrTypeMismatch,
+			message: "f() espera un entero como argumento 1, pero recibió un valor de tipo entero"},
+		{fn: func(x float32) float64 { return float64(x) / 2 }, call: "f(3)", want: 1.5},
+		{fn: func(x float64) float64 { return x }, call: `f(verdadero)`, code: evaluator.ErrTypeMismatch,
+			message: "f() espera un número como argumento 1, pero recibió un valor de tipo booleano"},
+		{fn: func(s string, b bool) string { return fmt.Sprint(s, b) }, call: `f("a", falso)`, want: "afalse"},
+
+		// Listas y diccionarios
+		{fn: func(xs []int) int { return len(xs) }, call: "f([1, 2, 3])", want: int64(3)},
+		{fn: func(xs []int) int { return len(xs) }, call: `f([1, "a"])`, code: evaluator.ErrTypeMismatch,
+			message: "f() espera una lista como argumento 1, pero el elemento [1] es un valor de tipo cadena en lugar de un entero"},
+		{fn: func(xs [][]string) int { return len(xs) }, call: `f([["a", 2]])`, code: evaluator.ErrTypeMismatch,
+			message: "f() espera una lista como argumento 1, pero el elemento [0][1] es un valor de tipo entero en lugar de una cadena"},
+		{fn: func(xs []int) int { return len(xs) }, call: `f({"a": 1})`, code: evaluator.ErrTypeMismatch,
+			message: "f() espera una lista como argumento 1, pero recibió un valor de tipo diccionario"},
+		{fn: func(m map[string]int) int { return m["a"] + m["b"] }, call: `f({"a": 1, "b": 2})`, want: int64(3)},
+		{fn: func(m map[string]int) int { return 0 }, call: `f({"a": "x"})`, code: evaluator.ErrTypeMismatch,
+			message: `f() espera un diccionario como argumento 1, pero el elemento ["a"] es un valor de tipo cadena en lugar de un entero`},
+		{fn: func(m map[string]int) int { return 0 }, call: `f({1: 2})`, code: evaluator.ErrTypeMismatch,
+			message: "f() espera un diccionario como argumento 1, pero la clave [1] es un valor de tipo entero en lugar de una cadena"},
+		{fn: func(m map[string][]int) int { return 0 }, call: `f({"a": [1, verdadero]})`, code: evaluator.ErrTypeMismatch,
+			message: `f() espera un diccionario como argumento 1, pero el elemento ["a"][1] es un valor de tipo booleano en lugar de un entero`},
+
+		// Interfaces: reciben el valor convertido con ToGo
+		{fn: func(v interface{}) string { return fmt.Sprintf("%T", v) }, call: `f({"a": [1]})`, want: "map[string]interface {}"},
+		{fn: func(v interface{}) string { return fmt.Sprintf("%T", v) }, call: "f(verdadero)", want: "bool"},
+		{fn: func(s fmt.Stringer) string { return s.String() }, call: "f(1)", code: evaluator.ErrTypeMismatch,
+			message: "f() espera un valor de tipo fmt.Stringer como argumento 1, pero recibió un valor de tipo entero"},
+
+		// Las estructuras no tienen equivalente en Flux
+		{fn: func(p struct{ X int }) int { return p.X }, call: `f({"X": 1})`, code: evaluator.ErrTypeMismatch,
+			message: "f() espera un valor de tipo struct { X int } como argumento 1, pero recibió un valor de tipo diccionario"},
+		{fn: func() struct{ X int } { return struct{ X int }{1} }, call: "f()", code: evaluator.ErrInternal,
+			message: "f(): no se puede convertir un valor de tipo struct { X int } a Flux"},
+
+		// Número de argumentos y funciones variádicas
+		{fn: func(a, b int) int { return a + b }, call: "f(1)", code: evaluator.ErrArgumentCount,
+			message: "f() espera 2 argumentos, pero recibió 1"},
+		{fn: func(sep string, xs ...int) int { return len(xs) }, call: `f("-", 1, 2, 3)`, want: int64(3)},
+		{fn: func(sep string, xs ...int) int { return len(xs) }, call: "f()", code: evaluator.ErrArgumentCount,
+			message: "f() espera al menos 1 argumento, pero recibió 0"},
+		{fn: func(xs ...int) int { return len(xs) }, call: `f(1, "a")`, code: evaluator.ErrTypeMismatch,
+			message: "f() espera un entero como argumento 2, pero recibió un valor de tipo cadena"},
+
+		// Errores y pánicos del anfitrión
+		{fn: func() (int, error) { return 0, errors.New("sin conexión") }, call: "f()", code: evaluator.ErrInvalidArgument,
+			message: "sin conexión"},
+		{fn: func() int { panic("roto") }, call: "f()", code: evaluator.ErrInternal, message: "f() falló: roto"},
+	}
+	for _, tt := range tests {
+		in := New()
+		if err := in.RegisterBuiltin("f", tt.fn); err != nil {
+			t.Fatalf("%s: %v", tt.call, err)
+		}
+		got, err := in.Eval(tt.call)
+		checkResult(t, tt.call, got, err, tt.want, tt.code, tt.message)
+	}
+}
+
+// Un parámetro de tipo función recibe la función de Flux convertida en una
+// función de Go que la llama
+func TestHostCallbacks(t *testing.T) {
+	tests := []struct {
+		fn      interface{}
+		call    string
+		want    interface{}
+		code    evaluator.ErrorCode
+		message string
+	}{
+		{fn: func(g func(int) int, x int) int { return g(x) }, call: "f(x => x * 2, 21)", want: int64(42)},
+		{fn: func(g func([]string) string) string { return g([]string{"a", "b"}) }, call: `f(xs => unir(xs, "+"))`, want: "a+b"},
+		{fn: func(g func(int) int) int { return g(-3) }, call: "f(abs)", want: int64(3)},
+		{fn: func(g func()) int { g(); g(); return 2 }, call: "f(función() hacer\nfin)", want: int64(2)},
+		{fn: func(g func(int) int) int { return g(1) }, call: "f(1)", code: evaluator.ErrTypeMismatch,
+			message: "f() espera una función como argumento 1, pero recibió un valor de tipo entero"},
+
+		// La función de Flux devuelve algo que no es del tipo esperado
+		{fn: func(g func() int) int { return g() }, call: `f(() => "a")`, code: evaluator.ErrTypeMismatch,
+			message: "<función anónima> debe devolver un entero, pero devolvió un valor de tipo cadena"},
+		{fn: func(g func() []int) int { return len(g()) }, call: `f(() => [1, "a"])`, code: evaluator.ErrTypeMismatch,
+			message: "<función anónima> debe devolver una lista, pero el elemento [1] es un valor de tipo cadena en lugar de un entero"},
+
+		// Si la función de Go puede recibir el error, lo recibe; si no, el
+		// error de la función de Flux es el de la llamada
+		{fn: func(g func() (int, error)) string {
+			if _, err := g(); err != nil {
+				return "recibido: " + err.Error()
+			}
+			return "sin error"
+		}, call: "f(función() hacer\n    lanzar \"fallo\"\nfin)", want: "recibido: línea 2, columna 5: fallo"},
+		{fn: func(g func(int) error) string { return fmt.Sprint(g(0)) }, call: "f(x => 1 / x)", want: "línea 1, columna 8: división por cero"},
+		{fn: func(g func(int) int) int { return g(0) + 1 }, call: "f(x => 1 / x)", code: evaluator.ErrDivisionByZero,
+			message: "división por cero"},
+		{fn: func(g func(int) int) int { return g(1) }, call: "f((a, b) => a)", code: evaluator.ErrArgumentCount,
+			message: "la función 'anónima' espera 2 argumentos, pero recibió 1"},
+
+		// Una función de Go no puede recibir una función que devuelva más de
+		// un valor y un error
+		{fn: func(g func() (int, int)) int { return 0 }, call: "f(() => 1)", code: evaluator.ErrTypeMismatch,
+			message: "f() espera una función como argumento 1, pero recibió un valor de tipo función"},
+	}
+	for _, tt := range tests {
+		in := New()
+		if err := in.RegisterBuiltin("f", tt.fn); err != nil {
+			t.Fatalf("%s: %v", tt.call, err)
+		}
+		got, err := in.Eval(tt.call)
+		checkResult(t, tt.call, got, err, tt.want, tt.code, tt.message)
+	}
+}
+
+// message es el texto de un error sin la posición, que en los errores
+// de ToFlux no existe
+func message(err error) string {
+	if runtimeErr, ok := err.(*evaluator.RuntimeError); ok {
+		return runtimeErr.Message
+	}
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// checkResult compara el resultado de Eval con el valor o el error esperado
+func checkResult(t *testing.T, call string, got interface{}, err error, want interface{}, code evaluator.ErrorCode, message string) {
+	t.Helper()
+	if code == "" {
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, %v; se esperaba %#v", call, got, err, want)
+		}
+		return
+	}
+	runtimeErr, ok := err.(*evaluator.RuntimeError)
+	if !ok || runtimeErr.Code != code || runtimeErr.Message != message {
+		t.Errorf("%s: error %v; se esperaba [%s] %s", call, err, code, message)
+	}
+}
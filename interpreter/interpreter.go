@@ -0,0 +1,296 @@
+// Package interpreter permite usar Flux desde programas en Go: ejecutar
+// código y archivos, leer y modificar sus variables globales y ofrecerle
+// funciones escritas en Go.
+//
+//	in := interpreter.New(interpreter.WithOutput(&buf))
+//	in.RegisterBuiltin("doble", func(n int) int { return 2 * n })
+//	in.Set("nombre", "Ana")
+//	valor, err := in.Eval(`doble(21)`)
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"flux/ast"
+	"flux/evaluator"
+	"flux/lexer"
+	"flux/parser"
+	"flux/semantic"
+	"flux/symbol"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Interpreter es una sesión de Flux. Lo definido en una llamada a Eval o
+// RunFile sigue disponible en las siguientes, como en la consola.
+type Interpreter struct {
+	table        *symbol.Table
+	eval         *evaluator.Evaluator
+	builtins     map[string]*evaluator.Builtin
+	evalOptions  []evaluator.Option
+	dynamicScope bool
+}
+
+// Option configura un Interpreter al crearlo
+type Option func(*Interpreter)
+
+// WithOutput hace que 'mostrar' escriba en w en lugar de en la salida estándar
+func WithOutput(w io.Writer) Option {
+	return func(in *Interpreter) {
+		in.evalOptions = append(in.evalOptions, evaluator.WithOutput(w))
+	}
+}
+
+// WithInput hace que 'leer' y las demás funciones de entrada lean de r en
+// lugar de la entrada estándar
+func WithInput(r io.Reader) Option {
+	return func(in *Interpreter) {
+		in.evalOptions = append(in.evalOptions, evaluator.WithInput(r))
+	}
+}
+
+// WithSeed fija la semilla de 'aleatorio' para que los números se repitan
+// de una ejecución a otra
+func WithSeed(seed int64) Option {
+	return func(in *Interpreter) {
+		in.evalOptions = append(in.evalOptions, evaluator.WithSeed(seed))
+	}
+}
+
+// WithDynamicScope activa el alcance dinámico de las versiones anteriores
+// de Flux (ver evaluator.WithDynamicScope)
+func WithDynamicScope() Option {
+	return func(in *Interpreter) {
+		in.dynamicScope = true
+		in.evalOptions = append(in.evalOptions, evaluator.WithDynamicScope())
+	}
+}
+
+// WithContext interrumpe la ejecución cuando el contexto se cancela o vence
+// su plazo. Estos límites protegen al anfitrión de programas que no
+// terminan: los errores que producen no se pueden capturar con 'intentar'.
+func WithContext(ctx context.Context) Option {
+	return func(in *Interpreter) {
+		in.evalOptions = append(in.evalOptions, evaluator.WithContext(ctx))
+	}
+}
+
+// WithMaxSteps limita el número de sentencias ejecutadas entre todas las
+// llamadas a Eval, RunFile y Call de la sesión
+func WithMaxSteps(n int) Option {
+	return func(in *Interpreter) {
+		in.evalOptions = append(in.evalOptions, evaluator.WithMaxSteps(n))
+	}
+}
+
+// WithMaxDepth cambia la profundidad máxima de llamadas (por defecto
+// evaluator.DefaultMaxDepth)
+func WithMaxDepth(n int) Option {
+	return func(in *Interpreter) {
+		in.evalOptions = append(in.evalOptions, evaluator.WithMaxDepth(n))
+	}
+}
+
+// WithMaxSize limita la longitud de las cadenas y el número de elementos de
+// las colecciones que crea el programa
+func WithMaxSize(n int) Option {
+	return func(in *Interpreter) {
+		in.evalOptions = append(in.evalOptions, evaluator.WithMaxSize(n))
+	}
+}
+
+// New crea una sesión sin variables definidas
+func New(opts ...Option) *Interpreter {
+	in := &Interpreter{
+		table:    symbol.NewTable(),
+		builtins: make(map[string]*evaluator.Builtin),
+	}
+	for _, opt := range opts {
+		opt(in)
+	}
+	in.evalOptions = append(in.evalOptions, evaluator.WithBuiltins(in.builtins))
+	in.eval = evaluator.New(in.table, in.evalOptions...)
+	return in
+}
+
+// Eval ejecuta código de Flux. Si la última sentencia es una expresión
+// suelta, devuelve su valor convertido a Go (ver ToGo).
+//
+// Los errores de análisis se devuelven como diagnostic.List y los de
+// ejecución como *evaluator.RuntimeError.
+func (in *Interpreter) Eval(source string) (interface{}, error) {
+	return in.run(source)
+}
+
+// RunFile ejecuta un archivo de Flux en la sesión
+func (in *Interpreter) RunFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = in.run(strings.TrimPrefix(string(data), "\uFEFF"))
+	return err
+}
+
+func (in *Interpreter) run(source string) (interface{}, error) {
+	program, err := in.analyze(source)
+	if err != nil {
+		return nil, err
+	}
+
+	// Como en la consola, el valor de la última expresión es el resultado
+	var last *ast.ExpressionStatement
+	if n := len(program.Statements); n > 0 {
+		if stmt, ok := program.Statements[n-1].(*ast.ExpressionStatement); ok {
+			last = stmt
+			program.Statements = program.Statements[:n-1]
+		}
+	}
+
+	if err := in.eval.Evaluate(program); err != nil && !evaluator.IsReturnValue(err) {
+		return nil, err
+	}
+	if last == nil {
+		return nil, nil
+	}
+	value, err := in.eval.EvaluateExpression(last.Expression)
+	if err != nil {
+		return nil, err
+	}
+	return ToGo(value), nil
+}
+
+// analyze hace el análisis léxico, sintáctico y semántico. Las variables
+// de la sesión y las funciones registradas cuentan como ya declaradas.
+func (in *Interpreter) analyze(source string) (*ast.Program, error) {
+	l := lexer.New(source)
+	tokens, _ := l.Tokenize()
+	p := parser.New(tokens)
+	program, _ := p.Parse()
+	diagnostics := append(l.Diagnostics(), p.Errors()...)
+	if diagnostics.HasErrors() {
+		diagnostics.Sort()
+		return nil, diagnostics
+	}
+
+	predeclared := append(evaluator.BuiltinNames(), in.table.Names()...)
+	for name := range in.builtins {
+		predeclared = append(predeclared, name)
+	}
+	analyzer := semantic.New(predeclared, evaluator.ConstantNames())
+	analyzer.SetDynamicScope(in.dynamicScope)
+	analyzer.Analyze(program)
+	return program, analyzer.Errors().Err()
+}
+
+// Get devuelve el valor de una variable global convertido a Go (ver ToGo)
+func (in *Interpreter) Get(name string) (interface{}, bool) {
+	value, ok := in.table.Get(name)
+	if !ok {
+		return nil, false
+	}
+	return ToGo(value), true
+}
+
+// Set define o cambia una variable global. El valor se convierte a Flux
+// con ToFlux; no se puede cambiar una constante, ni las del programa ni las
+// predefinidas como PI.
+func (in *Interpreter) Set(name string, value interface{}) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if in.table.IsConst(name) {
+		return fmt.Errorf("no se puede modificar la constante '%s'", name)
+	}
+	if isPredefinedConstant(name) {
+		return fmt.Errorf("no se puede modificar la constante predefinida '%s'", name)
+	}
+	converted, err := ToFlux(value)
+	if err != nil {
+		return fmt.Errorf("variable '%s': %w", name, err)
+	}
+	in.table.Set(name, converted)
+	return nil
+}
+
+// Call llama a una función global de Flux (o a una predefinida) con
+// argumentos de Go y devuelve su resultado convertido a Go
+func (in *Interpreter) Call(name string, args ...interface{}) (interface{}, error) {
+	fn, ok := in.table.Get(name)
+	if !ok {
+		builtin, found := in.builtins[name]
+		if !found {
+			builtin, found = evaluator.LookupBuiltin(name)
+		}
+		if !found {
+			return nil, fmt.Errorf("la función '%s' no está definida", name)
+		}
+		fn = builtin
+	}
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		converted, err := ToFlux(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argumento %d de '%s': %w", i+1, name, err)
+		}
+		values[i] = converted
+	}
+	result, err := in.eval.Call(fn, values)
+	if r, ok := err.(*evaluator.RuntimeError); ok && r.Line == 0 {
+		// El error es de la llamada misma, que no está en el código
+		return nil, errors.New(r.Message)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ToGo(result), nil
+}
+
+// RegisterBuiltin ofrece una función de Go a los programas de Flux con el
+// nombre indicado. Se usa cuando el programa no define ese nombre y
+// reemplaza a la función predefinida de Flux que se llame igual.
+//
+// fn puede ser una func([]interface{}) (interface{}, error), que recibe y
+// devuelve valores de Flux sin convertir, o cualquier otra función de Go:
+// sus argumentos se convierten desde Flux según el tipo de cada parámetro
+// y sus resultados con ToFlux. Puede devolver nada, un valor, un error o
+// un valor y un error; un error devuelto se convierte en un error de
+// ejecución de Flux que se puede capturar con 'intentar'. Un parámetro de
+// tipo función recibe la función de Flux convertida en una función de Go
+// que la llama.
+func (in *Interpreter) RegisterBuiltin(name string, fn interface{}) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if isPredefinedConstant(name) {
+		return fmt.Errorf("'%s' es una constante predefinida y no puede ser una función", name)
+	}
+	wrapped, err := wrapFunction(name, fn)
+	if err != nil {
+		return err
+	}
+	in.builtins[name] = &evaluator.Builtin{Name: name, Stateful: wrapped}
+	return nil
+}
+
+// isPredefinedConstant indica si name es una constante predefinida, como PI
+func isPredefinedConstant(name string) bool {
+	for _, constant := range evaluator.ConstantNames() {
+		if name == constant {
+			return true
+		}
+	}
+	return false
+}
+
+// checkName comprueba que un nombre sea un identificador válido de Flux
+func checkName(name string) error {
+	tokens, _ := lexer.New(name).Tokenize()
+	if len(tokens) != 2 || tokens[0].Type != lexer.TOKEN_IDENTIFICADOR || tokens[0].Value != name {
+		return fmt.Errorf("'%s' no es un nombre válido en Flux", name)
+	}
+	return nil
+}
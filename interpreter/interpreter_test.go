@@ -0,0 +1,64 @@
+package interpreter
+
+import (
+	"flux/evaluator"
+	"testing"
+)
+
+// Una función del anfitrión que llama a una función de Flux que vuelve a
+// llamarla debe dar un error de profundidad, no agotar la pila de Go
+func TestHostRecursionDepth(t *testing.T) {
+	in := New(WithMaxDepth(200))
+	if err := in.RegisterBuiltin("aplicar", func(f func(int) int, x int) int { return f(x) }); err != nil {
+		t.Fatal(err)
+	}
+	_, err := in.Eval(`función g(n) hacer
+    retornar aplicar(g, n + 1)
+fin
+g(0)`)
+	runtimeErr, ok := err.(*evaluator.RuntimeError)
+	if !ok || runtimeErr.Code != evaluator.ErrDepthLimit {
+		t.Fatalf("se esperaba un error %s, pero llegó %v", evaluator.ErrDepthLimit, err)
+	}
+	if runtimeErr.Line != 2 {
+		t.Errorf("el error está en la línea %d, se esperaba la 2", runtimeErr.Line)
+	}
+
+	// Sin llegar al límite, la recursión a través del anfitrión funciona
+	result, err := in.Eval(`función h(n) hacer
+    si n == 0 entonces
+        retornar 0
+    fin
+    retornar aplicar(x => h(x), n - 1) + 1
+fin
+h(50)`)
+	if err != nil || result != int64(50) {
+		t.Errorf("h(50) = %v, %v; se esperaba 50", result, err)
+	}
+}
+
+// Las constantes predefinidas no se pueden cambiar desde Go, igual que
+// desde el programa
+func TestSetPredefinedConstant(t *testing.T) {
+	in := New()
+	for _, name := range evaluator.ConstantNames() {
+		if err := in.Set(name, 3); err == nil {
+			t.Errorf("Set(%q) debería fallar", name)
+		}
+		if err := in.RegisterBuiltin(name, func() int { return 3 }); err == nil {
+			t.Errorf("RegisterBuiltin(%q) debería fallar", name)
+		}
+	}
+	result, err := in.Eval("PI > 3.14 && PI < 3.15")
+	if err != nil || result != true {
+		t.Errorf("PI cambió: %v, %v", result, err)
+	}
+
+	// Las constantes del programa tampoco
+	if _, err := in.Eval("constante LIMITE = 10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Set("LIMITE", 3); err == nil {
+		t.Error("Set(\"LIMITE\") debería fallar")
+	}
+}
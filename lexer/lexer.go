@@ -1,7 +1,10 @@
 package lexer
 
 import (
+	"flux/ast"
+	"flux/diagnostic"
 	"fmt"
+	"sort"
 	"strings"
 	"unicode/utf8"
 )
@@ -10,29 +13,34 @@ type TokenType string
 
 const (
 	// Palabras reservadas
-	TOKEN_DEFINIR   TokenType = "DEFINIR"
-	TOKEN_CONSTANTE TokenType = "CONSTANTE"
-	TOKEN_FUNCION   TokenType = "FUNCION"
-	TOKEN_SI        TokenType = "SI"
-	TOKEN_ENTONCES  TokenType = "ENTONCES"
-	TOKEN_SINO      TokenType = "SINO"
-	TOKEN_MIENTRAS  TokenType = "MIENTRAS"
-	TOKEN_REPETIR   TokenType = "REPETIR"
-	TOKEN_DESDE     TokenType = "DESDE"
-	TOKEN_HASTA     TokenType = "HASTA"
-	TOKEN_HACER     TokenType = "HACER"
-	TOKEN_FIN       TokenType = "FIN"
-	TOKEN_MOSTRAR   TokenType = "MOSTRAR"
-	TOKEN_RETORNAR  TokenType = "RETORNAR"
-	TOKEN_SALIR     TokenType = "SALIR"
-	TOKEN_CONTINUAR TokenType = "CONTINUAR"
-	TOKEN_VERDADERO TokenType = "VERDADERO"
-	TOKEN_FALSO     TokenType = "FALSO"
-	TOKEN_NULO      TokenType = "NULO"
+	TOKEN_DEFINIR    TokenType = "DEFINIR"
+	TOKEN_CONSTANTE  TokenType = "CONSTANTE"
+	TOKEN_FUNCION    TokenType = "FUNCION"
+	TOKEN_SI         TokenType = "SI"
+	TOKEN_ENTONCES   TokenType = "ENTONCES"
+	TOKEN_SINO       TokenType = "SINO"
+	TOKEN_MIENTRAS   TokenType = "MIENTRAS"
+	TOKEN_REPETIR    TokenType = "REPETIR"
+	TOKEN_DESDE      TokenType = "DESDE"
+	TOKEN_HASTA      TokenType = "HASTA"
+	TOKEN_HACER      TokenType = "HACER"
+	TOKEN_FIN        TokenType = "FIN"
+	TOKEN_MOSTRAR    TokenType = "MOSTRAR"
+	TOKEN_RETORNAR   TokenType = "RETORNAR"
+	TOKEN_SALIR      TokenType = "SALIR"
+	TOKEN_CONTINUAR  TokenType = "CONTINUAR"
+	TOKEN_INTENTAR   TokenType = "INTENTAR"
+	TOKEN_CAPTURAR   TokenType = "CAPTURAR"
+	TOKEN_FINALMENTE TokenType = "FINALMENTE"
+	TOKEN_LANZAR     TokenType = "LANZAR"
+	TOKEN_VERDADERO  TokenType = "VERDADERO"
+	TOKEN_FALSO      TokenType = "FALSO"
+	TOKEN_NULO       TokenType = "NULO"
 
 	// Operadores
 	TOKEN_ASIGNACION  TokenType = "ASIGNACION"  // =
 	TOKEN_IGUAL       TokenType = "IGUAL"       // ==
+	TOKEN_FLECHA      TokenType = "FLECHA"      // =>
 	TOKEN_DIFERENTE   TokenType = "DIFERENTE"   // !=
 	TOKEN_MENOR_IGUAL TokenType = "MENOR_IGUAL" // <=
 	TOKEN_MAYOR_IGUAL TokenType = "MAYOR_IGUAL" // >=
@@ -52,7 +60,10 @@ const (
 	TOKEN_PARENTESIS_DER TokenType = "PARENTESIS_DER" // )
 	TOKEN_LLAVE_IZQ      TokenType = "LLAVE_IZQ"      // {
 	TOKEN_LLAVE_DER      TokenType = "LLAVE_DER"      // }
+	TOKEN_CORCHETE_IZQ   TokenType = "CORCHETE_IZQ"   // [
+	TOKEN_CORCHETE_DER   TokenType = "CORCHETE_DER"   // ]
 	TOKEN_COMA           TokenType = "COMA"           // ,
+	TOKEN_DOS_PUNTOS     TokenType = "DOS_PUNTOS"     // :
 	TOKEN_PUNTO          TokenType = "PUNTO"          // ·
 
 	// Literales
@@ -70,10 +81,20 @@ const (
 )
 
 type Token struct {
-	Type   TokenType
-	Value  string
-	Line   int
-	Column int
+	Type   TokenType `json:"type"`
+	Value  string    `json:"value"`
+	Line   int       `json:"line"`   // Desde 1
+	Column int       `json:"column"` // Desde 1, contado en caracteres (runas)
+	Offset int       `json:"offset"` // Posición en bytes del inicio del token
+
+	// Posición justo después del último carácter del token
+	EndLine   int `json:"endLine"`
+	EndColumn int `json:"endColumn"`
+	EndOffset int `json:"endOffset"`
+}
+
+func (t Token) String() string {
+	return fmt.Sprintf("%d:%d\t%-16s %s", t.Line, t.Column, t.Type, t.Value)
 }
 
 type Lexer struct {
@@ -83,19 +104,41 @@ type Lexer struct {
 	ch           rune
 	line         int
 	column       int
+	diagnostics  diagnostic.List
+	comments     []Comment
+}
+
+// Comment es un comentario del código. El parser no los recibe, pero se
+// conservan para herramientas como el formateador.
+type Comment struct {
+	Text   string // Incluye los delimitadores: "// ..." o "/* ... */"
+	Line   int
+	Column int
+	Offset int
+
+	// Posición justo después del último carácter del comentario
+	EndLine   int
+	EndOffset int
 }
 
 func New(input string) *Lexer {
 	l := &Lexer{
-		input:  input,
-		line:   1,
-		column: 1,
+		input: input,
+		line:  1,
 	}
 	l.readChar()
 	return l
 }
 
+// readChar avanza al siguiente carácter. line y column siempre indican la
+// posición de l.ch.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 		l.position = l.readPosition
@@ -112,13 +155,6 @@ func (l *Lexer) readChar() {
 	l.ch = r
 	l.position = l.readPosition
 	l.readPosition += size
-
-	if l.ch == '\n' {
-		l.line++
-		l.column = 1
-	} else {
-		l.column++
-	}
 }
 
 func (l *Lexer) peekChar() rune {
@@ -138,9 +174,11 @@ func (l *Lexer) skipWhitespace() {
 
 		// Saltar comentarios de línea
 		if l.ch == '/' && l.peekChar() == '/' {
+			comment := l.startComment()
 			for l.ch != '\n' && l.ch != 0 {
 				l.readChar()
 			}
+			l.endComment(comment)
 			if l.ch == '\n' {
 				l.readChar()
 			}
@@ -149,10 +187,12 @@ func (l *Lexer) skipWhitespace() {
 
 		// Saltar comentarios de bloque
 		if l.ch == '/' && l.peekChar() == '*' {
+			comment := l.startComment()
 			l.readChar() // consume '/'
 			l.readChar() // consume '*'
 			for {
 				if l.ch == 0 {
+					l.endComment(comment)
 					return
 				}
 				if l.ch == '*' && l.peekChar() == '/' {
@@ -162,6 +202,7 @@ func (l *Lexer) skipWhitespace() {
 				}
 				l.readChar()
 			}
+			l.endComment(comment)
 			continue
 		}
 
@@ -169,6 +210,24 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+func (l *Lexer) startComment() Comment {
+	return Comment{Line: l.line, Column: l.column, Offset: l.position}
+}
+
+// endComment completa el comentario que empezó en c con el texto leído
+// hasta la posición actual
+func (l *Lexer) endComment(c Comment) {
+	c.Text = strings.TrimRight(l.input[c.Offset:l.position], "\r")
+	c.EndLine = l.line
+	c.EndOffset = c.Offset + len(c.Text)
+	l.comments = append(l.comments, c)
+}
+
+// Comments devuelve los comentarios leídos hasta ahora, en orden
+func (l *Lexer) Comments() []Comment {
+	return l.comments
+}
+
 func (l *Lexer) readNumber() string {
 	position := l.position
 	for isDigit(l.ch) {
@@ -191,33 +250,87 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() (string, error) {
-	quote := l.ch
-	l.readChar()
+// readString lee una cadena incluyendo sus comillas (ver strings.go). Una
+// cadena entre comillas simples termina en la misma línea en la que empieza;
+// si no se cierra, se da por cerrada al final de la línea (o del archivo,
+// si es de varias líneas) para poder seguir analizando el resto.
+func (l *Lexer) readString() (string, bool) {
 	position := l.position
-
-	for l.ch != quote && l.ch != 0 {
-		if l.ch == '\\' {
+	delimiter := stringDelimiter(l.input[position:])
+	multiline := len(delimiter) == 3
+	l.advance(len(delimiter))
+
+	for l.ch != 0 && (multiline || l.ch != '\n') {
+		rest := l.input[l.position:]
+		switch {
+		case strings.HasPrefix(rest, delimiter):
+			l.advance(len(delimiter))
+			return l.input[position:l.position], true
+		case l.ch == '\\':
+			l.readChar()
+			if l.ch != 0 && (multiline || l.ch != '\n') {
+				l.readChar()
+			}
+		case strings.HasPrefix(rest, "${"):
+			// Las comillas dentro de la expresión no cierran la cadena
+			end, ok := interpolationEnd(rest[2:])
+			if ok && (multiline || !strings.Contains(rest[:2+end], "\n")) {
+				l.advance(2 + end + 1)
+			} else {
+				l.readChar()
+			}
+		default:
 			l.readChar()
 		}
-		l.readChar()
 	}
 
-	if l.ch == 0 {
-		return "", fmt.Errorf("cadena no cerrada en línea %d", l.line)
+	return strings.TrimRight(l.input[position:l.position], "\r") + delimiter, false
+}
+
+// advance avanza n bytes
+func (l *Lexer) advance(n int) {
+	for end := l.position + n; l.position < end && l.ch != 0; {
+		l.readChar()
 	}
+}
 
-	l.readChar()
-	return l.input[position-1 : l.position], nil
+// Diagnostics devuelve los errores encontrados hasta ahora
+func (l *Lexer) Diagnostics() diagnostic.List {
+	return l.diagnostics
 }
 
-func (l *Lexer) NextToken() Token {
-	var tok Token
+// report registra un error en el fragmento que va desde la posición
+// indicada hasta la posición actual
+func (l *Lexer) report(code string, line, column, offset int, format string, args ...interface{}) *diagnostic.Diagnostic {
+	span := ast.Span{
+		Start: ast.Position{Offset: offset, Line: line, Column: column},
+		End:   ast.Position{Offset: l.position, Line: l.line, Column: l.column},
+	}
+	d := diagnostic.Errorf(code, span, format, args...)
+	l.diagnostics = append(l.diagnostics, d)
+	return d
+}
+
+func (l *Lexer) NextToken() (tok Token) {
 
 	l.skipWhitespace()
 
-	tok.Line = l.line
-	tok.Column = l.column
+	line := l.line
+	column := l.column
+	offset := l.position
+	// Los tokens construidos en el switch se crean desde cero, así que la
+	// posición se asigna al devolverlos. Los tokens que devuelve una llamada
+	// recursiva ya traen la suya.
+	defer func() {
+		if tok.Line == 0 {
+			tok.Line = line
+			tok.Column = column
+			tok.Offset = offset
+			tok.EndLine = l.line
+			tok.EndColumn = l.column
+			tok.EndOffset = l.position
+		}
+	}()
 
 	switch l.ch {
 	case '=':
@@ -225,6 +338,9 @@ func (l *Lexer) NextToken() Token {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: TOKEN_IGUAL, Value: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = Token{Type: TOKEN_FLECHA, Value: "=>"}
 		} else {
 			tok = Token{Type: TOKEN_ASIGNACION, Value: "="}
 		}
@@ -259,6 +375,10 @@ func (l *Lexer) NextToken() Token {
 			tok = Token{Type: TOKEN_AND, Value: string(ch) + string(l.ch)}
 		} else {
 			tok = Token{Type: TOKEN_ILLEGAL, Value: string(l.ch)}
+			l.readChar()
+			l.report(diagnostic.CodeUnexpectedCharacter, line, column, offset, "carácter no reconocido '&'").
+				WithHint("el operador lógico 'y' se escribe '&&'")
+			return tok
 		}
 	case '|':
 		if l.peekChar() == '|' {
@@ -267,6 +387,10 @@ func (l *Lexer) NextToken() Token {
 			tok = Token{Type: TOKEN_OR, Value: string(ch) + string(l.ch)}
 		} else {
 			tok = Token{Type: TOKEN_ILLEGAL, Value: string(l.ch)}
+			l.readChar()
+			l.report(diagnostic.CodeUnexpectedCharacter, line, column, offset, "carácter no reconocido '|'").
+				WithHint("el operador lógico 'o' se escribe '||'")
+			return tok
 		}
 	case '+':
 		tok = Token{Type: TOKEN_SUMA, Value: "+"}
@@ -286,15 +410,39 @@ func (l *Lexer) NextToken() Token {
 		tok = Token{Type: TOKEN_LLAVE_IZQ, Value: "{"}
 	case '}':
 		tok = Token{Type: TOKEN_LLAVE_DER, Value: "}"}
+	case '[':
+		tok = Token{Type: TOKEN_CORCHETE_IZQ, Value: "["}
+	case ']':
+		tok = Token{Type: TOKEN_CORCHETE_DER, Value: "]"}
 	case ',':
 		tok = Token{Type: TOKEN_COMA, Value: ","}
+	case ':':
+		tok = Token{Type: TOKEN_DOS_PUNTOS, Value: ":"}
 	case '·':
 		tok = Token{Type: TOKEN_PUNTO, Value: "·"}
+	// Operadores Unicode. El valor del token es su equivalente ASCII para
+	// que el resto de fases no tenga que distinguirlos.
+	case '→':
+		tok = Token{Type: TOKEN_ASIGNACION, Value: "="}
+	case '↔':
+		tok = Token{Type: TOKEN_IGUAL, Value: "=="}
+	case '≠':
+		tok = Token{Type: TOKEN_DIFERENTE, Value: "!="}
+	case '≤':
+		tok = Token{Type: TOKEN_MENOR_IGUAL, Value: "<="}
+	case '≥':
+		tok = Token{Type: TOKEN_MAYOR_IGUAL, Value: ">="}
+	case '∧':
+		tok = Token{Type: TOKEN_AND, Value: "&&"}
+	case '∨':
+		tok = Token{Type: TOKEN_OR, Value: "||"}
+	case '¬':
+		tok = Token{Type: TOKEN_NOT, Value: "!"}
 	case '"', '\'':
-		str, err := l.readString()
-		if err != nil {
-			tok = Token{Type: TOKEN_ILLEGAL, Value: err.Error()}
-			return tok
+		str, closed := l.readString()
+		if !closed {
+			l.report(diagnostic.CodeUnterminatedString, line, column, offset, "cadena no cerrada").
+				WithHint("añade %s al final de la cadena", stringDelimiter(str))
 		}
 		tok = Token{Type: TOKEN_CADENA, Value: str}
 		return tok
@@ -303,19 +451,7 @@ func (l *Lexer) NextToken() Token {
 	default:
 		if isLetter(l.ch) {
 			ident := l.readIdentifier()
-			tokType := lookupIdent(ident)
-			if tokType == TOKEN_ILLEGAL {
-				// Es un error de palabra clave mal escrita
-				suggestion := getKeywordSuggestion(ident)
-				tok = Token{
-					Type:   TOKEN_ILLEGAL,
-					Value:  fmt.Sprintf("palabra clave incorrecta '%s' (¿quisiste decir '%s'?)", ident, suggestion),
-					Line:   l.line,
-					Column: l.column,
-				}
-				return tok
-			}
-			tok.Type = tokType
+			tok.Type = lookupIdent(ident)
 			tok.Value = ident
 			return tok
 		} else if isDigit(l.ch) {
@@ -327,17 +463,11 @@ func (l *Lexer) NextToken() Token {
 			}
 			tok.Value = num
 			return tok
-		} else if l.ch == ':' {
-			// Ignorar dos puntos (puede ser parte de comentarios o sintaxis)
-			l.readChar()
-			return l.NextToken()
-		} else if l.ch > 127 {
-			// Caracteres Unicode no reconocidos (probablemente en comentarios o cadenas)
-			// Intentar leer como parte de una cadena o ignorar
-			l.readChar()
-			return l.NextToken()
 		} else if l.ch != 0 {
 			tok = Token{Type: TOKEN_ILLEGAL, Value: string(l.ch)}
+			l.readChar()
+			l.report(diagnostic.CodeUnexpectedCharacter, line, column, offset, "carácter no reconocido '%s'", tok.Value)
+			return tok
 		} else {
 			tok = Token{Type: TOKEN_EOF, Value: ""}
 		}
@@ -347,14 +477,17 @@ func (l *Lexer) NextToken() Token {
 	return tok
 }
 
+// Tokenize lee todos los tokens de la entrada. Los caracteres no reconocidos
+// se descartan y el análisis continúa, de modo que el error devuelto (una
+// diagnostic.List) contiene todos los problemas del archivo. Los tokens se
+// devuelven aunque haya errores.
 func (l *Lexer) Tokenize() ([]Token, error) {
 	var tokens []Token
 
 	for {
 		tok := l.NextToken()
 		if tok.Type == TOKEN_ILLEGAL {
-			// El mensaje de error ya está formateado en el token
-			return nil, fmt.Errorf("línea %d, columna %d: %s", tok.Line, tok.Column, tok.Value)
+			continue
 		}
 		tokens = append(tokens, tok)
 		if tok.Type == TOKEN_EOF {
@@ -362,94 +495,61 @@ func (l *Lexer) Tokenize() ([]Token, error) {
 		}
 	}
 
-	return tokens, nil
+	return tokens, l.diagnostics.Err()
 }
 
-func lookupIdent(ident string) TokenType {
-	keywords := map[string]TokenType{
-		"definir":    TOKEN_DEFINIR,
-		"constante":  TOKEN_CONSTANTE,
-		"función":    TOKEN_FUNCION,
-		"funcion":    TOKEN_FUNCION,
-		"si":         TOKEN_SI,
-		"entonces":   TOKEN_ENTONCES,
-		"sino":       TOKEN_SINO,
-		"mientras":   TOKEN_MIENTRAS,
-		"repetir":    TOKEN_REPETIR,
-		"desde":      TOKEN_DESDE,
-		"hasta":      TOKEN_HASTA,
-		"hacer":      TOKEN_HACER,
-		"fin":        TOKEN_FIN,
-		"mostrar":    TOKEN_MOSTRAR,
-		"retornar":   TOKEN_RETORNAR,
-		"salir":      TOKEN_SALIR,
-		"continuar":  TOKEN_CONTINUAR,
-		"verdadero":  TOKEN_VERDADERO,
-		"falso":      TOKEN_FALSO,
-		"true":       TOKEN_VERDADERO,  // Soporte para inglés
-		"false":      TOKEN_FALSO,      // Soporte para inglés
-		"nulo":       TOKEN_NULO,
+// keywords son las palabras reservadas del lenguaje
+var keywords = map[string]TokenType{
+	"definir":    TOKEN_DEFINIR,
+	"constante":  TOKEN_CONSTANTE,
+	"función":    TOKEN_FUNCION,
+	"funcion":    TOKEN_FUNCION,
+	"si":         TOKEN_SI,
+	"entonces":   TOKEN_ENTONCES,
+	"sino":       TOKEN_SINO,
+	"mientras":   TOKEN_MIENTRAS,
+	"repetir":    TOKEN_REPETIR,
+	"desde":      TOKEN_DESDE,
+	"hasta":      TOKEN_HASTA,
+	"hacer":      TOKEN_HACER,
+	"fin":        TOKEN_FIN,
+	"mostrar":    TOKEN_MOSTRAR,
+	"retornar":   TOKEN_RETORNAR,
+	"salir":      TOKEN_SALIR,
+	"continuar":  TOKEN_CONTINUAR,
+	"intentar":   TOKEN_INTENTAR,
+	"capturar":   TOKEN_CAPTURAR,
+	"finalmente": TOKEN_FINALMENTE,
+	"lanzar":     TOKEN_LANZAR,
+	"verdadero":  TOKEN_VERDADERO,
+	"falso":      TOKEN_FALSO,
+	"true":       TOKEN_VERDADERO, // Soporte para inglés
+	"false":      TOKEN_FALSO,     // Soporte para inglés
+	"nulo":       TOKEN_NULO,
+}
+
+// Keywords devuelve las palabras clave ordenadas, en su forma preferida (sin
+// las variantes sin tilde ni en inglés)
+func Keywords() []string {
+	var names []string
+	for name := range keywords {
+		switch name {
+		case "funcion", "true", "false":
+			continue
+		}
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
+func lookupIdent(ident string) TokenType {
 	if tok, ok := keywords[ident]; ok {
 		return tok
 	}
-
-	// Detectar errores comunes de escritura en palabras clave
-	commonMistakes := map[string]string{
-		"defenir":   "definir",
-		"definr":    "definir",
-		"defnir":    "definir",
-		"defini":    "definir",
-		"definor":   "definir",
-		"constnte":  "constante",
-		"constatne": "constante",
-		"funcio":    "función",
-		"funcion":   "función",
-		"entoces":   "entonces",
-		"entonces":  "entonces",
-		"mientas":   "mientras",
-		"repetr":    "repetir",
-		"repeti":    "repetir",
-		"mostar":    "mostrar",
-		"mostrr":    "mostrar",
-		"retornr":   "retornar",
-		"retorna":   "retornar",
-	}
-
-	if _, ok := commonMistakes[strings.ToLower(ident)]; ok {
-		// Retornar un token especial que indique un error de palabra clave
-		return TOKEN_ILLEGAL
-	}
-
 	return TOKEN_IDENTIFICADOR
 }
 
-func getKeywordSuggestion(ident string) string {
-	suggestions := map[string]string{
-		"defenir":   "definir",
-		"definr":    "definir",
-		"defnir":    "definir",
-		"defini":    "definir",
-		"constnte":  "constante",
-		"constatne": "constante",
-		"funcio":    "función",
-		"entoces":   "entonces",
-		"mientas":   "mientras",
-		"repetr":    "repetir",
-		"repeti":    "repetir",
-		"mostar":    "mostrar",
-		"mostrr":    "mostrar",
-		"retornr":   "retornar",
-		"retorna":   "retornar",
-	}
-
-	if suggestion, ok := suggestions[strings.ToLower(ident)]; ok {
-		return suggestion
-	}
-	return "definir" // Por defecto
-}
-
 func isLetter(ch rune) bool {
 	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_' ||
 		(ch >= 0x00C0 && ch <= 0x024F) || // Latin Extended-A y B (incluye acentos)
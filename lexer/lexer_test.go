@@ -0,0 +1,37 @@
+package lexer
+
+import "testing"
+
+// Un nombre parecido a una palabra clave sigue siendo un nombre, esté donde
+// esté: decidir si es un error le corresponde al parser
+func TestNearKeywordIdentifiers(t *testing.T) {
+	tests := []struct {
+		source string
+		name   string
+	}{
+		{"mostar \"hola\"", "mostar"},
+		{"si x > 1 entoces", "entoces"},
+		{"f(\n    definido\n)", "definido"},
+		{"capturas = 3", "capturas"},
+		{"definido", "definido"},
+	}
+	for _, tt := range tests {
+		tokens, err := New(tt.source).Tokenize()
+		if err != nil {
+			t.Errorf("%q: error inesperado: %v", tt.source, err)
+			continue
+		}
+		found := false
+		for _, tok := range tokens {
+			if tok.Type == TOKEN_IDENTIFICADOR && tok.Value != tt.source[tok.Offset:tok.EndOffset] {
+				t.Errorf("%q: el nombre %q no coincide con el código %q", tt.source, tok.Value, tt.source[tok.Offset:tok.EndOffset])
+			}
+			if tok.Value == tt.name {
+				found = tok.Type == TOKEN_IDENTIFICADOR
+			}
+		}
+		if !found {
+			t.Errorf("%q: '%s' debería ser un identificador", tt.source, tt.name)
+		}
+	}
+}
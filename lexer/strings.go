@@ -0,0 +1,299 @@
+package lexer
+
+import (
+	"flux/ast"
+	"flux/diagnostic"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Las cadenas van entre comillas dobles o simples y terminan en la misma
+// línea. Entre tres comillas ("""...""") pueden ocupar varias líneas. En
+// ambas se admiten secuencias de escape (\n, \t, \u{00F1}...) y expresiones
+// ${...}, cuyo valor se inserta en la cadena.
+//
+// El token de una cadena conserva el texto original; SplitString lo separa
+// en trozos de texto y de código cuando el parser construye el árbol.
+
+// StringPart es un trozo de una cadena literal: texto con los escapes ya
+// resueltos o, si Expr es verdadero, el código de una expresión ${...}
+type StringPart struct {
+	Text string
+	Expr bool
+	Pos  ast.Position // Dónde empieza el trozo en el archivo
+	End  ast.Position
+}
+
+// stringDelimiter devuelve las comillas con las que empieza la cadena s:
+// una comilla o tres si es una cadena de varias líneas
+func stringDelimiter(s string) string {
+	if s == "" {
+		return ""
+	}
+	quote := s[:1]
+	if triple := strings.Repeat(quote, 3); strings.HasPrefix(s, triple) {
+		return triple
+	}
+	return quote
+}
+
+// interpolationEnd busca la llave que cierra una expresión ${...}. s es el
+// código que sigue a "${"; devuelve la posición de la llave en s. Las llaves
+// de los diccionarios y las cadenas dentro de la expresión se saltan.
+func interpolationEnd(s string) (int, bool) {
+	depth := 0
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i, true
+			}
+			depth--
+		case '"', '\'':
+			n, ok := quotedLength(s[i:])
+			if !ok {
+				return 0, false
+			}
+			i += n
+			continue
+		}
+		i++
+	}
+	return 0, false
+}
+
+// quotedLength devuelve la longitud en bytes de la cadena literal con la
+// que empieza s, incluidas sus comillas
+func quotedLength(s string) (int, bool) {
+	delimiter := stringDelimiter(s)
+	multiline := len(delimiter) == 3
+	for i := len(delimiter); i < len(s); {
+		rest := s[i:]
+		switch {
+		case strings.HasPrefix(rest, delimiter):
+			return i + len(delimiter), true
+		case rest[0] == '\n' && !multiline:
+			return 0, false
+		case rest[0] == '\\':
+			i += 2
+		case strings.HasPrefix(rest, "${"):
+			end, ok := interpolationEnd(rest[2:])
+			if !ok {
+				return 0, false
+			}
+			i += 2 + end + 1
+		default:
+			i++
+		}
+	}
+	return 0, false
+}
+
+// stringReader recorre el contenido de una cadena llevando la cuenta de la
+// posición en el archivo
+type stringReader struct {
+	s   string
+	i   int
+	pos ast.Position // Posición de s[i]
+}
+
+func (r *stringReader) rest() string { return r.s[r.i:] }
+
+// advance avanza n bytes
+func (r *stringReader) advance(n int) {
+	for end := r.i + n; r.i < end && r.i < len(r.s); {
+		ch, size := utf8.DecodeRuneInString(r.s[r.i:])
+		if ch == '\n' {
+			r.pos.Line++
+			r.pos.Column = 1
+		} else {
+			r.pos.Column++
+		}
+		r.i += size
+		r.pos.Offset += size
+	}
+}
+
+// SplitString separa una cadena literal (un token TOKEN_CADENA) en trozos
+// de texto y expresiones ${...}, en el orden en que aparecen. Los errores en
+// las secuencias de escape o en las expresiones sin cerrar se devuelven
+// como diagnósticos; el resto de la cadena se sigue analizando.
+//
+// En las cadenas de varias líneas se descarta el salto de línea que sigue a
+// las comillas de apertura. Si las comillas de cierre van solas en su línea,
+// esa línea también se descarta y su sangría se quita de todas las demás,
+// así que la cadena puede sangrarse igual que el código que la rodea.
+func SplitString(tok Token) ([]StringPart, diagnostic.List) {
+	delimiter := stringDelimiter(tok.Value)
+	body := ""
+	if len(tok.Value) >= 2*len(delimiter) {
+		body = tok.Value[len(delimiter) : len(tok.Value)-len(delimiter)]
+	}
+	multiline := len(delimiter) == 3
+
+	indent := ""
+	if multiline {
+		if last := strings.LastIndex(body, "\n"); last >= 0 && strings.Trim(body[last+1:], " \t") == "" {
+			indent = body[last+1:]
+			body = strings.TrimSuffix(body[:last], "\r")
+		}
+	}
+	r := &stringReader{s: body, pos: ast.Position{
+		Offset: tok.Offset + len(delimiter),
+		Line:   tok.Line,
+		Column: tok.Column + len(delimiter),
+	}}
+	lineStart := false
+	if multiline {
+		if strings.HasPrefix(body, "\r\n") {
+			r.advance(2)
+			lineStart = true
+		} else if strings.HasPrefix(body, "\n") {
+			r.advance(1)
+			lineStart = true
+		}
+	}
+
+	var (
+		parts     []StringPart
+		diags     diagnostic.List
+		text      strings.Builder
+		textStart ast.Position
+	)
+	write := func(s string) {
+		if text.Len() == 0 {
+			textStart = r.pos
+		}
+		text.WriteString(s)
+	}
+	flush := func() {
+		if text.Len() > 0 {
+			parts = append(parts, StringPart{Text: text.String(), Pos: textStart, End: r.pos})
+			text.Reset()
+		}
+	}
+
+	for r.i < len(r.s) {
+		if lineStart {
+			lineStart = false
+			if indent != "" && strings.HasPrefix(r.rest(), indent) {
+				r.advance(len(indent))
+				continue
+			}
+		}
+
+		rest := r.rest()
+		switch {
+		case rest[0] == '\\':
+			start := r.pos
+			value, n, ok := decodeEscape(rest)
+			r.advance(n)
+			if ok {
+				write(value)
+				break
+			}
+			span := ast.Span{Start: start, End: r.pos}
+			if strings.HasPrefix(rest, `\u`) {
+				diags = append(diags, diagnostic.Errorf(diagnostic.CodeInvalidEscape, span, "secuencia de escape '%s' no válida", rest[:n]).
+					WithHint("escribe el código del carácter en hexadecimal entre llaves, como \\u{00F1}"))
+			} else {
+				diags = append(diags, diagnostic.Errorf(diagnostic.CodeInvalidEscape, span, "secuencia de escape '%s' desconocida", rest[:n]).
+					WithHint("para escribir una barra invertida usa \\\\"))
+			}
+		case strings.HasPrefix(rest, "${"):
+			end, ok := interpolationEnd(rest[2:])
+			if !ok {
+				start := r.pos
+				r.advance(len(rest))
+				diags = append(diags, diagnostic.Errorf(diagnostic.CodeUnclosedInterpolation, ast.Span{Start: start, End: r.pos}, "falta '}' para cerrar '${'").
+					WithHint("para escribir '${' literalmente usa \\${"))
+				break
+			}
+			flush()
+			r.advance(2)
+			part := StringPart{Text: rest[2 : 2+end], Expr: true, Pos: r.pos}
+			r.advance(end)
+			part.End = r.pos
+			r.advance(1)
+			parts = append(parts, part)
+		case multiline && strings.HasPrefix(rest, "\r\n"):
+			write("\n")
+			r.advance(2)
+			lineStart = true
+		case rest[0] == '\n':
+			write("\n")
+			r.advance(1)
+			lineStart = true
+		default:
+			_, size := utf8.DecodeRuneInString(rest)
+			write(rest[:size])
+			r.advance(size)
+		}
+	}
+	flush()
+	return parts, diags
+}
+
+// decodeEscape interpreta la secuencia de escape con la que empieza s.
+// Devuelve el texto que representa y los bytes que ocupa; ok es falso si la
+// secuencia no es válida.
+func decodeEscape(s string) (value string, n int, ok bool) {
+	if len(s) < 2 {
+		return "", len(s), false
+	}
+	switch s[1] {
+	case 'n':
+		return "\n", 2, true
+	case 't':
+		return "\t", 2, true
+	case 'r':
+		return "\r", 2, true
+	case '\\', '"', '\'', '$':
+		return s[1:2], 2, true
+	case 'u':
+		// \u{XXXX}: de 1 a 6 cifras hexadecimales
+		end := strings.IndexByte(s, '}')
+		if !strings.HasPrefix(s[2:], "{") || end < 0 || end > 9 {
+			return "", 2, false
+		}
+		code, err := strconv.ParseUint(s[3:end], 16, 32)
+		if err != nil || end == 3 || !utf8.ValidRune(rune(code)) {
+			return "", end + 1, false
+		}
+		return string(rune(code)), end + 1, true
+	default:
+		_, size := utf8.DecodeRuneInString(s[1:])
+		return "", 1 + size, false
+	}
+}
+
+// TokenizeAt analiza el código de una expresión ${...} que empieza en pos
+// dentro del archivo, para que los tokens y los errores tengan su posición
+// real
+func TokenizeAt(input string, pos ast.Position) ([]Token, diagnostic.List) {
+	l := New(input)
+	tokens, _ := l.Tokenize()
+
+	for i := range tokens {
+		tok := &tokens[i]
+		tok.Line, tok.Column, tok.Offset = shift(pos, tok.Line, tok.Column, tok.Offset)
+		tok.EndLine, tok.EndColumn, tok.EndOffset = shift(pos, tok.EndLine, tok.EndColumn, tok.EndOffset)
+	}
+	for _, d := range l.diagnostics {
+		d.Span.Start.Line, d.Span.Start.Column, d.Span.Start.Offset = shift(pos, d.Span.Start.Line, d.Span.Start.Column, d.Span.Start.Offset)
+		d.Span.End.Line, d.Span.End.Column, d.Span.End.Offset = shift(pos, d.Span.End.Line, d.Span.End.Column, d.Span.End.Offset)
+	}
+	return tokens, l.diagnostics
+}
+
+// shift convierte una posición relativa al código de una expresión en una
+// posición del archivo. Solo la primera línea empieza a mitad de línea.
+func shift(pos ast.Position, line, column, offset int) (int, int, int) {
+	if line == 1 {
+		column += pos.Column - 1
+	}
+	return line + pos.Line - 1, column, offset + pos.Offset
+}
@@ -0,0 +1,158 @@
+package lsp
+
+import (
+	"flux/ast"
+	"flux/diagnostic"
+	"flux/lexer"
+	"flux/parser"
+	"flux/semantic"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// document es un archivo abierto en el editor y el resultado de analizarlo
+type document struct {
+	uri        string
+	version    int
+	text       string
+	lineStarts []int // Posición en bytes del inicio de cada línea
+
+	comments    []lexer.Comment
+	diagnostics diagnostic.List
+	index       *index // Nombres del programa, aunque tenga errores de sintaxis
+}
+
+// newDocument analiza el texto de un documento. El programa se indexa
+// aunque tenga errores, con las sentencias que el parser sí entendió.
+func newDocument(uri string, version int, text string, predeclared, constants []string, dynamicScope bool) *document {
+	text = strings.TrimPrefix(text, "\uFEFF")
+	d := &document{uri: uri, version: version, text: text, lineStarts: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+
+	l := lexer.New(text)
+	tokens, _ := l.Tokenize()
+	d.comments = l.Comments()
+	p := parser.New(tokens)
+	program, _ := p.Parse()
+	d.diagnostics = append(l.Diagnostics(), p.Errors()...)
+
+	// El análisis semántico solo tiene sentido si el programa está completo
+	if !d.diagnostics.HasErrors() {
+		analyzer := semantic.New(predeclared, constants)
+		analyzer.SetDynamicScope(dynamicScope)
+		analyzer.Analyze(program)
+		d.diagnostics = append(d.diagnostics, analyzer.Errors()...)
+	}
+	d.diagnostics.Sort()
+
+	d.index = newIndex(program, predeclared, constants)
+	return d
+}
+
+// position convierte una posición en bytes a una posición del protocolo
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	line := sort.Search(len(d.lineStarts), func(i int) bool { return d.lineStarts[i] > offset }) - 1
+	character := 0
+	for _, r := range d.text[d.lineStarts[line]:offset] {
+		character += utf16Len(r)
+	}
+	return Position{Line: line, Character: character}
+}
+
+// offset convierte una posición del protocolo a una posición en bytes. Las
+// posiciones fuera de la línea o del documento se ajustan a su final.
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lineStarts) {
+		return len(d.text)
+	}
+	offset := d.lineStarts[pos.Line]
+	for character := 0; offset < len(d.text) && character < pos.Character; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		if r == '\n' {
+			break
+		}
+		character += utf16Len(r)
+		offset += size
+	}
+	return offset
+}
+
+func (d *document) rangeOf(span ast.Span) Range {
+	return Range{Start: d.position(span.Start.Offset), End: d.position(span.End.Offset)}
+}
+
+// utf16Len es el número de unidades UTF-16 que ocupa un carácter
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// source devuelve el código de un fragmento
+func (d *document) source(span ast.Span) string {
+	return d.text[span.Start.Offset:span.End.Offset]
+}
+
+// protocolDiagnostics convierte los diagnósticos al formato del protocolo. La
+// sugerencia, si la hay, se añade al mensaje.
+func (d *document) protocolDiagnostics() []Diagnostic {
+	result := make([]Diagnostic, 0, len(d.diagnostics))
+	for _, diag := range d.diagnostics {
+		severity := severityError
+		switch diag.Severity {
+		case diagnostic.Warning:
+			severity = severityWarning
+		case diagnostic.Note:
+			severity = severityInformation
+		}
+		message := diag.Message
+		if diag.Hint != "" {
+			message += "\nayuda: " + diag.Hint
+		}
+		result = append(result, Diagnostic{
+			Range:    d.rangeOf(diag.Span),
+			Severity: severity,
+			Code:     diag.Code,
+			Source:   "flux",
+			Message:  message,
+		})
+	}
+	return result
+}
+
+// docComment devuelve los comentarios de línea que preceden inmediatamente a
+// la sentencia que empieza en la línea line, sin las barras
+func (d *document) docComment(line int) string {
+	var lines []string
+	want := line - 1
+	for i := len(d.comments) - 1; i >= 0; i-- {
+		c := d.comments[i]
+		if c.Line > want {
+			continue
+		}
+		if c.EndLine != want || !strings.HasPrefix(c.Text, "//") || !d.ownLine(c) {
+			break
+		}
+		lines = append([]string{strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))}, lines...)
+		want--
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ownLine indica si el comentario está solo en su línea
+func (d *document) ownLine(c lexer.Comment) bool {
+	lineStart := strings.LastIndexByte(d.text[:c.Offset], '\n') + 1
+	return strings.TrimSpace(d.text[lineStart:c.Offset]) == ""
+}
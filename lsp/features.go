@@ -0,0 +1,251 @@
+package lsp
+
+import (
+	"encoding/json"
+	"flux/ast"
+	"flux/lexer"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSignature es la longitud máxima de una declaración que se muestra
+// completa al pasar el cursor; las más largas se resumen
+const maxSignature = 80
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	doc, occ, ok, err := s.lookup(params)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "```flux\n%s\n```", doc.signature(occ.sym))
+	if occ.sym.kind == symFunction || occ.sym.kind == symVariable || occ.sym.kind == symConstant {
+		if comment := doc.docComment(occ.sym.node.Span().Start.Line); comment != "" {
+			fmt.Fprintf(&sb, "\n\n%s", comment)
+		}
+	}
+	fmt.Fprintf(&sb, "\n\n%s", describe(occ.sym))
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: sb.String()},
+		Range:    doc.rangeOf(occ.ident.Loc),
+	}, nil
+}
+
+// signature es el código que se muestra para un símbolo: la cabecera de una
+// función o la declaración de una variable
+func (d *document) signature(sym *symbol) string {
+	switch sym.kind {
+	case symFunction:
+		return "función " + sym.name + parameterList(sym.params)
+	case symBuiltin:
+		return "función " + sym.name + "(...)"
+	case symBuiltinConstant:
+		return "constante " + sym.name
+	case symParameter:
+		return sym.name
+	case symLoop:
+		return "repetir " + sym.name
+	case symCatch:
+		return "capturar " + sym.name
+	}
+	// Variables y constantes: la declaración completa si es corta
+	text := d.source(sym.node.Span())
+	if !strings.Contains(text, "\n") && utf8.RuneCountInString(text) <= maxSignature {
+		return text
+	}
+	if sym.params != nil {
+		return "definir " + sym.name + " = función" + parameterList(sym.params)
+	}
+	if sym.kind == symConstant {
+		return "constante " + sym.name
+	}
+	return "definir " + sym.name
+}
+
+func parameterList(params []*ast.Identifier) string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Value
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+// describe explica qué es un símbolo y dónde se declara
+func describe(sym *symbol) string {
+	switch sym.kind {
+	case symBuiltin:
+		return "Función predefinida."
+	case symBuiltinConstant:
+		return "Constante predefinida."
+	}
+	line := sym.decl.Loc.Start.Line
+	switch sym.kind {
+	case symFunction:
+		return fmt.Sprintf("Función declarada en la línea %d.", line)
+	case symConstant:
+		return fmt.Sprintf("Constante declarada en la línea %d.", line)
+	case symParameter:
+		if owner := sym.scope.owner; owner != nil {
+			return fmt.Sprintf("Parámetro de la función '%s'.", owner.name)
+		}
+		return fmt.Sprintf("Parámetro de la función anónima de la línea %d.", line)
+	case symLoop:
+		return fmt.Sprintf("Variable del bucle 'repetir' de la línea %d.", line)
+	case symCatch:
+		return fmt.Sprintf("Error capturado en la línea %d.", line)
+	default:
+		return fmt.Sprintf("Variable declarada en la línea %d.", line)
+	}
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	doc, occ, ok, err := s.lookup(params)
+	if err != nil || !ok || occ.sym.decl == nil {
+		return nil, err
+	}
+	return Location{URI: doc.uri, Range: doc.rangeOf(occ.sym.decl.Loc)}, nil
+}
+
+// completion propone las palabras clave y los nombres visibles en la
+// posición del cursor. El editor filtra la lista según lo que se escribe.
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []CompletionItem{}
+	for _, sym := range doc.index.scopeAt(doc.offset(p.Position)).visible() {
+		item := CompletionItem{Label: sym.name, Kind: completionVariable, Detail: doc.signature(sym)}
+		switch sym.kind {
+		case symFunction, symBuiltin:
+			item.Kind = completionFunction
+		case symConstant, symBuiltinConstant:
+			item.Kind = completionConstant
+		}
+		items = append(items, item)
+	}
+	for _, keyword := range lexer.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: completionKeyword})
+	}
+	return items, nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return doc.outline(doc.index.program), nil
+}
+
+// outline devuelve los símbolos declarados en un scope. Las funciones
+// incluyen como hijos lo que se declara dentro de ellas; los parámetros no
+// se muestran.
+func (d *document) outline(sc *scope) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, sym := range sc.symbols {
+		if sym.kind == symParameter {
+			continue
+		}
+		ds := DocumentSymbol{
+			Name:           sym.name,
+			Kind:           symbolKindVariable,
+			Range:          d.rangeOf(sym.node.Span()),
+			SelectionRange: d.rangeOf(sym.decl.Loc),
+		}
+		switch sym.kind {
+		case symFunction:
+			ds.Kind = symbolKindFunction
+			ds.Detail = parameterList(sym.params)
+			for _, child := range sc.children {
+				if child.owner == sym {
+					ds.Children = d.outline(child)
+				}
+			}
+		case symConstant:
+			ds.Kind = symbolKindConstant
+		}
+		symbols = append(symbols, ds)
+	}
+	return symbols
+}
+
+// renameTarget devuelve el símbolo que se puede renombrar en la posición
+// indicada, o un error que explica por qué no
+func (s *Server) renameTarget(doc *document, pos Position) (occurrence, error) {
+	occ, ok := doc.index.at(doc.offset(pos))
+	if !ok {
+		return occurrence{}, errorf(codeRequestFailed, "aquí no hay ningún nombre que renombrar")
+	}
+	switch occ.sym.kind {
+	case symBuiltin:
+		return occurrence{}, errorf(codeRequestFailed, "'%s' es una función predefinida y no se puede renombrar", occ.sym.name)
+	case symBuiltinConstant:
+		return occurrence{}, errorf(codeRequestFailed, "'%s' es una constante predefinida y no se puede renombrar", occ.sym.name)
+	}
+	return occ, nil
+}
+
+func (s *Server) prepareRename(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	occ, err := s.renameTarget(doc, p.Position)
+	if err != nil {
+		return nil, err
+	}
+	return doc.rangeOf(occ.ident.Loc), nil
+}
+
+// rename cambia el nombre en su declaración y en todos sus usos
+func (s *Server) rename(params json.RawMessage) (interface{}, error) {
+	var p RenameParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	occ, err := s.renameTarget(doc, p.Position)
+	if err != nil {
+		return nil, err
+	}
+	if !isIdentifier(p.NewName) {
+		return nil, errorf(codeInvalidParams, "'%s' no es un nombre válido", p.NewName)
+	}
+	if other := occ.sym.scope.lookup(p.NewName); other != nil && other != occ.sym && other.kind != symBuiltin {
+		return nil, errorf(codeRequestFailed, "ya existe '%s' en este scope", p.NewName)
+	}
+
+	edits := make([]TextEdit, len(occ.sym.refs))
+	for i, ref := range occ.sym.refs {
+		edits[i] = TextEdit{Range: doc.rangeOf(ref.Loc), NewText: p.NewName}
+	}
+	return WorkspaceEdit{Changes: map[string][]TextEdit{doc.uri: edits}}, nil
+}
+
+// isIdentifier indica si el texto es un único identificador (no una palabra
+// clave)
+func isIdentifier(name string) bool {
+	l := lexer.New(name)
+	tokens, err := l.Tokenize()
+	return err == nil && len(tokens) == 2 &&
+		tokens[0].Type == lexer.TOKEN_IDENTIFICADOR && tokens[0].Value == name &&
+		tokens[1].Type == lexer.TOKEN_EOF
+}
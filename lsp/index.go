@@ -0,0 +1,307 @@
+package lsp
+
+import (
+	"flux/ast"
+	"sort"
+)
+
+type symbolKind int
+
+const (
+	symVariable        symbolKind = iota // definir, o asignación a un nombre nuevo
+	symConstant                          // constante
+	symFunction                          // función nombre(...)
+	symParameter                         // Parámetro de función
+	symLoop                              // Variable de repetir
+	symCatch                             // Nombre del error en capturar
+	symBuiltin                           // Función predefinida
+	symBuiltinConstant                   // Constante predefinida, como PI
+)
+
+// symbol es un nombre declarado en el programa o predefinido
+type symbol struct {
+	name   string
+	kind   symbolKind
+	decl   *ast.Identifier // Dónde se declara; nil si es predefinido
+	node   ast.Node        // Sentencia que lo declara
+	params []*ast.Identifier
+	scope  *scope            // Scope en el que se declara
+	refs   []*ast.Identifier // Todos los usos, incluida la declaración
+}
+
+// scope sigue las reglas del evaluador: solo las funciones crean uno nuevo
+type scope struct {
+	names    map[string]*symbol
+	symbols  []*symbol // Declarados en este scope, en orden
+	parent   *scope
+	children []*scope
+	span     ast.Span // Código que abarca (el programa entero en la raíz)
+	owner    *symbol  // Función a la que pertenece, o nil
+}
+
+func newScope(parent *scope, span ast.Span, owner *symbol) *scope {
+	sc := &scope{names: make(map[string]*symbol), parent: parent, span: span, owner: owner}
+	if parent != nil {
+		parent.children = append(parent.children, sc)
+	}
+	return sc
+}
+
+func (s *scope) lookup(name string) *symbol {
+	for sc := s; sc != nil; sc = sc.parent {
+		if sym, ok := sc.names[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// occurrence es un identificador del código y el símbolo al que se refiere
+type occurrence struct {
+	ident *ast.Identifier
+	sym   *symbol
+}
+
+// index relaciona cada identificador del programa con su declaración
+type index struct {
+	program     *scope
+	occurrences []occurrence // Ordenadas por posición
+}
+
+// newIndex resuelve los nombres del programa. Los cuerpos de las funciones
+// se recorren al terminar el scope que las contiene, como en el análisis
+// semántico, para que vean los nombres declarados después de ellas.
+func newIndex(program *ast.Program, predeclared, constants []string) *index {
+	globals := newScope(nil, ast.Span{}, nil)
+	for _, name := range predeclared {
+		sym := &symbol{name: name, kind: symBuiltin, scope: globals}
+		globals.names[name] = sym
+	}
+	for _, name := range constants {
+		sym := &symbol{name: name, kind: symBuiltinConstant, scope: globals}
+		globals.names[name] = sym
+	}
+	x := &indexer{idx: &index{}}
+	x.idx.program = newScope(globals, program.Loc, nil)
+	x.walkBody(program.Statements, x.idx.program)
+
+	sort.SliceStable(x.idx.occurrences, func(i, j int) bool {
+		return x.idx.occurrences[i].ident.Loc.Start.Offset < x.idx.occurrences[j].ident.Loc.Start.Offset
+	})
+	return x.idx
+}
+
+// at devuelve el identificador que ocupa la posición offset. Una posición
+// justo al final del nombre también cuenta, como cuando el cursor acaba de
+// escribirlo.
+func (x *index) at(offset int) (occurrence, bool) {
+	i := sort.Search(len(x.occurrences), func(i int) bool {
+		return x.occurrences[i].ident.Loc.End.Offset >= offset
+	})
+	if i < len(x.occurrences) && x.occurrences[i].ident.Loc.Start.Offset <= offset {
+		return x.occurrences[i], true
+	}
+	return occurrence{}, false
+}
+
+// scopeAt devuelve el scope más interno que contiene la posición offset
+func (x *index) scopeAt(offset int) *scope {
+	sc := x.program
+	for {
+		inner := (*scope)(nil)
+		for _, child := range sc.children {
+			if child.span.Start.Offset <= offset && offset <= child.span.End.Offset {
+				inner = child
+				break
+			}
+		}
+		if inner == nil {
+			return sc
+		}
+		sc = inner
+	}
+}
+
+// visible devuelve los símbolos visibles desde un scope. Un nombre de un
+// scope interno oculta al mismo nombre de los externos.
+func (s *scope) visible() []*symbol {
+	seen := make(map[string]bool)
+	var result []*symbol
+	for sc := s; sc != nil; sc = sc.parent {
+		names := make([]string, 0, len(sc.names))
+		for name := range sc.names {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				result = append(result, sc.names[name])
+			}
+		}
+	}
+	return result
+}
+
+// pendingBody es el cuerpo de una función que se recorre al terminar el
+// scope que la contiene
+type pendingBody struct {
+	self   *symbol // Función declarada, o nil si es anónima
+	params []*ast.Identifier
+	body   *ast.BlockStatement
+	span   ast.Span
+	parent *scope
+}
+
+type indexer struct {
+	idx     *index
+	pending []pendingBody
+}
+
+func (x *indexer) declare(sc *scope, ident *ast.Identifier, kind symbolKind, node ast.Node) *symbol {
+	sym := &symbol{name: ident.Value, kind: kind, decl: ident, node: node, scope: sc}
+	sc.names[ident.Value] = sym
+	sc.symbols = append(sc.symbols, sym)
+	x.reference(ident, sym)
+	return sym
+}
+
+func (x *indexer) reference(ident *ast.Identifier, sym *symbol) {
+	sym.refs = append(sym.refs, ident)
+	x.idx.occurrences = append(x.idx.occurrences, occurrence{ident: ident, sym: sym})
+}
+
+func (x *indexer) use(ident *ast.Identifier, sc *scope) {
+	if sym := sc.lookup(ident.Value); sym != nil {
+		x.reference(ident, sym)
+	}
+}
+
+func (x *indexer) walkBody(statements []ast.Statement, sc *scope) {
+	outerPending := x.pending
+	x.pending = nil
+
+	for _, stmt := range statements {
+		x.walkStatement(stmt, sc)
+	}
+
+	pending := x.pending
+	x.pending = outerPending
+	for _, fn := range pending {
+		fnScope := newScope(fn.parent, fn.span, fn.self)
+		for _, param := range fn.params {
+			x.declare(fnScope, param, symParameter, param)
+		}
+		if fn.body != nil {
+			x.walkBody(fn.body.Statements, fnScope)
+		}
+	}
+}
+
+func (x *indexer) walkBlock(block *ast.BlockStatement, sc *scope) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		x.walkStatement(stmt, sc)
+	}
+}
+
+func (x *indexer) walkStatement(stmt ast.Statement, sc *scope) {
+	switch s := stmt.(type) {
+	case *ast.DeclareStatement:
+		x.walkExpression(s.Value, sc)
+		kind := symVariable
+		if s.IsConst {
+			kind = symConstant
+		}
+		sym := x.declare(sc, s.Name, kind, s)
+		if fn, ok := s.Value.(*ast.FunctionLiteral); ok {
+			sym.params = fn.Parameters
+		}
+	case *ast.AssignStatement:
+		x.walkExpression(s.Value, sc)
+		// Asignar a un nombre nuevo lo declara en el scope actual
+		if sym := sc.lookup(s.Name.Value); sym != nil {
+			x.reference(s.Name, sym)
+		} else {
+			x.declare(sc, s.Name, symVariable, s)
+		}
+	case *ast.IndexAssignStatement:
+		x.walkExpression(s.Target, sc)
+		x.walkExpression(s.Value, sc)
+	case *ast.IfStatement:
+		x.walkExpression(s.Condition, sc)
+		x.walkBlock(s.Then, sc)
+		x.walkBlock(s.Else, sc)
+	case *ast.WhileStatement:
+		x.walkExpression(s.Condition, sc)
+		x.walkBlock(s.Body, sc)
+	case *ast.RepeatStatement:
+		x.walkExpression(s.From, sc)
+		x.walkExpression(s.To, sc)
+		// repetir reutiliza la variable si ya existe en el scope actual
+		if sym, ok := sc.names[s.Variable.Value]; ok {
+			x.reference(s.Variable, sym)
+		} else {
+			x.declare(sc, s.Variable, symLoop, s)
+		}
+		x.walkBlock(s.Body, sc)
+	case *ast.FunctionStatement:
+		self := x.declare(sc, s.Name, symFunction, s)
+		self.params = s.Parameters
+		x.pending = append(x.pending, pendingBody{self: self, params: s.Parameters, body: s.Body, span: s.Loc, parent: sc})
+	case *ast.TryStatement:
+		x.walkBlock(s.Body, sc)
+		if s.CatchName != nil {
+			x.declare(sc, s.CatchName, symCatch, s)
+		}
+		x.walkBlock(s.Catch, sc)
+		x.walkBlock(s.Finally, sc)
+	case *ast.ThrowStatement:
+		x.walkExpression(s.Value, sc)
+	case *ast.ShowStatement:
+		x.walkExpression(s.Value, sc)
+	case *ast.ReturnStatement:
+		x.walkExpression(s.Value, sc)
+	case *ast.ExpressionStatement:
+		x.walkExpression(s.Expression, sc)
+	case *ast.BlockStatement:
+		x.walkBlock(s, sc)
+	}
+}
+
+func (x *indexer) walkExpression(expr ast.Expression, sc *scope) {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		x.use(e, sc)
+	case *ast.InfixExpression:
+		x.walkExpression(e.Left, sc)
+		x.walkExpression(e.Right, sc)
+	case *ast.PrefixExpression:
+		x.walkExpression(e.Right, sc)
+	case *ast.ListLiteral:
+		for _, el := range e.Elements {
+			x.walkExpression(el, sc)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range e.Parts {
+			x.walkExpression(part, sc)
+		}
+	case *ast.DictLiteral:
+		for _, pair := range e.Pairs {
+			x.walkExpression(pair.Key, sc)
+			x.walkExpression(pair.Value, sc)
+		}
+	case *ast.IndexExpression:
+		x.walkExpression(e.Left, sc)
+		x.walkExpression(e.Index, sc)
+	case *ast.CallExpression:
+		x.walkExpression(e.Function, sc)
+		for _, arg := range e.Arguments {
+			x.walkExpression(arg, sc)
+		}
+	case *ast.FunctionLiteral:
+		x.pending = append(x.pending, pendingBody{params: e.Parameters, body: e.Body, span: e.Loc, parent: sc})
+	}
+}
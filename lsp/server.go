@@ -0,0 +1,265 @@
+// Package lsp implementa un servidor del Language Server Protocol para Flux.
+// Se comunica por la entrada y la salida estándar con JSON-RPC y ofrece
+// diagnósticos mientras se escribe, información al pasar el cursor, ir a la
+// definición, autocompletado, el esquema del documento y renombrar.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// handler responde a una petición. Si devuelve un *responseError, se envía
+// tal cual al cliente.
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var requests = map[string]handler{
+	"initialize":                  (*Server).initialize,
+	"shutdown":                    (*Server).shutdown,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/completion":     (*Server).completion,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/prepareRename":  (*Server).prepareRename,
+	"textDocument/rename":         (*Server).rename,
+}
+
+// notificationHandler procesa una notificación, que no tiene respuesta
+type notificationHandler func(s *Server, params json.RawMessage) error
+
+var notifications = map[string]notificationHandler{
+	"initialized":            func(*Server, json.RawMessage) error { return nil },
+	"textDocument/didOpen":   (*Server).didOpen,
+	"textDocument/didChange": (*Server).didChange,
+	"textDocument/didClose":  (*Server).didClose,
+}
+
+// Server es el estado del servidor: los documentos abiertos y en qué punto
+// del ciclo de vida está la sesión
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+	log io.Writer
+
+	predeclared  []string
+	constants    []string
+	dynamicScope bool
+	documents    map[string]*document
+
+	initialized  bool
+	shuttingDown bool
+}
+
+// NewServer crea un servidor que lee los mensajes de in, escribe las
+// respuestas en out y los problemas internos en log. predeclared son los
+// nombres disponibles sin declararlos (las funciones predefinidas) y
+// constants las constantes predefinidas, como PI.
+func NewServer(in io.Reader, out, log io.Writer, predeclared, constants []string) *Server {
+	return &Server{
+		in:          bufio.NewReader(in),
+		out:         out,
+		log:         log,
+		predeclared: predeclared,
+		constants:   constants,
+		documents:   make(map[string]*document),
+	}
+}
+
+// SetDynamicScope hace que los diagnósticos sigan el scope dinámico de
+// compatibilidad, como la opción --alcance-dinamico
+func (s *Server) SetDynamicScope(enabled bool) {
+	s.dynamicScope = enabled
+}
+
+// Run atiende mensajes hasta recibir 'exit' o hasta que se cierre la
+// entrada. Devuelve el código de salida: 0 si la sesión terminó con
+// 'shutdown' y 'exit', 1 en cualquier otro caso.
+func (s *Server) Run() int {
+	for {
+		body, err := readMessage(s.in)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(s.log, "flux lsp: %v\n", err)
+			}
+			return 1
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.reply(nil, nil, errorf(codeParseError, "mensaje no válido: %v", err))
+			continue
+		}
+		if msg.Method == "exit" {
+			if s.shuttingDown {
+				return 0
+			}
+			return 1
+		}
+		if msg.isRequest() {
+			result, err := s.handleRequest(&msg)
+			s.reply(msg.ID, result, err)
+		} else if err := s.handleNotification(&msg); err != nil {
+			fmt.Fprintf(s.log, "flux lsp: %s: %v\n", msg.Method, err)
+		}
+	}
+}
+
+func (s *Server) handleRequest(msg *message) (result interface{}, err error) {
+	// Un fallo al atender una petición no debe cerrar el servidor
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, errorf(codeInternalError, "error interno en %s: %v", msg.Method, r)
+		}
+	}()
+
+	h, ok := requests[msg.Method]
+	switch {
+	case !ok:
+		return nil, errorf(codeMethodNotFound, "método desconocido '%s'", msg.Method)
+	case !s.initialized && msg.Method != "initialize":
+		return nil, errorf(codeServerNotInitialized, "el servidor aún no se ha inicializado")
+	case s.shuttingDown:
+		return nil, errorf(codeInvalidRequest, "el servidor se está cerrando")
+	}
+	return h(s, msg.Params)
+}
+
+func (s *Server) handleNotification(msg *message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("error interno: %v", r)
+		}
+	}()
+
+	h, ok := notifications[msg.Method]
+	if !ok || !s.initialized {
+		// Las notificaciones desconocidas (como las que empiezan por '$/') se ignoran
+		return nil
+	}
+	return h(s, msg.Params)
+}
+
+func (s *Server) reply(id json.RawMessage, result interface{}, err error) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	var msg interface{} = response{JSONRPC: "2.0", ID: id, Result: result}
+	if err != nil {
+		respErr, ok := err.(*responseError)
+		if !ok {
+			respErr = errorf(codeRequestFailed, "%v", err)
+		}
+		msg = errorResponse{JSONRPC: "2.0", ID: id, Error: respErr}
+	}
+	if err := writeMessage(s.out, msg); err != nil {
+		fmt.Fprintf(s.log, "flux lsp: %v\n", err)
+	}
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	if err := writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params}); err != nil {
+		fmt.Fprintf(s.log, "flux lsp: %v\n", err)
+	}
+}
+
+// decode lee los parámetros de un mensaje
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return errorf(codeInvalidParams, "parámetros no válidos: %v", err)
+	}
+	return nil
+}
+
+// Ciclo de vida
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	s.initialized = true
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:       syncFull,
+			HoverProvider:          true,
+			DefinitionProvider:     true,
+			CompletionProvider:     map[string]interface{}{},
+			DocumentSymbolProvider: true,
+			RenameProvider:         map[string]bool{"prepareProvider": true},
+		},
+		ServerInfo: ServerInfo{Name: "flux"},
+	}, nil
+}
+
+func (s *Server) shutdown(params json.RawMessage) (interface{}, error) {
+	s.shuttingDown = true
+	return nil, nil
+}
+
+// Documentos
+
+func (s *Server) didOpen(params json.RawMessage) error {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	s.update(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text)
+	return nil
+}
+
+func (s *Server) didChange(params json.RawMessage) error {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil
+	}
+	// Con sincronización completa, el último cambio trae el texto entero
+	text := p.ContentChanges[len(p.ContentChanges)-1].Text
+	s.update(p.TextDocument.URI, p.TextDocument.Version, text)
+	return nil
+}
+
+func (s *Server) didClose(params json.RawMessage) error {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	delete(s.documents, p.TextDocument.URI)
+	// Al cerrar el documento se borran sus diagnósticos del editor
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+	return nil
+}
+
+// update vuelve a analizar un documento y publica sus diagnósticos
+func (s *Server) update(uri string, version int, text string) {
+	doc := newDocument(uri, version, text, s.predeclared, s.constants, s.dynamicScope)
+	s.documents[uri] = doc
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Version:     version,
+		Diagnostics: doc.protocolDiagnostics(),
+	})
+}
+
+// document devuelve un documento abierto
+func (s *Server) document(uri string) (*document, error) {
+	doc, ok := s.documents[uri]
+	if !ok {
+		return nil, errorf(codeInvalidParams, "el documento '%s' no está abierto", uri)
+	}
+	return doc, nil
+}
+
+// lookup devuelve el documento y el identificador en la posición indicada
+func (s *Server) lookup(params json.RawMessage) (*document, occurrence, bool, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, occurrence{}, false, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, occurrence{}, false, err
+	}
+	occ, ok := doc.index.at(doc.offset(p.Position))
+	return doc, occ, ok, nil
+}
@@ -0,0 +1,264 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"flux/evaluator"
+	"io"
+	"testing"
+)
+
+// client habla con un Server por tuberías, como lo haría un editor
+type client struct {
+	t      *testing.T
+	in     *io.PipeWriter // Lo que lee el servidor
+	out    *bufio.Reader  // Lo que escribe el servidor
+	nextID int
+	status chan int // Código de salida de Run
+
+	notifications []received // Notificaciones recibidas mientras se esperaba una respuesta
+}
+
+func newClient(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, in: inW, out: bufio.NewReader(outR), status: make(chan int, 1)}
+	server := NewServer(inR, outW, io.Discard, evaluator.BuiltinNames(), evaluator.ConstantNames())
+	go func() {
+		c.status <- server.Run()
+		outW.Close()
+	}()
+	t.Cleanup(func() { inW.Close() })
+	return c
+}
+
+func (c *client) send(msg interface{}) {
+	c.t.Helper()
+	if err := writeMessage(c.in, msg); err != nil {
+		c.t.Fatalf("no se pudo enviar el mensaje: %v", err)
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	c.send(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// received es un mensaje del servidor: una respuesta o una notificación
+type received struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// read lee el siguiente mensaje del servidor
+func (c *client) read() received {
+	c.t.Helper()
+	body, err := readMessage(c.out)
+	if err != nil {
+		c.t.Fatalf("no se pudo leer la respuesta: %v", err)
+	}
+	var msg received
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatalf("respuesta no válida %s: %v", body, err)
+	}
+	return msg
+}
+
+// call envía una petición y espera su respuesta. Devuelve el resultado o,
+// si el servidor respondió con un error, el error.
+func (c *client) call(method string, params interface{}) (json.RawMessage, *responseError) {
+	c.t.Helper()
+	c.nextID++
+	id, _ := json.Marshal(c.nextID)
+	c.send(struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Method  string          `json:"method"`
+		Params  interface{}     `json:"params"`
+	}{"2.0", id, method, params})
+
+	for {
+		msg := c.read()
+		if string(msg.ID) != string(id) {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		return msg.Result, msg.Error
+	}
+}
+
+// result hace una petición que debe salir bien y decodifica el resultado
+func (c *client) result(method string, params, v interface{}) {
+	c.t.Helper()
+	raw, err := c.call(method, params)
+	if err != nil {
+		c.t.Fatalf("%s: error %d: %s", method, err.Code, err.Message)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		c.t.Fatalf("%s: resultado no válido %s: %v", method, raw, err)
+	}
+}
+
+const testURI = "file:///prueba.flux"
+
+// El emoji ocupa dos unidades UTF-16, así que las columnas que siguen a él
+// en la misma línea no coinciden con el número de caracteres
+const testSource = `// Suma dos números
+función sumar(a, b) hacer
+    retornar a + b
+fin
+definir total = sumar(1, 2)
+mostrar("😀😀" + total)
+mostrar("😀" + desconocido)
+`
+
+func position(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func TestServerSession(t *testing.T) {
+	c := newClient(t)
+
+	if _, err := c.call("textDocument/hover", position(0, 0)); err == nil || err.Code != codeServerNotInitialized {
+		t.Fatalf("antes de initialize se esperaba el error %d, pero llegó %v", codeServerNotInitialized, err)
+	}
+
+	var init InitializeResult
+	c.result("initialize", map[string]interface{}{}, &init)
+	if init.ServerInfo.Name != "flux" || !init.Capabilities.HoverProvider || init.Capabilities.TextDocumentSync != syncFull {
+		t.Errorf("capacidades inesperadas: %+v", init)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	// didOpen publica los diagnósticos del documento
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{
+		URI: testURI, LanguageID: "flux", Version: 1, Text: testSource,
+	}})
+	msg := c.read()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("se esperaban diagnósticos, pero llegó %q", msg.Method)
+	}
+	var published PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &published); err != nil {
+		t.Fatal(err)
+	}
+	if published.URI != testURI || published.Version != 1 || len(published.Diagnostics) != 1 {
+		t.Fatalf("diagnósticos inesperados: %+v", published)
+	}
+	diag := published.Diagnostics[0]
+	want := Range{Start: Position{6, 15}, End: Position{6, 26}}
+	if diag.Range != want || diag.Severity != severityError {
+		t.Errorf("diagnóstico de 'desconocido': rango %+v y gravedad %d, se esperaba %+v y %d", diag.Range, diag.Severity, want, severityError)
+	}
+
+	// hover y definition sobre 'total' después de los emojis
+	var hover Hover
+	c.result("textDocument/hover", position(5, 17), &hover)
+	if want := (Range{Start: Position{5, 17}, End: Position{5, 22}}); hover.Range != want {
+		t.Errorf("hover: rango %+v, se esperaba %+v", hover.Range, want)
+	}
+	if want := "```flux\ndefinir total = sumar(1, 2)\n```\n\nVariable declarada en la línea 5."; hover.Contents.Value != want {
+		t.Errorf("hover: %q, se esperaba %q", hover.Contents.Value, want)
+	}
+
+	var sumHover Hover
+	c.result("textDocument/hover", position(4, 17), &sumHover)
+	if want := "```flux\nfunción sumar(a, b)\n```\n\nSuma dos números\n\nFunción declarada en la línea 2."; sumHover.Contents.Value != want {
+		t.Errorf("hover de 'sumar': %q, se esperaba %q", sumHover.Contents.Value, want)
+	}
+
+	var location Location
+	c.result("textDocument/definition", position(5, 19), &location)
+	if want := (Location{URI: testURI, Range: Range{Start: Position{4, 8}, End: Position{4, 13}}}); location != want {
+		t.Errorf("definition: %+v, se esperaba %+v", location, want)
+	}
+
+	// completion propone los nombres visibles, las funciones y constantes
+	// predefinidas y las palabras clave
+	var items []CompletionItem
+	c.result("textDocument/completion", position(6, 0), &items)
+	kinds := make(map[string]int)
+	for _, item := range items {
+		kinds[item.Label] = item.Kind
+	}
+	for label, kind := range map[string]int{
+		"sumar":    completionFunction,
+		"total":    completionVariable,
+		"longitud": completionFunction,
+		"PI":       completionConstant,
+		"mientras": completionKeyword,
+	} {
+		if kinds[label] != kind {
+			t.Errorf("completion: '%s' con tipo %d, se esperaba %d", label, kinds[label], kind)
+		}
+	}
+
+	var symbols []DocumentSymbol
+	c.result("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}}, &symbols)
+	if len(symbols) != 2 || symbols[0].Name != "sumar" || symbols[0].Kind != symbolKindFunction ||
+		symbols[1].Name != "total" || symbols[1].Kind != symbolKindVariable {
+		t.Fatalf("documentSymbol inesperado: %+v", symbols)
+	}
+	if want := (Range{Start: Position{1, 8}, End: Position{1, 13}}); symbols[0].SelectionRange != want {
+		t.Errorf("documentSymbol: 'sumar' en %+v, se esperaba %+v", symbols[0].SelectionRange, want)
+	}
+
+	// rename cambia la declaración y los usos, con las columnas en UTF-16
+	var edit WorkspaceEdit
+	c.result("textDocument/rename", RenameParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI}, Position: Position{5, 17}, NewName: "resultado",
+	}, &edit)
+	edits := edit.Changes[testURI]
+	if len(edits) != 2 ||
+		edits[0].Range != (Range{Start: Position{4, 8}, End: Position{4, 13}}) ||
+		edits[1].Range != (Range{Start: Position{5, 17}, End: Position{5, 22}}) ||
+		edits[0].NewText != "resultado" || edits[1].NewText != "resultado" {
+		t.Errorf("rename inesperado: %+v", edits)
+	}
+
+	for _, name := range []string{"si", "dos palabras", "1x"} {
+		_, err := c.call("textDocument/rename", RenameParams{
+			TextDocument: TextDocumentIdentifier{URI: testURI}, Position: Position{5, 17}, NewName: name,
+		})
+		if err == nil || err.Code != codeInvalidParams {
+			t.Errorf("rename a '%s': se esperaba el error %d, pero llegó %v", name, codeInvalidParams, err)
+		}
+	}
+	if _, err := c.call("textDocument/rename", RenameParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI}, Position: Position{5, 17}, NewName: "sumar",
+	}); err == nil || err.Code != codeRequestFailed {
+		t.Errorf("rename a un nombre existente: se esperaba el error %d, pero llegó %v", codeRequestFailed, err)
+	}
+
+	// shutdown y exit terminan la sesión con código 0
+	if raw, err := c.call("shutdown", nil); err != nil || string(raw) != "null" {
+		t.Fatalf("shutdown: %s, %v", raw, err)
+	}
+	if _, err := c.call("textDocument/hover", position(5, 17)); err == nil || err.Code != codeInvalidRequest {
+		t.Errorf("después de shutdown se esperaba el error %d, pero llegó %v", codeInvalidRequest, err)
+	}
+	c.notify("exit", nil)
+	if status := <-c.status; status != 0 {
+		t.Errorf("exit terminó con código %d, se esperaba 0", status)
+	}
+	if len(c.notifications) != 0 {
+		t.Errorf("notificaciones inesperadas: %+v", c.notifications)
+	}
+}
+
+// Sin shutdown, exit termina con código 1
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	var init InitializeResult
+	c.result("initialize", map[string]interface{}{}, &init)
+	c.notify("exit", nil)
+	if status := <-c.status; status != 1 {
+		t.Errorf("exit terminó con código %d, se esperaba 1", status)
+	}
+}
@@ -1,25 +1,26 @@
 package parser
 
 import (
-	"fmt"
 	"flux/ast"
+	"flux/diagnostic"
 	"flux/lexer"
 	"strconv"
-	"strings"
+	"unicode/utf8"
 )
 
 type Parser struct {
 	tokens       []lexer.Token
 	position     int
 	currentToken lexer.Token
-	errors       []string
+	previous     lexer.Token // Último token consumido, para calcular dónde termina cada nodo
+	errors       diagnostic.List
+	loops        []string // Etiquetas de los bucles abiertos ("" si no tienen)
 }
 
 func New(tokens []lexer.Token) *Parser {
 	p := &Parser{
 		tokens: tokens,
 		position: 0,
-		errors: []string{},
 	}
 	
 	if len(tokens) > 0 {
@@ -32,6 +33,7 @@ func New(tokens []lexer.Token) *Parser {
 }
 
 func (p *Parser) nextToken() {
+	p.previous = p.currentToken
 	p.position++
 	if p.position < len(p.tokens) {
 		p.currentToken = p.tokens[p.position]
@@ -47,134 +49,326 @@ func (p *Parser) peekToken() lexer.Token {
 	return lexer.Token{Type: lexer.TOKEN_EOF}
 }
 
+// currentIdentifier crea un identificador a partir del token actual,
+// conservando su posición para los mensajes de error
+func (p *Parser) currentIdentifier() *ast.Identifier {
+	return &ast.Identifier{
+		Value: p.currentToken.Value,
+		Loc:   tokenSpan(p.currentToken),
+	}
+}
+
+// tokenStart y tokenEnd convierten las posiciones de un token en las del AST
+func tokenStart(tok lexer.Token) ast.Position {
+	return ast.Position{Offset: tok.Offset, Line: tok.Line, Column: tok.Column}
+}
+
+func tokenEnd(tok lexer.Token) ast.Position {
+	return ast.Position{Offset: tok.EndOffset, Line: tok.EndLine, Column: tok.EndColumn}
+}
+
+func tokenSpan(tok lexer.Token) ast.Span {
+	return ast.Span{Start: tokenStart(tok), End: tokenEnd(tok)}
+}
+
+// spanFrom devuelve el fragmento que va desde el token start hasta el
+// último token consumido
+func (p *Parser) spanFrom(start lexer.Token) ast.Span {
+	end := tokenEnd(p.previous)
+	if p.previous.EndOffset < start.Offset {
+		end = tokenEnd(start)
+	}
+	return ast.Span{Start: tokenStart(start), End: end}
+}
+
+// Errors devuelve los errores encontrados en el último Parse
+func (p *Parser) Errors() diagnostic.List {
+	return p.errors
+}
+
+// errorAt registra un error en el token indicado
+func (p *Parser) errorAt(tok lexer.Token, code string, format string, args ...interface{}) *diagnostic.Diagnostic {
+	span := tokenSpan(tok)
+	if tok.Line == 0 {
+		// Token sintético de fin de archivo: se señala el final del último token
+		end := tokenEnd(p.previous)
+		span = ast.Span{Start: end, End: end}
+	}
+	return p.errorSpan(span, code, format, args...)
+}
+
+// errorSpan registra un error en un fragmento del código. Un segundo error
+// en la misma posición suele ser consecuencia del primero, así que se descarta.
+func (p *Parser) errorSpan(span ast.Span, code string, format string, args ...interface{}) *diagnostic.Diagnostic {
+	d := diagnostic.Errorf(code, span, format, args...)
+	if n := len(p.errors); n > 0 && p.errors[n-1].Span.Start.Offset == span.Start.Offset {
+		return d
+	}
+	p.errors = append(p.errors, d)
+	return d
+}
+
+// describe muestra un token en los mensajes de error
+func describe(tok lexer.Token) string {
+	if tok.Type == lexer.TOKEN_EOF {
+		return "el final del archivo"
+	}
+	return "'" + tok.Value + "'"
+}
+
+// misspelledKeyword devuelve la palabra clave que probablemente se quiso
+// escribir en lugar de ident. Solo se consideran las palabras clave de cinco
+// letras o más: las cortas ('si', 'fin') se parecen a demasiados nombres.
+func misspelledKeyword(ident string) (string, bool) {
+	if utf8.RuneCountInString(ident) < 4 {
+		return "", false
+	}
+	var candidates []string
+	for _, keyword := range lexer.Keywords() {
+		if utf8.RuneCountInString(keyword) >= 5 {
+			candidates = append(candidates, keyword)
+		}
+	}
+	maxDistance := 1
+	if utf8.RuneCountInString(ident) >= 8 {
+		maxDistance = 2
+	}
+	return diagnostic.Closest(ident, candidates, maxDistance)
+}
+
+// keywordHint añade a un error en tok la palabra clave que probablemente se
+// quiso escribir, si tok es un nombre parecido a una. El nombre no se
+// cambia: un nombre que se parece a una palabra clave puede ser válido, así
+// que la sugerencia solo acompaña a un error que ya existe.
+func keywordHint(d *diagnostic.Diagnostic, tok lexer.Token) *diagnostic.Diagnostic {
+	if tok.Type != lexer.TOKEN_IDENTIFICADOR {
+		return d
+	}
+	if suggestion, ok := misspelledKeyword(tok.Value); ok {
+		d.WithHint("¿quisiste decir '%s'?", suggestion)
+	}
+	return d
+}
+
+// headerEnd comprueba que la cabecera de un bloque termine en word ('entonces'
+// o 'hacer'). Esa palabra puede faltar, pero un nombre justo después de la
+// cabecera, en la misma línea, solo puede ser un error: 'si x > 1 entoces'.
+// Se reporta y se salta para analizar el cuerpo.
+func (p *Parser) headerEnd(word, after string) {
+	if p.currentToken.Type != lexer.TOKEN_IDENTIFICADOR || p.currentToken.Line != p.previous.EndLine {
+		return
+	}
+	keywordHint(p.errorAt(p.currentToken, diagnostic.CodeExpectedToken,
+		"se esperaba '%s' después de %s, pero se encontró %s", word, after, describe(p.currentToken)), p.currentToken)
+	p.nextToken()
+}
+
+// strayName reporta un nombre suelto seguido de más código en la misma línea,
+// como 'mostar "hola"' o 'definr x = 3'. Si el nombre se parece a una palabra
+// clave que abre un bloque con 'hacer', se salta el bloque hasta su 'fin'
+// para que ese 'fin' no se tome como el del bloque que lo contiene.
+func (p *Parser) strayName(name lexer.Token) ast.Statement {
+	keywordHint(p.errorAt(name, diagnostic.CodeUnexpectedToken,
+		"el nombre '%s' no puede ir seguido de %s", name.Value, describe(p.currentToken)), name)
+	switch suggestion, _ := misspelledKeyword(name.Value); suggestion {
+	case "mientras", "repetir":
+		return p.skipBlock(name, func() *ast.BlockStatement { return p.parseLoopBody(nil) })
+	case "función":
+		return p.skipBlock(name, p.parseFunctionBody)
+	}
+	return nil
+}
+
+// synchronize descarta tokens después de un error hasta llegar a algo que
+// pueda empezar una sentencia: una palabra clave de sentencia, un 'fin',
+// 'sino', 'capturar' o 'finalmente' que cierre el bloque actual, o un identificador al principio de una
+// línea nueva. Así un solo análisis puede reportar todos los errores.
+func (p *Parser) synchronize(from int) {
+	// Una sentencia con errores que llegó hasta su 'fin' ya consumió su
+	// bloque entero: lo que sigue es otra sentencia
+	if p.position != from && p.previous.Type == lexer.TOKEN_FIN {
+		return
+	}
+	line := p.currentToken.Line
+	if p.position == from && p.currentToken.Type != lexer.TOKEN_EOF {
+		p.nextToken()
+	}
+	for {
+		switch p.currentToken.Type {
+		case lexer.TOKEN_EOF, lexer.TOKEN_DEFINIR, lexer.TOKEN_CONSTANTE, lexer.TOKEN_SI, lexer.TOKEN_FUNCION,
+			lexer.TOKEN_FIN, lexer.TOKEN_SINO, lexer.TOKEN_MIENTRAS, lexer.TOKEN_REPETIR, lexer.TOKEN_MOSTRAR,
+			lexer.TOKEN_RETORNAR, lexer.TOKEN_SALIR, lexer.TOKEN_CONTINUAR, lexer.TOKEN_INTENTAR,
+			lexer.TOKEN_CAPTURAR, lexer.TOKEN_FINALMENTE, lexer.TOKEN_LANZAR:
+			return
+		case lexer.TOKEN_IDENTIFICADOR:
+			if p.currentToken.Line > line {
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
+// spanBetween devuelve el fragmento que cubre desde el inicio de un nodo
+// hasta el final de otro
+func spanBetween(first, last ast.Node) ast.Span {
+	return ast.Span{Start: first.Span().Start, End: last.Span().End}
+}
+
+// Parse analiza todos los tokens. Si hay errores, además de ellos devuelve
+// el programa con las sentencias que sí se pudieron analizar, para las
+// herramientas que trabajan con código a medio escribir.
 func (p *Parser) Parse() (*ast.Program, error) {
 	program := &ast.Program{
 		Statements: []ast.Statement{},
 	}
+	start := p.currentToken
 	
 	for p.currentToken.Type != lexer.TOKEN_EOF {
+		from := p.position
 		stmt := p.parseStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		} else {
-			// Si no se pudo parsear la sentencia, avanzar para evitar bucle infinito
-			if p.currentToken.Type != lexer.TOKEN_EOF {
-				p.nextToken()
-			}
+			// Si no se pudo parsear la sentencia, saltar hasta la siguiente
+			p.synchronize(from)
 		}
 	}
 	
+	program.Loc = p.spanFrom(start)
 	if len(p.errors) > 0 {
-		return nil, fmt.Errorf("errores de parsing: %v", p.errors)
+		return program, p.errors
 	}
-	
 	return program, nil
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	errorCount := len(p.errors)
 	switch p.currentToken.Type {
 	case lexer.TOKEN_DEFINIR, lexer.TOKEN_CONSTANTE:
 		return p.parseDeclareStatement()
 	case lexer.TOKEN_SI:
 		return p.parseIfStatement()
 	case lexer.TOKEN_MIENTRAS:
-		return p.parseWhileStatement()
+		return p.parseWhileStatement(nil)
 	case lexer.TOKEN_REPETIR:
-		return p.parseRepeatStatement()
+		return p.parseRepeatStatement(nil)
+	case lexer.TOKEN_SALIR, lexer.TOKEN_CONTINUAR:
+		return p.parseLoopControlStatement()
+	case lexer.TOKEN_INTENTAR:
+		return p.parseTryStatement()
+	case lexer.TOKEN_LANZAR:
+		return p.parseThrowStatement()
 	case lexer.TOKEN_FUNCION:
-		return p.parseFunctionStatement()
+		// 'función(' sin nombre es una función anónima usada como expresión
+		if p.peekToken().Type != lexer.TOKEN_PARENTESIS_IZQ {
+			return p.parseFunctionStatement()
+		}
+		expr := p.parseExpression(0)
+		if expr == nil {
+			return nil
+		}
+		return &ast.ExpressionStatement{Expression: expr, Loc: expr.Span()}
 	case lexer.TOKEN_MOSTRAR:
 		return p.parseShowStatement()
 	case lexer.TOKEN_RETORNAR:
 		return p.parseReturnStatement()
 	case lexer.TOKEN_IDENTIFICADOR:
+		// Podría ser un bucle etiquetado (etiqueta: repetir ...)
+		if p.peekToken().Type == lexer.TOKEN_DOS_PUNTOS {
+			return p.parseLabeledStatement()
+		}
 		// Podría ser una asignación (identificador = expresión)
 		if p.peekToken().Type == lexer.TOKEN_ASIGNACION {
 			return p.parseAssignStatement()
 		}
-		// Podría ser una llamada a función
-		if p.peekToken().Type == lexer.TOKEN_PARENTESIS_IZQ {
-			expr := p.parseCallExpression()
-			if expr != nil {
-				return &ast.ExpressionStatement{Expression: expr}
-			}
-		}
-		// Si no es una llamada, intentar parsear como expresión
+		// Si no, parsear como expresión (llamadas a función, accesos por índice...)
+		name := p.currentToken
 		expr := p.parseExpression(0)
 		if expr != nil {
-			return &ast.ExpressionStatement{Expression: expr}
+			// Un nombre suelto no puede ir seguido de nada más en su línea
+			if _, ok := expr.(*ast.Identifier); ok && p.currentToken.Line == name.Line && p.currentToken.Type != lexer.TOKEN_EOF &&
+				p.currentToken.Type != lexer.TOKEN_FIN && !isClauseKeyword(p.currentToken.Type) {
+				return p.strayName(name)
+			}
+			// Podría ser una asignación a un elemento (lista[i] = expresión)
+			if p.currentToken.Type == lexer.TOKEN_ASIGNACION {
+				if target, ok := expr.(*ast.IndexExpression); ok {
+					return p.parseIndexAssignStatement(target)
+				}
+				p.errorSpan(expr.Span(), diagnostic.CodeInvalidAssignment,
+					"el lado izquierdo de '=' debe ser una variable o un elemento de una lista o diccionario")
+				return nil
+			}
+			return &ast.ExpressionStatement{Expression: expr, Loc: expr.Span()}
+		}
+		// Si no se pudo parsear como expresión y no se reportó ya la causa, es un error
+		if len(p.errors) == errorCount {
+			p.errorAt(p.currentToken, diagnostic.CodeUnexpectedToken,
+				"no se pudo parsear el identificador '%s' como una sentencia válida", p.currentToken.Value)
 		}
-		// Si no se pudo parsear como expresión, podría ser un error
-		p.errors = append(p.errors, fmt.Sprintf("línea %d, columna %d: no se pudo parsear el identificador '%s' como una sentencia válida", 
-			p.currentToken.Line, p.currentToken.Column, p.currentToken.Value))
 		return nil
 	default:
 		// Intentar parsear como expresión (para casos como llamadas a función)
 		expr := p.parseExpression(0)
 		if expr != nil {
-			return &ast.ExpressionStatement{Expression: expr}
+			return &ast.ExpressionStatement{Expression: expr, Loc: expr.Span()}
 		}
-		// Si no se pudo parsear, es un error
-		if p.currentToken.Type != lexer.TOKEN_EOF {
-			p.errors = append(p.errors, fmt.Sprintf("línea %d, columna %d: token inesperado '%s' (tipo: %s)", 
-				p.currentToken.Line, p.currentToken.Column, p.currentToken.Value, p.currentToken.Type))
+		// Si no se pudo parsear y no se reportó ya la causa, es un error
+		if p.currentToken.Type != lexer.TOKEN_EOF && len(p.errors) == errorCount {
+			p.errorAt(p.currentToken, diagnostic.CodeUnexpectedToken, "token inesperado %s", describe(p.currentToken))
 		}
 		return nil
 	}
 }
 
-func (p *Parser) parseDeclareStatement() *ast.DeclareStatement {
+func (p *Parser) parseDeclareStatement() ast.Statement {
 	stmt := &ast.DeclareStatement{
 		IsConst: p.currentToken.Type == lexer.TOKEN_CONSTANTE,
 	}
+	start := p.currentToken
 	
 	p.nextToken()
 	
 	if p.currentToken.Type != lexer.TOKEN_IDENTIFICADOR {
-		p.errors = append(p.errors, fmt.Sprintf("línea %d, columna %d: se esperaba un identificador después de 'definir', pero se encontró '%s' (tipo: %s)", 
-			p.currentToken.Line, p.currentToken.Column, p.currentToken.Value, p.currentToken.Type))
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedToken,
+			"se esperaba un identificador después de '%s', pero se encontró %s", start.Value, describe(p.currentToken))
 		return nil
 	}
 	
-	stmt.Name = &ast.Identifier{Value: p.currentToken.Value}
+	stmt.Name = p.currentIdentifier()
 	p.nextToken()
 	
 	if p.currentToken.Type != lexer.TOKEN_ASIGNACION {
-		expected := "="
-		found := p.currentToken.Value
-		if found == "" {
-			found = string(p.currentToken.Type)
-		}
-		line := p.currentToken.Line
-		column := p.currentToken.Column
-		if line == 0 {
-			line = 1 // Valor por defecto si no hay información de línea
-		}
-		if column == 0 {
-			column = 1 // Valor por defecto si no hay información de columna
-		}
-		p.errors = append(p.errors, fmt.Sprintf("línea %d, columna %d: se esperaba '%s' después del identificador '%s', pero se encontró '%s' (tipo: %s)", 
-			line, column, expected, stmt.Name.Value, found, p.currentToken.Type))
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedToken,
+			"se esperaba '=' después del identificador '%s', pero se encontró %s", stmt.Name.Value, describe(p.currentToken)).
+			WithHint("la forma es '%s %s = valor'", start.Value, stmt.Name.Value)
 		return nil
 	}
 	
 	p.nextToken()
 	stmt.Value = p.parseExpression(0)
+	if stmt.Value == nil {
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedExpression, "se esperaba una expresión después del '='")
+		return nil
+	}
 	
+	stmt.Loc = p.spanFrom(start)
 	return stmt
 }
 
-func (p *Parser) parseAssignStatement() *ast.AssignStatement {
+func (p *Parser) parseAssignStatement() ast.Statement {
 	stmt := &ast.AssignStatement{}
+	start := p.currentToken
 	
 	// El identificador ya está en currentToken
-	stmt.Name = &ast.Identifier{Value: p.currentToken.Value}
+	stmt.Name = p.currentIdentifier()
 	p.nextToken() // Consumir el identificador
 	
 	// Debe seguir un '='
 	if p.currentToken.Type != lexer.TOKEN_ASIGNACION {
-		p.errors = append(p.errors, fmt.Sprintf("línea %d, columna %d: se esperaba '=' después del identificador '%s', pero se encontró '%s' (tipo: %s)", 
-			p.currentToken.Line, p.currentToken.Column, stmt.Name.Value, p.currentToken.Value, p.currentToken.Type))
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedToken,
+			"se esperaba '=' después del identificador '%s', pero se encontró %s", stmt.Name.Value, describe(p.currentToken))
 		return nil
 	}
 	
@@ -184,22 +378,41 @@ func (p *Parser) parseAssignStatement() *ast.AssignStatement {
 	stmt.Value = p.parseExpression(0)
 	
 	if stmt.Value == nil {
-		p.errors = append(p.errors, fmt.Sprintf("línea %d, columna %d: se esperaba una expresión después del '='", 
-			p.currentToken.Line, p.currentToken.Column))
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedExpression, "se esperaba una expresión después del '='")
 		return nil
 	}
 	
+	stmt.Loc = p.spanFrom(start)
 	return stmt
 }
 
-func (p *Parser) parseIfStatement() *ast.IfStatement {
+func (p *Parser) parseIndexAssignStatement(target *ast.IndexExpression) ast.Statement {
+	stmt := &ast.IndexAssignStatement{Target: target}
+	start := p.tokenAt(target.Span().Start)
+	
+	p.nextToken() // Consumir el '='
+	
+	stmt.Value = p.parseExpression(0)
+	if stmt.Value == nil {
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedExpression, "se esperaba una expresión después del '='")
+		return nil
+	}
+	
+	stmt.Loc = p.spanFrom(start)
+	return stmt
+}
+
+func (p *Parser) parseIfStatement() ast.Statement {
 	stmt := &ast.IfStatement{}
+	start := p.currentToken
 	
 	p.nextToken()
-	stmt.Condition = p.parseExpression(0)
+	stmt.Condition = p.parseRequired("una condición", start.Value)
 	
 	if p.currentToken.Type == lexer.TOKEN_ENTONCES || p.currentToken.Type == lexer.TOKEN_HACER {
 		p.nextToken()
+	} else if stmt.Condition != nil {
+		p.headerEnd("entonces", "la condición")
 	}
 	
 	stmt.Then = p.parseBlockStatement()
@@ -211,84 +424,121 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 	
 	if p.currentToken.Type == lexer.TOKEN_FIN {
 		p.nextToken()
+	} else {
+		p.unclosedBlock(start, "si")
 	}
 	
+	// Sin condición no hay sentencia, pero el cuerpo se analizó igualmente
+	// para reportar también sus errores
+	if stmt.Condition == nil {
+		return nil
+	}
+	stmt.Loc = p.spanFrom(start)
 	return stmt
 }
 
-func (p *Parser) parseWhileStatement() *ast.WhileStatement {
-	stmt := &ast.WhileStatement{}
+// skipBlock se usa cuando la cabecera de un bloque tiene errores: descarta el
+// resto de la cabecera y parsea el cuerpo hasta su 'fin', para que ese 'fin'
+// no se confunda con el de otro bloque. Los errores del cuerpo también se
+// reportan. Devuelve siempre nil.
+func (p *Parser) skipBlock(open lexer.Token, parseBody func() *ast.BlockStatement) ast.Statement {
+	line := p.currentToken.Line
+	for p.currentToken.Type != lexer.TOKEN_EOF && p.currentToken.Line == line &&
+		p.currentToken.Type != lexer.TOKEN_HACER && p.currentToken.Type != lexer.TOKEN_FIN {
+		p.nextToken()
+	}
+	if p.currentToken.Type == lexer.TOKEN_HACER {
+		p.nextToken()
+	}
+	parseBody()
+	if p.currentToken.Type == lexer.TOKEN_FIN {
+		p.nextToken()
+	} else {
+		p.unclosedBlock(open, open.Value)
+	}
+	return nil
+}
+
+// unclosedBlock reporta un bloque al que le falta su 'fin', señalando la
+// palabra que lo abrió
+func (p *Parser) unclosedBlock(open lexer.Token, kind string) {
+	p.errorAt(open, diagnostic.CodeUnclosedBlock, "el bloque '%s' no está cerrado", kind).
+		WithHint("se esperaba 'fin', pero se encontró %s", describe(p.currentToken))
+}
+
+func (p *Parser) parseWhileStatement(label *ast.Identifier) ast.Statement {
+	stmt := &ast.WhileStatement{Label: label}
+	start := p.loopStart(label)
+	keyword := p.currentToken
 	
 	p.nextToken()
-	stmt.Condition = p.parseExpression(0)
+	stmt.Condition = p.parseRequired("una condición", keyword.Value)
 	
 	if p.currentToken.Type == lexer.TOKEN_HACER {
 		p.nextToken()
+	} else if stmt.Condition != nil {
+		p.headerEnd("hacer", "la condición")
 	}
 	
-	// Guardar la posición del inicio del mientras para el mensaje de error
-	whileLine := p.currentToken.Line
-	whileColumn := p.currentToken.Column
-	
-	stmt.Body = p.parseBlockStatement()
+	stmt.Body = p.parseLoopBody(label)
 	
 	// Requerir explícitamente un 'fin' para cerrar el bloque mientras
 	if p.currentToken.Type != lexer.TOKEN_FIN {
-		line := whileLine
-		column := whileColumn
-		if line == 0 {
-			line = 1
-		}
-		if column == 0 {
-			column = 1
-		}
-		found := p.currentToken.Value
-		if found == "" {
-			found = string(p.currentToken.Type)
-		}
-		p.errors = append(p.errors, fmt.Sprintf("línea %d, columna %d: se esperaba 'fin' para cerrar el bloque 'mientras', pero se encontró '%s' (tipo: %s)", 
-			line, column, found, p.currentToken.Type))
+		p.unclosedBlock(keyword, "mientras")
 		return nil
 	}
 	
 	p.nextToken()
+	if stmt.Condition == nil {
+		return nil
+	}
 	
+	stmt.Loc = p.spanFrom(start)
 	return stmt
 }
 
-func (p *Parser) parseRepeatStatement() *ast.RepeatStatement {
-	stmt := &ast.RepeatStatement{}
+func (p *Parser) parseRepeatStatement(label *ast.Identifier) ast.Statement {
+	stmt := &ast.RepeatStatement{Label: label}
+	start := p.loopStart(label)
+	keyword := p.currentToken
 	
 	p.nextToken()
-	stmt.Variable = &ast.Identifier{Value: p.currentToken.Value}
+	if p.currentToken.Type != lexer.TOKEN_IDENTIFICADOR {
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedToken,
+			"se esperaba el nombre de la variable después de 'repetir', pero se encontró %s", describe(p.currentToken))
+		return p.skipBlock(keyword, func() *ast.BlockStatement { return p.parseLoopBody(label) })
+	}
+	stmt.Variable = p.currentIdentifier()
 	p.nextToken()
 	
 	if p.currentToken.Type != lexer.TOKEN_DESDE {
-		p.errors = append(p.errors, "se esperaba 'desde'")
-		return nil
+		d := p.errorAt(p.currentToken, diagnostic.CodeExpectedToken, "se esperaba 'desde', pero se encontró %s", describe(p.currentToken)).
+			WithHint("la forma es 'repetir %s desde inicio hasta final hacer'", stmt.Variable.Value)
+		keywordHint(d, p.currentToken)
+		return p.skipBlock(keyword, func() *ast.BlockStatement { return p.parseLoopBody(label) })
 	}
 	
 	p.nextToken()
-	stmt.From = p.parseExpression(0)
+	stmt.From = p.parseRequired("el valor inicial", "desde")
 	
 	if p.currentToken.Type != lexer.TOKEN_HASTA {
-		p.errors = append(p.errors, fmt.Sprintf("se esperaba 'hasta', pero se encontró '%s' (tipo: %s)", p.currentToken.Value, p.currentToken.Type))
-		return nil
+		d := p.errorAt(p.currentToken, diagnostic.CodeExpectedToken, "se esperaba 'hasta', pero se encontró %s", describe(p.currentToken)).
+			WithHint("la forma es 'repetir %s desde inicio hasta final hacer'", stmt.Variable.Value)
+		keywordHint(d, p.currentToken)
+		return p.skipBlock(keyword, func() *ast.BlockStatement { return p.parseLoopBody(label) })
 	}
 	
 	p.nextToken()
-	stmt.To = p.parseExpression(0)
+	stmt.To = p.parseRequired("el valor final", "hasta")
 	
 	if p.currentToken.Type == lexer.TOKEN_HACER {
 		p.nextToken()
+	} else if stmt.To != nil {
+		p.headerEnd("hacer", "el valor final")
 	}
 	
-	// Guardar la posición del inicio del repetir para el mensaje de error
-	repeatLine := p.currentToken.Line
-	repeatColumn := p.currentToken.Column
-	
 	// Parsear el cuerpo del repetir
-	stmt.Body = p.parseBlockStatement()
+	stmt.Body = p.parseLoopBody(label)
 	
 	// Después de parsear el cuerpo, el token actual debería ser el 'fin' del repetir
 	// Si parseBlockStatement() se detuvo porque encontró un 'fin' con blockDepth == 0,
@@ -301,34 +551,125 @@ func (p *Parser) parseRepeatStatement() *ast.RepeatStatement {
 	
 	// Requerir explícitamente un 'fin' para cerrar el bloque repetir
 	if p.currentToken.Type != lexer.TOKEN_FIN {
-		line := repeatLine
-		column := repeatColumn
-		if line == 0 {
-			line = 1
-		}
-		if column == 0 {
-			column = 1
-		}
-		found := p.currentToken.Value
-		if found == "" {
-			found = string(p.currentToken.Type)
-		}
-		p.errors = append(p.errors, fmt.Sprintf("línea %d, columna %d: se esperaba 'fin' para cerrar el bloque 'repetir', pero se encontró '%s' (tipo: %s)", 
-			line, column, found, p.currentToken.Type))
+		p.unclosedBlock(keyword, "repetir")
 		return nil
 	}
 	
 	// Consumir el 'fin' del repetir
 	p.nextToken()
+	if stmt.From == nil || stmt.To == nil {
+		return nil
+	}
 	
+	stmt.Loc = p.spanFrom(start)
 	return stmt
 }
 
-func (p *Parser) parseFunctionStatement() *ast.FunctionStatement {
+// loopStart devuelve el primer token de un bucle: la etiqueta si la tiene
+func (p *Parser) loopStart(label *ast.Identifier) lexer.Token {
+	if label != nil {
+		return p.tokenAt(label.Loc.Start)
+	}
+	return p.currentToken
+}
+
+// tokenAt busca el token que empieza en la posición dada
+func (p *Parser) tokenAt(pos ast.Position) lexer.Token {
+	for i := p.position; i >= 0; i-- {
+		if i < len(p.tokens) && p.tokens[i].Offset == pos.Offset {
+			return p.tokens[i]
+		}
+	}
+	return p.currentToken
+}
+
+// parseLabeledStatement parsea 'etiqueta: mientras ...' o 'etiqueta: repetir ...'
+func (p *Parser) parseLabeledStatement() ast.Statement {
+	label := p.currentIdentifier()
+	p.nextToken() // Consumir la etiqueta
+	p.nextToken() // Consumir ':'
+	
+	// El error no interrumpe el parseo del bucle para no perder la sincronización
+	for _, open := range p.loops {
+		if open == label.Value {
+			p.errorSpan(label.Loc, diagnostic.CodeInvalidLabel, "la etiqueta '%s' ya está en uso por un bucle exterior", label.Value)
+			break
+		}
+	}
+	
+	switch p.currentToken.Type {
+	case lexer.TOKEN_MIENTRAS:
+		return p.parseWhileStatement(label)
+	case lexer.TOKEN_REPETIR:
+		return p.parseRepeatStatement(label)
+	default:
+		p.errorSpan(label.Loc, diagnostic.CodeInvalidLabel,
+			"solo los bucles 'mientras' y 'repetir' pueden tener etiqueta, pero se encontró %s", describe(p.currentToken))
+		return nil
+	}
+}
+
+// parseLoopBody parsea el cuerpo de un bucle registrando su etiqueta
+// para que 'salir' y 'continuar' sepan a qué bucle se refieren
+func (p *Parser) parseLoopBody(label *ast.Identifier) *ast.BlockStatement {
+	name := ""
+	if label != nil {
+		name = label.Value
+	}
+	p.loops = append(p.loops, name)
+	body := p.parseBlockStatement()
+	p.loops = p.loops[:len(p.loops)-1]
+	return body
+}
+
+// parseLoopControlStatement parsea 'salir' y 'continuar' con etiqueta opcional
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	keyword := p.currentToken
+	p.nextToken()
+	
+	// La etiqueta debe ir en la misma línea; si no, el identificador
+	// pertenece a la siguiente sentencia
+	var label *ast.Identifier
+	if p.currentToken.Type == lexer.TOKEN_IDENTIFICADOR && p.currentToken.Line == keyword.Line &&
+		p.peekToken().Type != lexer.TOKEN_ASIGNACION && p.peekToken().Type != lexer.TOKEN_PARENTESIS_IZQ {
+		label = p.currentIdentifier()
+		p.nextToken()
+	}
+	
+	// Los errores se registran pero la sentencia se devuelve igualmente,
+	// ya que sus tokens fueron consumidos
+	if len(p.loops) == 0 {
+		p.errorAt(keyword, diagnostic.CodeLoopControl, "'%s' solo se puede usar dentro de un bucle 'mientras' o 'repetir'", keyword.Value)
+	} else if label != nil {
+		found := false
+		for _, open := range p.loops {
+			if open == label.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.errorSpan(label.Loc, diagnostic.CodeLoopControl, "no existe un bucle con la etiqueta '%s' alrededor de '%s'", label.Value, keyword.Value)
+		}
+	}
+	
+	if keyword.Type == lexer.TOKEN_SALIR {
+		return &ast.BreakStatement{Label: label, Loc: p.spanFrom(keyword)}
+	}
+	return &ast.ContinueStatement{Label: label, Loc: p.spanFrom(keyword)}
+}
+
+func (p *Parser) parseFunctionStatement() ast.Statement {
 	stmt := &ast.FunctionStatement{}
+	start := p.currentToken
 	
 	p.nextToken()
-	stmt.Name = &ast.Identifier{Value: p.currentToken.Value}
+	if p.currentToken.Type != lexer.TOKEN_IDENTIFICADOR {
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedToken,
+			"se esperaba el nombre de la función después de '%s', pero se encontró %s", start.Value, describe(p.currentToken))
+		return p.skipBlock(start, p.parseFunctionBody)
+	}
+	stmt.Name = p.currentIdentifier()
 	p.nextToken()
 	
 	if p.currentToken.Type == lexer.TOKEN_PARENTESIS_IZQ {
@@ -341,28 +682,120 @@ func (p *Parser) parseFunctionStatement() *ast.FunctionStatement {
 	
 	if p.currentToken.Type == lexer.TOKEN_HACER {
 		p.nextToken()
+	} else {
+		p.headerEnd("hacer", "los parámetros")
 	}
 	
-	stmt.Body = p.parseBlockStatement()
+	stmt.Body = p.parseFunctionBody()
 	
 	if p.currentToken.Type == lexer.TOKEN_FIN {
 		p.nextToken()
+	} else {
+		p.unclosedBlock(start, start.Value)
 	}
 	
+	stmt.Loc = p.spanFrom(start)
 	return stmt
 }
 
+// parseFunctionBody parsea el cuerpo de una función con o sin nombre
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	// Los bucles exteriores no son visibles dentro del cuerpo de la función
+	outerLoops := p.loops
+	p.loops = nil
+	body := p.parseBlockStatement()
+	p.loops = outerLoops
+	return body
+}
+
+// parseFunctionLiteral parsea una función anónima: función(a, b) hacer ... fin
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{}
+	start := p.currentToken
+	p.nextToken() // Consumir 'función'
+	
+	if p.currentToken.Type != lexer.TOKEN_PARENTESIS_IZQ {
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedToken, "se esperaba '(' después de 'función', pero se encontró %s", describe(p.currentToken))
+		return nil
+	}
+	p.nextToken()
+	lit.Parameters = p.parseParameters()
+	if p.currentToken.Type != lexer.TOKEN_PARENTESIS_DER {
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedToken, "se esperaba ')' después de los parámetros, pero se encontró %s", describe(p.currentToken))
+		return nil
+	}
+	p.nextToken()
+	
+	if p.currentToken.Type == lexer.TOKEN_HACER {
+		p.nextToken()
+	}
+	
+	lit.Body = p.parseFunctionBody()
+	
+	if p.currentToken.Type != lexer.TOKEN_FIN {
+		p.unclosedBlock(start, start.Value)
+		return nil
+	}
+	p.nextToken()
+	
+	lit.Loc = p.spanFrom(start)
+	return lit
+}
+
+// parseArrowFunction parsea el cuerpo de la forma corta 'x => expresión'.
+// El token actual es '=>'.
+func (p *Parser) parseArrowFunction(start ast.Position, params []*ast.Identifier) ast.Expression {
+	arrow := p.currentToken
+	p.nextToken() // Consumir '=>'
+	
+	outerLoops := p.loops
+	p.loops = nil
+	value := p.parseExpression(0)
+	p.loops = outerLoops
+	
+	if value == nil {
+		p.errorAt(arrow, diagnostic.CodeExpectedExpression, "se esperaba una expresión después de '=>'")
+		return nil
+	}
+	
+	// El cuerpo es un 'retornar' implícito que ocupa lo mismo que la expresión
+	body := &ast.BlockStatement{
+		Statements: []ast.Statement{&ast.ReturnStatement{Value: value, Loc: value.Span()}},
+		Loc:        value.Span(),
+	}
+	return &ast.FunctionLiteral{
+		Parameters: params,
+		Body:       body,
+		Loc:        ast.Span{Start: start, End: value.Span().End},
+	}
+}
+
+// isArrowParameters indica si el '(' actual abre la lista de parámetros de
+// una función corta: (a, b) => ...
+func (p *Parser) isArrowParameters() bool {
+	i := p.position + 1
+	if i < len(p.tokens) && p.tokens[i].Type == lexer.TOKEN_IDENTIFICADOR {
+		i++
+		for i+1 < len(p.tokens) && p.tokens[i].Type == lexer.TOKEN_COMA && p.tokens[i+1].Type == lexer.TOKEN_IDENTIFICADOR {
+			i += 2
+		}
+	}
+	return i+1 < len(p.tokens) &&
+		p.tokens[i].Type == lexer.TOKEN_PARENTESIS_DER &&
+		p.tokens[i+1].Type == lexer.TOKEN_FLECHA
+}
+
 func (p *Parser) parseParameters() []*ast.Identifier {
 	var params []*ast.Identifier
 	
 	if p.currentToken.Type == lexer.TOKEN_IDENTIFICADOR {
-		params = append(params, &ast.Identifier{Value: p.currentToken.Value})
+		params = append(params, p.currentIdentifier())
 		p.nextToken()
 		
 		for p.currentToken.Type == lexer.TOKEN_COMA {
 			p.nextToken()
 			if p.currentToken.Type == lexer.TOKEN_IDENTIFICADOR {
-				params = append(params, &ast.Identifier{Value: p.currentToken.Value})
+				params = append(params, p.currentIdentifier())
 				p.nextToken()
 			}
 		}
@@ -371,31 +804,104 @@ func (p *Parser) parseParameters() []*ast.Identifier {
 	return params
 }
 
-func (p *Parser) parseShowStatement() *ast.ShowStatement {
+// parseTryStatement parsea 'intentar ... capturar e hacer ... finalmente ... fin'.
+// 'capturar' y 'finalmente' son opcionales, pero debe haber al menos uno.
+func (p *Parser) parseTryStatement() ast.Statement {
+	stmt := &ast.TryStatement{}
+	start := p.currentToken
+	
+	p.nextToken()
+	if p.currentToken.Type == lexer.TOKEN_HACER {
+		p.nextToken()
+	}
+	stmt.Body = p.parseBlockStatement()
+	
+	if p.currentToken.Type == lexer.TOKEN_CAPTURAR {
+		p.nextToken()
+		if p.currentToken.Type == lexer.TOKEN_IDENTIFICADOR {
+			stmt.CatchName = p.currentIdentifier()
+			p.nextToken()
+		}
+		if p.currentToken.Type == lexer.TOKEN_HACER {
+			p.nextToken()
+		} else if stmt.CatchName != nil {
+			p.headerEnd("hacer", "el nombre del error")
+		}
+		stmt.Catch = p.parseBlockStatement()
+	}
+	
+	if p.currentToken.Type == lexer.TOKEN_FINALMENTE {
+		p.nextToken()
+		if p.currentToken.Type == lexer.TOKEN_HACER {
+			p.nextToken()
+		}
+		stmt.Finally = p.parseBlockStatement()
+	}
+	
+	if p.currentToken.Type != lexer.TOKEN_FIN {
+		p.unclosedBlock(start, "intentar")
+		return nil
+	}
+	p.nextToken()
+	
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.errorAt(start, diagnostic.CodeExpectedToken, "el bloque 'intentar' necesita 'capturar' o 'finalmente'").
+			WithHint("la forma es 'intentar ... capturar e hacer ... fin'")
+		return nil
+	}
+	
+	stmt.Loc = p.spanFrom(start)
+	return stmt
+}
+
+// parseThrowStatement parsea 'lanzar expresión'
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{}
+	start := p.currentToken
+	
+	p.nextToken()
+	stmt.Value = p.parseExpression(0)
+	if stmt.Value == nil {
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedExpression, "se esperaba una expresión después de 'lanzar'")
+		return nil
+	}
+	
+	stmt.Loc = p.spanFrom(start)
+	return stmt
+}
+
+func (p *Parser) parseShowStatement() ast.Statement {
 	stmt := &ast.ShowStatement{}
+	start := p.currentToken
 	
 	p.nextToken()
 	if p.currentToken.Type == lexer.TOKEN_PARENTESIS_IZQ {
 		p.nextToken()
-		stmt.Value = p.parseExpression(0)
+		stmt.Value = p.parseRequired("un valor", "(")
 		if p.currentToken.Type == lexer.TOKEN_PARENTESIS_DER {
 			p.nextToken()
 		}
 	} else {
-		stmt.Value = p.parseExpression(0)
+		stmt.Value = p.parseRequired("un valor", start.Value)
+	}
+	if stmt.Value == nil {
+		return nil
 	}
 	
+	stmt.Loc = p.spanFrom(start)
 	return stmt
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{}
+	start := p.currentToken
 	
 	p.nextToken()
 	if p.currentToken.Type != lexer.TOKEN_FIN {
 		stmt.Value = p.parseExpression(0)
 	}
 	
+	stmt.Loc = p.spanFrom(start)
 	return stmt
 }
 
@@ -403,6 +909,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{
 		Statements: []ast.Statement{},
 	}
+	start := p.currentToken
 	
 	// Contador para rastrear bloques anidados (si, mientras, repetir, función)
 	// Necesitamos contar cuántos bloques se abren para saber cuántos 'fin' necesitamos
@@ -410,10 +917,13 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	
 	for p.currentToken.Type != lexer.TOKEN_EOF {
 		// Detectar apertura de bloques anidados ANTES de parsear
-		if p.currentToken.Type == lexer.TOKEN_SI || 
+		opensBlock := p.currentToken.Type == lexer.TOKEN_SI || 
 		   p.currentToken.Type == lexer.TOKEN_MIENTRAS || 
 		   p.currentToken.Type == lexer.TOKEN_REPETIR ||
-		   p.currentToken.Type == lexer.TOKEN_FUNCION {
+		   p.currentToken.Type == lexer.TOKEN_INTENTAR ||
+		   (p.currentToken.Type == lexer.TOKEN_FUNCION && p.peekToken().Type != lexer.TOKEN_PARENTESIS_IZQ) ||
+		   (p.currentToken.Type == lexer.TOKEN_IDENTIFICADOR && p.peekToken().Type == lexer.TOKEN_DOS_PUNTOS)
+		if opensBlock {
 			blockDepth++
 		}
 		
@@ -423,44 +933,66 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 			break
 		}
 		
-		// Si encontramos un 'sino' y no hay bloques anidados abiertos, este 'sino' es para el if padre
-		if p.currentToken.Type == lexer.TOKEN_SINO && blockDepth == 0 {
+		// Si encontramos un 'sino' y no hay bloques anidados abiertos, este 'sino' es para el if padre.
+		// Igual con 'capturar' y 'finalmente', que pertenecen al 'intentar' padre
+		if isClauseKeyword(p.currentToken.Type) && blockDepth == 0 {
 			break
 		}
 		
+		from := p.position
 		stmt := p.parseStatement()
 		
 		// Después de parsear, verificar si se cerró un bloque anidado
 		// Si parseamos un bloque (si, mientras, repetir, función), estos consumen su propio 'fin'
-		// así que necesitamos decrementar el contador
-		if stmt != nil {
-			// Verificar si la sentencia parseada es un bloque que consume un 'fin'
-			switch stmt.(type) {
-			case *ast.IfStatement, *ast.WhileStatement, *ast.RepeatStatement, *ast.FunctionStatement:
-				// Estos bloques consumen su propio 'fin', así que decrementamos el contador
-				blockDepth--
-			}
+		// así que necesitamos decrementar el contador. Se hace también si el
+		// bloque tenía errores, para que el 'fin' siguiente no se tome como suyo.
+		if opensBlock {
+			blockDepth--
 		}
 		
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		} else {
-			// Si no se pudo parsear, avanzar para evitar bucle infinito
-			if p.currentToken.Type != lexer.TOKEN_FIN && p.currentToken.Type != lexer.TOKEN_SINO && p.currentToken.Type != lexer.TOKEN_EOF {
-				p.nextToken()
+			// Si no se pudo parsear, saltar hasta la siguiente sentencia sin
+			// pasar del 'fin', 'sino', 'capturar' o 'finalmente' que cierra este bloque
+			if p.currentToken.Type != lexer.TOKEN_FIN && !isClauseKeyword(p.currentToken.Type) {
+				p.synchronize(from)
 			}
 		}
 	}
 	
+	// Un bloque vacío ocupa un fragmento vacío donde habría empezado
+	block.Loc = ast.Span{Start: tokenStart(start), End: tokenStart(start)}
+	if len(block.Statements) > 0 {
+		block.Loc = spanBetween(block.Statements[0], block.Statements[len(block.Statements)-1])
+	}
 	return block
 }
 
+// isClauseKeyword indica si el token empieza otra parte del bloque que lo
+// contiene ('sino' de un si, 'capturar' o 'finalmente' de un intentar)
+func isClauseKeyword(t lexer.TokenType) bool {
+	return t == lexer.TOKEN_SINO || t == lexer.TOKEN_CAPTURAR || t == lexer.TOKEN_FINALMENTE
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	left := p.parsePrefixExpression()
 	if left == nil {
 		return nil
 	}
 	
+	// Accesos por índice y llamadas: lista[i], matriz[i][j], f(x), fabrica()(x)
+	for p.currentToken.Type == lexer.TOKEN_CORCHETE_IZQ || p.currentToken.Type == lexer.TOKEN_PARENTESIS_IZQ {
+		if p.currentToken.Type == lexer.TOKEN_CORCHETE_IZQ {
+			left = p.parseIndexExpression(left)
+		} else {
+			left = p.parseCallExpression(left)
+		}
+		if left == nil {
+			return nil
+		}
+	}
+	
 	for p.currentToken.Type != lexer.TOKEN_EOF && 
 		p.currentToken.Type != lexer.TOKEN_PARENTESIS_DER &&
 		p.currentToken.Type != lexer.TOKEN_FIN &&
@@ -479,47 +1011,80 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return left
 }
 
+// parseRequired parsea una expresión que no puede faltar, como la condición
+// de un 'si'. Si falta, reporta que se esperaba what después de after, salvo
+// que la propia expresión ya haya reportado por qué no se pudo analizar.
+func (p *Parser) parseRequired(what, after string) ast.Expression {
+	errorCount := len(p.errors)
+	expr := p.parseExpression(0)
+	if expr == nil && len(p.errors) == errorCount {
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedExpression,
+			"se esperaba %s después de '%s', pero se encontró %s", what, after, describe(p.currentToken))
+	}
+	return expr
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	switch p.currentToken.Type {
-	case lexer.TOKEN_NOT:
+	case lexer.TOKEN_NOT, lexer.TOKEN_RESTA:
+		start := p.currentToken
 		expr := &ast.PrefixExpression{
 			Operator: p.currentToken.Value,
 		}
 		p.nextToken()
-		expr.Right = p.parseExpression(1)
+		expr.Right = p.parseExpression(prefixPrecedence)
+		if expr.Right == nil {
+			p.errorAt(p.currentToken, diagnostic.CodeExpectedExpression, "se esperaba una expresión después de '%s'", expr.Operator)
+			return nil
+		}
+		expr.Loc = p.spanFrom(start)
 		return expr
+	case lexer.TOKEN_CORCHETE_IZQ:
+		return p.parseListLiteral()
+	case lexer.TOKEN_LLAVE_IZQ:
+		return p.parseDictLiteral()
 	case lexer.TOKEN_IDENTIFICADOR:
-		// Verificar si es una llamada a función
-		if p.peekToken().Type == lexer.TOKEN_PARENTESIS_IZQ {
-			return p.parseCallExpression()
-		}
-		ident := &ast.Identifier{Value: p.currentToken.Value}
+		ident := p.currentIdentifier()
 		p.nextToken()
+		// Función corta con un parámetro: x => x * 2
+		if p.currentToken.Type == lexer.TOKEN_FLECHA {
+			return p.parseArrowFunction(ident.Loc.Start, []*ast.Identifier{ident})
+		}
+		// Las llamadas se parsean como sufijo en parseExpression
 		return ident
+	case lexer.TOKEN_FUNCION:
+		return p.parseFunctionLiteral()
 	case lexer.TOKEN_ENTERO:
 		val, _ := strconv.ParseInt(p.currentToken.Value, 10, 64)
-		lit := &ast.IntegerLiteral{Value: val}
+		lit := &ast.IntegerLiteral{Value: val, Loc: tokenSpan(p.currentToken)}
 		p.nextToken()
 		return lit
 	case lexer.TOKEN_DECIMAL:
 		val, _ := strconv.ParseFloat(p.currentToken.Value, 64)
-		lit := &ast.FloatLiteral{Value: val}
+		lit := &ast.FloatLiteral{Value: val, Loc: tokenSpan(p.currentToken)}
 		p.nextToken()
 		return lit
 	case lexer.TOKEN_CADENA:
-		val := strings.Trim(p.currentToken.Value, "\"'")
-		lit := &ast.StringLiteral{Value: val}
+		lit := p.parseString(p.currentToken)
 		p.nextToken()
 		return lit
 	case lexer.TOKEN_VERDADERO:
-		lit := &ast.BooleanLiteral{Value: true}
+		lit := &ast.BooleanLiteral{Value: true, Loc: tokenSpan(p.currentToken)}
 		p.nextToken()
 		return lit
 	case lexer.TOKEN_FALSO:
-		lit := &ast.BooleanLiteral{Value: false}
+		lit := &ast.BooleanLiteral{Value: false, Loc: tokenSpan(p.currentToken)}
 		p.nextToken()
 		return lit
 	case lexer.TOKEN_PARENTESIS_IZQ:
+		// Función corta con varios parámetros: (a, b) => a + b
+		if p.isArrowParameters() {
+			start := tokenStart(p.currentToken)
+			p.nextToken()
+			params := p.parseParameters()
+			p.nextToken() // Consumir el ')'
+			return p.parseArrowFunction(start, params)
+		}
 		p.nextToken()
 		expr := p.parseExpression(0)
 		if p.currentToken.Type == lexer.TOKEN_PARENTESIS_DER {
@@ -531,14 +1096,11 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	}
 }
 
-func (p *Parser) parseCallExpression() ast.Expression {
+// parseCallExpression parsea los argumentos de una llamada. La función puede
+// ser cualquier expresión: un nombre, un elemento de una lista u otra llamada.
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	expr := &ast.CallExpression{
-		Function: &ast.Identifier{Value: p.currentToken.Value},
-	}
-	p.nextToken() // Consumir el identificador
-	
-	if p.currentToken.Type != lexer.TOKEN_PARENTESIS_IZQ {
-		return nil
+		Function: function,
 	}
 	
 	p.nextToken() // Consumir el paréntesis izquierdo
@@ -546,11 +1108,18 @@ func (p *Parser) parseCallExpression() ast.Expression {
 	// Parsear argumentos
 	expr.Arguments = []ast.Expression{}
 	if p.currentToken.Type != lexer.TOKEN_PARENTESIS_DER {
-		expr.Arguments = append(expr.Arguments, p.parseExpression(0))
-		
-		for p.currentToken.Type == lexer.TOKEN_COMA {
+		after := "("
+		for {
+			arg := p.parseRequired("un argumento", after)
+			if arg == nil {
+				return nil
+			}
+			expr.Arguments = append(expr.Arguments, arg)
+			if p.currentToken.Type != lexer.TOKEN_COMA {
+				break
+			}
+			after = ","
 			p.nextToken()
-			expr.Arguments = append(expr.Arguments, p.parseExpression(0))
 		}
 	}
 	
@@ -558,6 +1127,160 @@ func (p *Parser) parseCallExpression() ast.Expression {
 		p.nextToken()
 	}
 	
+	expr.Loc = ast.Span{Start: function.Span().Start, End: tokenEnd(p.previous)}
+	return expr
+}
+
+// parseString construye el literal de una cadena: un StringLiteral o, si
+// tiene expresiones ${...}, un InterpolatedString con ellas ya analizadas
+func (p *Parser) parseString(tok lexer.Token) ast.Expression {
+	parts, errs := lexer.SplitString(tok)
+	p.errors = append(p.errors, errs...)
+	if len(parts) == 0 {
+		return &ast.StringLiteral{Value: "", Loc: tokenSpan(tok)}
+	}
+	if len(parts) == 1 && !parts[0].Expr {
+		return &ast.StringLiteral{Value: parts[0].Text, Loc: tokenSpan(tok)}
+	}
+
+	str := &ast.InterpolatedString{Loc: tokenSpan(tok)}
+	for _, part := range parts {
+		span := ast.Span{Start: part.Pos, End: part.End}
+		if !part.Expr {
+			str.Parts = append(str.Parts, &ast.StringLiteral{Value: part.Text, Loc: span})
+			continue
+		}
+		if expr := p.parseEmbedded(part, span); expr != nil {
+			str.Parts = append(str.Parts, expr)
+		}
+	}
+	return str
+}
+
+// parseEmbedded analiza el código de una expresión ${...} con un parser
+// propio. Los errores se añaden a los de este parser.
+func (p *Parser) parseEmbedded(part lexer.StringPart, span ast.Span) ast.Expression {
+	tokens, errs := lexer.TokenizeAt(part.Text, part.Pos)
+	p.errors = append(p.errors, errs...)
+	if len(errs) > 0 {
+		return nil
+	}
+	if tokens[0].Type == lexer.TOKEN_EOF {
+		p.errorSpan(span, diagnostic.CodeExpectedExpression, "falta la expresión dentro de '${}'")
+		return nil
+	}
+
+	sub := New(tokens)
+	expr := sub.parseExpression(0)
+	switch {
+	case len(sub.errors) > 0:
+	case sub.currentToken.Type == lexer.TOKEN_EOF && expr == nil:
+		sub.errorAt(sub.currentToken, diagnostic.CodeExpectedExpression, "se esperaba una expresión dentro de '${...}'")
+	case expr == nil:
+		sub.errorAt(sub.currentToken, diagnostic.CodeUnexpectedToken, "token inesperado %s", describe(sub.currentToken))
+	case sub.currentToken.Type != lexer.TOKEN_EOF:
+		sub.errorAt(sub.currentToken, diagnostic.CodeUnexpectedToken, "token inesperado %s dentro de '${...}'", describe(sub.currentToken)).
+			WithHint("dentro de '${...}' solo puede ir una expresión")
+	}
+	p.errors = append(p.errors, sub.errors...)
+	if len(sub.errors) > 0 {
+		return nil
+	}
+	return expr
+}
+
+func (p *Parser) parseListLiteral() ast.Expression {
+	list := &ast.ListLiteral{Elements: []ast.Expression{}}
+	start := p.currentToken
+	p.nextToken() // Consumir el '['
+	
+	if p.currentToken.Type != lexer.TOKEN_CORCHETE_DER {
+		for {
+			el := p.parseExpression(0)
+			if el == nil {
+				p.errorAt(p.currentToken, diagnostic.CodeExpectedExpression, "se esperaba un elemento de la lista, pero se encontró %s", describe(p.currentToken))
+				return nil
+			}
+			list.Elements = append(list.Elements, el)
+			if p.currentToken.Type != lexer.TOKEN_COMA {
+				break
+			}
+			p.nextToken() // Consumir la ','
+		}
+	}
+	
+	if p.currentToken.Type != lexer.TOKEN_CORCHETE_DER {
+		p.errorAt(p.currentToken, diagnostic.CodeUnclosedBlock, "se esperaba ']' para cerrar la lista, pero se encontró %s", describe(p.currentToken)).
+			WithHint("la lista se abrió en la línea %d, columna %d", start.Line, start.Column)
+		return nil
+	}
+	p.nextToken() // Consumir el ']'
+	
+	list.Loc = p.spanFrom(start)
+	return list
+}
+
+func (p *Parser) parseDictLiteral() ast.Expression {
+	dict := &ast.DictLiteral{Pairs: []*ast.DictPair{}}
+	start := p.currentToken
+	p.nextToken() // Consumir el '{'
+	
+	if p.currentToken.Type != lexer.TOKEN_LLAVE_DER {
+		for {
+			key := p.parseExpression(0)
+			if key == nil {
+				p.errorAt(p.currentToken, diagnostic.CodeExpectedExpression, "se esperaba una clave del diccionario, pero se encontró %s", describe(p.currentToken))
+				return nil
+			}
+			if p.currentToken.Type != lexer.TOKEN_DOS_PUNTOS {
+				p.errorAt(p.currentToken, diagnostic.CodeExpectedToken, "se esperaba ':' después de la clave, pero se encontró %s", describe(p.currentToken))
+				return nil
+			}
+			p.nextToken() // Consumir el ':'
+			value := p.parseExpression(0)
+			if value == nil {
+				p.errorAt(p.currentToken, diagnostic.CodeExpectedExpression, "se esperaba un valor después de ':', pero se encontró %s", describe(p.currentToken))
+				return nil
+			}
+			dict.Pairs = append(dict.Pairs, &ast.DictPair{Key: key, Value: value})
+			if p.currentToken.Type != lexer.TOKEN_COMA {
+				break
+			}
+			p.nextToken() // Consumir la ','
+		}
+	}
+	
+	if p.currentToken.Type != lexer.TOKEN_LLAVE_DER {
+		p.errorAt(p.currentToken, diagnostic.CodeUnclosedBlock, "se esperaba '}' para cerrar el diccionario, pero se encontró %s", describe(p.currentToken)).
+			WithHint("el diccionario se abrió en la línea %d, columna %d", start.Line, start.Column)
+		return nil
+	}
+	p.nextToken() // Consumir el '}'
+	
+	dict.Loc = p.spanFrom(start)
+	return dict
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	expr := &ast.IndexExpression{
+		Left: left,
+	}
+	bracket := p.currentToken
+	p.nextToken() // Consumir el '['
+	
+	expr.Index = p.parseExpression(0)
+	if expr.Index == nil {
+		p.errorAt(bracket, diagnostic.CodeExpectedExpression, "se esperaba un índice entre '[' y ']'")
+		return nil
+	}
+	
+	if p.currentToken.Type != lexer.TOKEN_CORCHETE_DER {
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedToken, "se esperaba ']' después del índice, pero se encontró %s", describe(p.currentToken))
+		return nil
+	}
+	p.nextToken() // Consumir el ']'
+	
+	expr.Loc = ast.Span{Start: left.Span().Start, End: tokenEnd(p.previous)}
 	return expr
 }
 
@@ -569,49 +1292,67 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	
 	precedence := p.currentPrecedence()
 	p.nextToken()
-	// Para operadores de izquierda a derecha, usar precedence - 1 para que operadores de mayor precedencia
-	// se agrupen primero. Esto asegura que n % i == 0 se parsea como (n % i) == 0
-	expr.Right = p.parseExpression(precedence - 1)
+	// Los operadores son asociativos por la izquierda: el lado derecho solo absorbe
+	// operadores de mayor precedencia. Así n % i == 0 se parsea como (n % i) == 0
+	// y "a" + b + "c" como ("a" + b) + "c"
+	expr.Right = p.parseExpression(precedence)
+	if expr.Right == nil {
+		p.errorAt(p.currentToken, diagnostic.CodeExpectedExpression, "se esperaba una expresión después del operador '%s'", expr.Operator)
+		return nil
+	}
 	
+	expr.Loc = spanBetween(left, expr.Right)
 	return expr
 }
 
-func (p *Parser) currentPrecedence() int {
-	switch p.currentToken.Type {
-	case lexer.TOKEN_SUMA, lexer.TOKEN_RESTA:
-		return 3
-	case lexer.TOKEN_MULTIPLICAR, lexer.TOKEN_DIVIDIR, lexer.TOKEN_MODULO:
-		return 4
-	case lexer.TOKEN_MENOR, lexer.TOKEN_MAYOR, lexer.TOKEN_MENOR_IGUAL, lexer.TOKEN_MAYOR_IGUAL:
-		return 5
-	case lexer.TOKEN_IGUAL, lexer.TOKEN_DIFERENTE:
-		return 6
-	case lexer.TOKEN_AND:
-		return 7
-	case lexer.TOKEN_OR:
-		return 8
-	default:
+// Precedencias de los operadores (mayor valor = se agrupa antes)
+const (
+	orPrecedence         = 1
+	andPrecedence        = 2
+	equalityPrecedence   = 3
+	comparisonPrecedence = 4
+	sumPrecedence        = 5
+	productPrecedence    = 6
+	prefixPrecedence     = 7
+)
+
+// PrefixPrecedence es la precedencia de los operadores prefijos '-' y '!',
+// mayor que la de cualquier operador infijo
+const PrefixPrecedence = prefixPrecedence
+
+// OperatorPrecedence devuelve la precedencia de un operador infijo, escrito
+// como aparece en ast.InfixExpression, o 0 si no es un operador infijo
+func OperatorPrecedence(operator string) int {
+	tok := lexer.New(operator).NextToken()
+	if tok.Value != operator {
 		return 0
 	}
+	return precedenceOf(tok.Type)
 }
 
-func (p *Parser) peekPrecedence() int {
-	peek := p.peekToken()
-	switch peek.Type {
+func precedenceOf(tokType lexer.TokenType) int {
+	switch tokType {
+	case lexer.TOKEN_OR:
+		return orPrecedence
+	case lexer.TOKEN_AND:
+		return andPrecedence
+	case lexer.TOKEN_IGUAL, lexer.TOKEN_DIFERENTE:
+		return equalityPrecedence
+	case lexer.TOKEN_MENOR, lexer.TOKEN_MAYOR, lexer.TOKEN_MENOR_IGUAL, lexer.TOKEN_MAYOR_IGUAL:
+		return comparisonPrecedence
 	case lexer.TOKEN_SUMA, lexer.TOKEN_RESTA:
-		return 3
+		return sumPrecedence
 	case lexer.TOKEN_MULTIPLICAR, lexer.TOKEN_DIVIDIR, lexer.TOKEN_MODULO:
-		return 4
-	case lexer.TOKEN_MENOR, lexer.TOKEN_MAYOR, lexer.TOKEN_MENOR_IGUAL, lexer.TOKEN_MAYOR_IGUAL:
-		return 5
-	case lexer.TOKEN_IGUAL, lexer.TOKEN_DIFERENTE:
-		return 6
-	case lexer.TOKEN_AND:
-		return 7
-	case lexer.TOKEN_OR:
-		return 8
+		return productPrecedence
 	default:
 		return 0
 	}
 }
 
+func (p *Parser) currentPrecedence() int {
+	return precedenceOf(p.currentToken.Type)
+}
+
+func (p *Parser) peekPrecedence() int {
+	return precedenceOf(p.peekToken().Type)
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"flux/ast"
+	"flux/diagnostic"
+	"flux/lexer"
+	"testing"
+)
+
+func parse(t *testing.T, source string) (*ast.Program, diagnostic.List) {
+	t.Helper()
+	tokens, err := lexer.New(source).Tokenize()
+	if err != nil {
+		t.Fatalf("error del lexer en %q: %v", source, err)
+	}
+	p := New(tokens)
+	program, _ := p.Parse()
+	return program, p.Errors()
+}
+
+// Las expresiones obligatorias que faltan se reportan en el token donde
+// debería empezar la expresión, y el análisis sigue con lo demás
+func TestMissingExpression(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+		line    int
+		column  int
+	}{
+		{"si entonces\n    mostrar 1\nfin", "se esperaba una condición después de 'si', pero se encontró 'entonces'", 1, 4},
+		{"si\n    mostrar 1\nfin", "se esperaba una condición después de 'si', pero se encontró 'mostrar'", 2, 5},
+		{"mientras hacer\n    mostrar 1\nfin", "se esperaba una condición después de 'mientras', pero se encontró 'hacer'", 1, 10},
+		{"repetir i desde hasta 3 hacer\nfin", "se esperaba el valor inicial después de 'desde', pero se encontró 'hasta'", 1, 17},
+		{"repetir i desde 1 hasta hacer\nfin", "se esperaba el valor final después de 'hasta', pero se encontró 'hacer'", 1, 25},
+		{"f(1, )", "se esperaba un argumento después de ',', pero se encontró ')'", 1, 6},
+		{"mostrar", "se esperaba un valor después de 'mostrar', pero se encontró el final del archivo", 1, 8},
+		{"mostrar()", "se esperaba un valor después de '(', pero se encontró ')'", 1, 9},
+		{"mostrar(f(, 2))", "se esperaba un argumento después de '(', pero se encontró ','", 1, 11},
+	}
+	for _, tt := range tests {
+		program, errors := parse(t, tt.source)
+		if len(errors) != 1 {
+			t.Errorf("%q: se esperaba 1 error, pero hubo %d: %v", tt.source, len(errors), errors)
+			continue
+		}
+		d := errors[0]
+		if d.Code != diagnostic.CodeExpectedExpression || d.Message != tt.message ||
+			d.Span.Start.Line != tt.line || d.Span.Start.Column != tt.column {
+			t.Errorf("%q: error [%s] %d:%d %q; se esperaba [%s] %d:%d %q", tt.source,
+				d.Code, d.Span.Start.Line, d.Span.Start.Column, d.Message,
+				diagnostic.CodeExpectedExpression, tt.line, tt.column, tt.message)
+		}
+		if len(program.Statements) != 0 {
+			t.Errorf("%q: la sentencia incompleta no debe quedar en el programa: %v", tt.source, program.Statements)
+		}
+	}
+}
+
+// Un bloque sin condición no impide reportar los errores de su cuerpo ni
+// analizar las sentencias que lo siguen
+func TestMissingConditionKeepsParsing(t *testing.T) {
+	source := `si entonces
+    mostrar(1 +)
+fin
+mientras hacer
+fin
+definir x = 1
+mostrar(x)`
+	program, errors := parse(t, source)
+	var lines []int
+	for _, d := range errors {
+		lines = append(lines, d.Span.Start.Line)
+	}
+	if len(lines) != 3 || lines[0] != 1 || lines[1] != 2 || lines[2] != 4 {
+		t.Errorf("se esperaban errores en las líneas 1, 2 y 4, pero hubo: %v", errors)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("se esperaban las 2 sentencias finales, pero hubo %d", len(program.Statements))
+	}
+	if _, ok := program.Statements[0].(*ast.DeclareStatement); !ok {
+		t.Errorf("la primera sentencia es %T, se esperaba la declaración de x", program.Statements[0])
+	}
+}
+
+// Una palabra clave mal escrita da un error de sintaxis que sugiere la
+// palabra correcta
+func TestMisspelledKeyword(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+		hint    string
+		line    int
+		column  int
+	}{
+		{`mostar "hola"`, `el nombre 'mostar' no puede ir seguido de '"hola"'`, "¿quisiste decir 'mostrar'?", 1, 1},
+		{"definr x = 3", "el nombre 'definr' no puede ir seguido de 'x'", "¿quisiste decir 'definir'?", 1, 1},
+		{"si x > 1 entoces\n    mostrar x\nfin", "se esperaba 'entonces' después de la condición, pero se encontró 'entoces'", "¿quisiste decir 'entonces'?", 1, 10},
+		{"mientras x hcer\n    salir\nfin", "se esperaba 'hacer' después de la condición, pero se encontró 'hcer'", "¿quisiste decir 'hacer'?", 1, 12},
+		{"repetir i dsde 1 hasta 3 hacer\nfin", "se esperaba 'desde', pero se encontró 'dsde'", "¿quisiste decir 'desde'?", 1, 11},
+		{"función f(x) hcer\n    retornar x\nfin", "se esperaba 'hacer' después de los parámetros, pero se encontró 'hcer'", "¿quisiste decir 'hacer'?", 1, 14},
+		// El bloque de un bucle mal escrito se salta entero con su 'fin'
+		{"mientars x hacer\n    salir\nfin", "el nombre 'mientars' no puede ir seguido de 'x'", "¿quisiste decir 'mientras'?", 1, 1},
+	}
+	for _, tt := range tests {
+		_, errors := parse(t, tt.source)
+		if len(errors) != 1 {
+			t.Errorf("%q: se esperaba 1 error, pero hubo %d: %v", tt.source, len(errors), errors)
+			continue
+		}
+		d := errors[0]
+		if d.Message != tt.message || d.Hint != tt.hint || d.Span.Start.Line != tt.line || d.Span.Start.Column != tt.column {
+			t.Errorf("%q: error %d:%d %q (%q); se esperaba %d:%d %q (%q)", tt.source,
+				d.Span.Start.Line, d.Span.Start.Column, d.Message, d.Hint, tt.line, tt.column, tt.message, tt.hint)
+		}
+	}
+}
+
+// Los nombres que se parecen a una palabra clave son válidos donde va un
+// nombre, también solos en una línea dentro de una llamada de varias líneas
+func TestNearKeywordNames(t *testing.T) {
+	sources := []string{
+		"definir definido = 1\nmostrar(max(\n    1,\n    definido\n))",
+		"definir capturas = 3\ncapturas = capturas + 1",
+		"definir retorno = 1\nmostrar([\n    retorno\n])",
+		"definir mostrado = falso\nsi mostrado entonces\n    mostrar 1\nfin",
+		"definir hacerlo = 1\nhacerlo",
+	}
+	for _, source := range sources {
+		program, errors := parse(t, source)
+		if len(errors) != 0 {
+			t.Errorf("%q: errores inesperados: %v", source, errors)
+		}
+		if len(program.Statements) != 2 {
+			t.Errorf("%q: se esperaban 2 sentencias, pero hubo %d", source, len(program.Statements))
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Package repl implementa la consola interactiva de Flux: lee código línea
+// a línea, lo ejecuta y muestra el valor de las expresiones sueltas.
+package repl
+
+import (
+	"bufio"
+	"flux/ast"
+	"flux/diagnostic"
+	"flux/evaluator"
+	"flux/lexer"
+	"flux/parser"
+	"flux/semantic"
+	"flux/symbol"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	prompt         = "flux> "
+	continuePrompt = "...   "
+	inputName      = "<entrada>"
+)
+
+const help = `Escribe código de Flux para ejecutarlo. Los bloques (si, mientras, repetir,
+función, intentar) se leen hasta su 'fin'.
+
+Comandos:
+  :tokens [código]   muestra los tokens del código (o de la última entrada)
+  :ast [código]      muestra el árbol sintáctico del código (o de la última entrada)
+  :vars              muestra las variables definidas
+  :cargar archivo    ejecuta un archivo .flux en esta sesión
+  :cancelar          descarta el bloque que se está escribiendo
+  :ayuda             muestra esta ayuda
+  :salir             termina la sesión
+`
+
+// REPL es una sesión interactiva. La tabla de símbolos y el evaluador se
+// conservan entre entradas, así que lo definido en una línea se puede usar
+// en las siguientes.
+type REPL struct {
+	out          io.Writer
+	table        *symbol.Table
+	eval         *evaluator.Evaluator
+	dynamicScope bool
+	last         string // Última entrada ejecutada, para :tokens y :ast sin argumentos
+}
+
+// New crea una sesión que escribe sus mensajes y lo que muestran los
+// programas en out. 'leer' y las demás funciones de entrada leen de in.
+func New(in io.Reader, out io.Writer, dynamicScope bool) *REPL {
+	table := symbol.NewTable()
+	options := []evaluator.Option{evaluator.WithInput(in), evaluator.WithOutput(out)}
+	if dynamicScope {
+		options = append(options, evaluator.WithDynamicScope())
+	}
+	return &REPL{
+		out:          out,
+		table:        table,
+		eval:         evaluator.New(table, options...),
+		dynamicScope: dynamicScope,
+	}
+}
+
+// Start ejecuta una sesión interactiva hasta que la entrada se acaba o se
+// escribe :salir
+func Start(in io.Reader, out io.Writer, dynamicScope bool) {
+	// Las líneas de código y lo que leen los programas salen del mismo
+	// lector: uno aparte para 'leer' no vería lo que este ya tiene en su
+	// búfer. El evaluador usa este mismo lector en lugar de envolverlo otra
+	// vez, porque ya es un *bufio.Reader.
+	reader := bufio.NewReader(in)
+	r := New(reader, out, dynamicScope)
+	fmt.Fprintln(out, "Flux — escribe :ayuda para ver los comandos")
+
+	var buffer strings.Builder
+	for {
+		if buffer.Len() == 0 {
+			fmt.Fprint(out, prompt)
+		} else {
+			fmt.Fprint(out, continuePrompt)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(out)
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		trimmed := strings.TrimSpace(line)
+
+		if buffer.Len() == 0 {
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, ":") {
+				if !r.command(trimmed) {
+					return
+				}
+				continue
+			}
+		} else if trimmed == ":cancelar" {
+			buffer.Reset()
+			continue
+		}
+
+		buffer.WriteString(line)
+		buffer.WriteString("\n")
+		if incomplete(buffer.String()) {
+			continue
+		}
+		r.Run(inputName, buffer.String())
+		buffer.Reset()
+	}
+}
+
+// incomplete indica si a la entrada le faltan líneas: bloques sin su 'fin',
+// paréntesis, corchetes o llaves sin cerrar o una cadena de varias líneas
+// sin sus comillas de cierre
+func incomplete(source string) bool {
+	tokens, _ := lexer.New(source).Tokenize()
+	blocks, brackets := 0, 0
+	for _, tok := range tokens {
+		switch tok.Type {
+		case lexer.TOKEN_CADENA:
+			// El lexer cierra las cadenas sin cerrar, así que su valor no
+			// coincide con el código
+			multiline := strings.HasPrefix(tok.Value, `"""`) || strings.HasPrefix(tok.Value, "'''")
+			if multiline && source[tok.Offset:tok.EndOffset] != tok.Value {
+				return true
+			}
+		case lexer.TOKEN_SI, lexer.TOKEN_MIENTRAS, lexer.TOKEN_REPETIR, lexer.TOKEN_FUNCION, lexer.TOKEN_INTENTAR:
+			blocks++
+		case lexer.TOKEN_FIN:
+			blocks--
+		case lexer.TOKEN_PARENTESIS_IZQ, lexer.TOKEN_CORCHETE_IZQ, lexer.TOKEN_LLAVE_IZQ:
+			brackets++
+		case lexer.TOKEN_PARENTESIS_DER, lexer.TOKEN_CORCHETE_DER, lexer.TOKEN_LLAVE_DER:
+			brackets--
+		}
+	}
+	return blocks > 0 || brackets > 0
+}
+
+// Run analiza y ejecuta código en la sesión. Si la última sentencia es una
+// expresión suelta, muestra su valor.
+func (r *REPL) Run(name, source string) {
+	program, ok := r.parse(name, source)
+	if !ok {
+		return
+	}
+
+	// Los nombres definidos en entradas anteriores ya existen
+	predeclared := append(evaluator.BuiltinNames(), r.table.Names()...)
+	analyzer := semantic.New(predeclared, evaluator.ConstantNames())
+	analyzer.SetDynamicScope(r.dynamicScope)
+	if analyzer.Analyze(program) != nil {
+		diagnostic.RenderAll(r.out, name, source, analyzer.Errors())
+		return
+	}
+	r.last = source
+
+	var echo *ast.ExpressionStatement
+	if n := len(program.Statements); n > 0 {
+		if stmt, ok := program.Statements[n-1].(*ast.ExpressionStatement); ok {
+			echo = stmt
+			program.Statements = program.Statements[:n-1]
+		}
+	}
+
+	if err := r.eval.Evaluate(program); err != nil {
+		r.reportRuntimeError(err)
+		return
+	}
+	if echo != nil {
+		value, err := r.eval.EvaluateExpression(echo.Expression)
+		if err != nil {
+			r.reportRuntimeError(err)
+			return
+		}
+		// Las llamadas a funciones que no retornan nada no muestran 'nulo'
+		if value != nil {
+			fmt.Fprintln(r.out, evaluator.Inspect(value))
+		}
+	}
+}
+
+// parse analiza el código y muestra los diagnósticos si los hay
+func (r *REPL) parse(name, source string) (*ast.Program, bool) {
+	l := lexer.New(source)
+	tokens, _ := l.Tokenize()
+	p := parser.New(tokens)
+	program, _ := p.Parse()
+	diagnostics := append(l.Diagnostics(), p.Errors()...)
+	if diagnostics.HasErrors() {
+		diagnostics.Sort()
+		diagnostic.RenderAll(r.out, name, source, diagnostics)
+		return nil, false
+	}
+	return program, true
+}
+
+func (r *REPL) reportRuntimeError(err error) {
+	if runtimeErr, ok := err.(*evaluator.RuntimeError); ok {
+		fmt.Fprintf(r.out, "Error en ejecución %s", runtimeErr.Traceback())
+	} else {
+		fmt.Fprintf(r.out, "Error en ejecución: %v\n", err)
+	}
+}
+
+// command ejecuta un comando que empieza por ':'. Devuelve false si la
+// sesión debe terminar.
+func (r *REPL) command(input string) bool {
+	name, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":salir":
+		return false
+	case ":ayuda":
+		fmt.Fprint(r.out, help)
+	case ":tokens":
+		r.showTokens(r.argOrLast(arg))
+	case ":ast":
+		r.showAST(r.argOrLast(arg))
+	case ":vars":
+		r.showVars()
+	case ":cargar":
+		r.load(arg)
+	case ":cancelar":
+		// Sin bloque abierto no hay nada que descartar
+	default:
+		fmt.Fprintf(r.out, "comando desconocido '%s' (escribe :ayuda para ver los comandos)\n", name)
+	}
+	return true
+}
+
+func (r *REPL) argOrLast(arg string) string {
+	if arg != "" {
+		return arg
+	}
+	return r.last
+}
+
+func (r *REPL) showTokens(source string) {
+	l := lexer.New(source)
+	tokens, _ := l.Tokenize()
+	for _, tok := range tokens {
+		if tok.Type == lexer.TOKEN_EOF {
+			break
+		}
+		fmt.Fprintln(r.out, tok)
+	}
+	if diagnostics := l.Diagnostics(); len(diagnostics) > 0 {
+		diagnostic.RenderAll(r.out, inputName, source, diagnostics)
+	}
+}
+
+func (r *REPL) showAST(source string) {
+	program, ok := r.parse(inputName, source)
+	if !ok {
+		return
+	}
+	program.Print(0)
+}
+
+func (r *REPL) showVars() {
+	names := r.table.Names()
+	if len(names) == 0 {
+		fmt.Fprintln(r.out, "(no hay variables definidas)")
+		return
+	}
+	for _, name := range names {
+		value, _ := r.table.Get(name)
+		kind := "definir"
+		if r.table.IsConst(name) {
+			kind = "constante"
+		}
+		if _, ok := value.(*evaluator.Function); ok {
+			kind = "función"
+		}
+		fmt.Fprintf(r.out, "%-10s %s = %s\n", kind, name, evaluator.Inspect(value))
+	}
+}
+
+func (r *REPL) load(filename string) {
+	if filename == "" {
+		fmt.Fprintln(r.out, "uso: :cargar archivo.flux")
+		return
+	}
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(r.out, "Error leyendo archivo: %v\n", err)
+		return
+	}
+	r.Run(filename, strings.TrimPrefix(string(source), "\uFEFF"))
+}
@@ -0,0 +1,39 @@
+package repl
+
+import (
+	"strings"
+	"testing"
+)
+
+// 'leer' y 'mostrar' usan la entrada y la salida de la sesión. Lo que lee
+// 'leer' no se ejecuta después como código.
+func TestSessionStreams(t *testing.T) {
+	input := "definir n = leer()\nAna\nmostrar(\"Hola, \" + n)\nlongitud(n)\n"
+	var out strings.Builder
+	Start(strings.NewReader(input), &out, false)
+
+	want := "Flux — escribe :ayuda para ver los comandos\n" +
+		prompt +
+		prompt + "Hola, Ana\n" +
+		prompt + "3\n" +
+		prompt + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("la sesión escribió:\n%s\nse esperaba:\n%s", got, want)
+	}
+}
+
+// Un bloque de varias líneas puede leer la entrada que sigue a su 'fin', y
+// la última línea se ejecuta aunque no termine en un salto de línea
+func TestSessionReadsAfterBlock(t *testing.T) {
+	input := "repetir i desde 1 hasta 2 hacer\n    mostrar(leer_numero() * 2)\nfin\n20\n21\nmostrar(\"fin\")"
+	var out strings.Builder
+	Start(strings.NewReader(input), &out, false)
+
+	want := "Flux — escribe :ayuda para ver los comandos\n" +
+		prompt + continuePrompt + continuePrompt + "40\n42\n" +
+		prompt + "fin\n" +
+		prompt + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("la sesión escribió:\n%s\nse esperaba:\n%s", got, want)
+	}
+}
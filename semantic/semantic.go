@@ -0,0 +1,330 @@
+package semantic
+
+import (
+	"flux/ast"
+	"flux/diagnostic"
+	"flux/lexer"
+)
+
+type bindingKind int
+
+const (
+	kindVariable bindingKind = iota
+	kindConstant
+	kindFunction
+	kindParameter
+	kindPredeclared
+)
+
+// binding describe un nombre declarado en un scope
+type binding struct {
+	kind  bindingKind
+	arity int // Número de parámetros si es una función conocida, -1 si no se sabe
+}
+
+// scope refleja los scopes del evaluador: solo las funciones crean uno nuevo,
+// los bloques de si/mientras/repetir comparten el de la función que los contiene
+type scope struct {
+	names  map[string]*binding
+	parent *scope
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{names: make(map[string]*binding), parent: parent}
+}
+
+func (s *scope) lookup(name string) *binding {
+	for sc := s; sc != nil; sc = sc.parent {
+		if b, ok := sc.names[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// visibleNames devuelve los nombres de este scope y de todos sus padres
+func (s *scope) visibleNames() []string {
+	var names []string
+	for sc := s; sc != nil; sc = sc.parent {
+		for name := range sc.names {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// pendingBody es el cuerpo de una función cuya resolución se aplaza hasta
+// terminar el scope que la contiene, para que pueda usar nombres que se
+// declaran después de ella (recursión mutua, variables globales...)
+type pendingBody struct {
+	params []*ast.Identifier
+	body   *ast.BlockStatement
+	parent *scope
+}
+
+// Analyzer recorre el AST entre el parser y el evaluador y detecta nombres
+// no definidos, reasignaciones de constantes y llamadas con un número
+// incorrecto de argumentos
+type Analyzer struct {
+	predeclared  []string
+	constants    []string
+	dynamicScope bool
+	errors       diagnostic.List
+	pending      []pendingBody
+	depth        int // Profundidad de funciones anidadas
+}
+
+// New crea un analizador. predeclared son los nombres disponibles sin
+// declararlos (las funciones predefinidas del evaluador) y constants las
+// constantes predefinidas, como PI, que el programa no puede cambiar.
+func New(predeclared, constants []string) *Analyzer {
+	return &Analyzer{predeclared: predeclared, constants: constants}
+}
+
+// SetDynamicScope indica que el programa se ejecutará con el scope dinámico
+// de compatibilidad. En ese modo los cuerpos de las funciones pueden ver
+// variables de quien las llama, así que no se reportan como no definidas.
+func (a *Analyzer) SetDynamicScope(enabled bool) {
+	a.dynamicScope = enabled
+}
+
+// Analyze analiza el programa completo y devuelve todos los problemas
+// encontrados como una diagnostic.List, o nil si no hay ninguno
+func (a *Analyzer) Analyze(program *ast.Program) error {
+	a.errors = nil
+
+	globals := newScope(nil)
+	for _, name := range a.predeclared {
+		globals.names[name] = &binding{kind: kindPredeclared, arity: -1}
+	}
+	// Los nombres del programa van en un scope propio para poder redefinir
+	// las funciones predefinidas. Las constantes predefinidas se declaran en
+	// él, como si el programa empezara declarándolas, para que no se puedan
+	// reasignar ni redeclarar.
+	programScope := newScope(globals)
+	for _, name := range a.constants {
+		programScope.names[name] = &binding{kind: kindConstant, arity: -1}
+	}
+
+	a.resolveBody(program.Statements, programScope)
+
+	// Los cuerpos de las funciones se resuelven al final; se ordena por posición
+	a.errors.Sort()
+	return a.errors.Err()
+}
+
+// Errors devuelve los problemas encontrados en el último análisis
+func (a *Analyzer) Errors() diagnostic.List {
+	return a.errors
+}
+
+func (a *Analyzer) errorf(code string, span ast.Span, format string, args ...interface{}) *diagnostic.Diagnostic {
+	d := diagnostic.Errorf(code, span, format, args...)
+	a.errors = append(a.errors, d)
+	return d
+}
+
+// resolveBody resuelve las sentencias de un scope y después los cuerpos de
+// las funciones declaradas en él
+func (a *Analyzer) resolveBody(statements []ast.Statement, sc *scope) {
+	outerPending := a.pending
+	a.pending = nil
+
+	for _, stmt := range statements {
+		a.resolveStatement(stmt, sc)
+	}
+
+	pending := a.pending
+	a.pending = outerPending
+
+	for _, fn := range pending {
+		fnScope := newScope(fn.parent)
+		for _, param := range fn.params {
+			fnScope.names[param.Value] = &binding{kind: kindParameter, arity: -1}
+		}
+		a.depth++
+		a.resolveBody(fn.body.Statements, fnScope)
+		a.depth--
+	}
+}
+
+func (a *Analyzer) resolveBlock(block *ast.BlockStatement, sc *scope) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		a.resolveStatement(stmt, sc)
+	}
+}
+
+func (a *Analyzer) resolveStatement(stmt ast.Statement, sc *scope) {
+	switch s := stmt.(type) {
+	case *ast.DeclareStatement:
+		a.resolveExpression(s.Value, sc)
+		if existing, ok := sc.names[s.Name.Value]; ok && existing.kind == kindConstant {
+			a.errorf(diagnostic.CodeConstant, s.Name.Loc, "no se puede redeclarar la constante '%s'", s.Name.Value)
+			return
+		}
+		kind := kindVariable
+		if s.IsConst {
+			kind = kindConstant
+		}
+		sc.names[s.Name.Value] = &binding{kind: kind, arity: literalArity(s.Value)}
+	case *ast.AssignStatement:
+		a.resolveExpression(s.Value, sc)
+		b := sc.lookup(s.Name.Value)
+		switch {
+		case b == nil:
+			// Asignar a un nombre nuevo lo declara en el scope actual
+			sc.names[s.Name.Value] = &binding{kind: kindVariable, arity: literalArity(s.Value)}
+		case b.kind == kindConstant:
+			a.errorf(diagnostic.CodeConstant, s.Name.Loc, "no se puede reasignar la constante '%s'", s.Name.Value)
+		default:
+			// El valor cambia, así que ya no se conoce su aridad con certeza
+			b.arity = -1
+		}
+	case *ast.IndexAssignStatement:
+		a.resolveExpression(s.Target.Left, sc)
+		a.resolveExpression(s.Target.Index, sc)
+		a.resolveExpression(s.Value, sc)
+	case *ast.IfStatement:
+		a.resolveExpression(s.Condition, sc)
+		a.resolveBlock(s.Then, sc)
+		a.resolveBlock(s.Else, sc)
+	case *ast.WhileStatement:
+		a.resolveExpression(s.Condition, sc)
+		a.resolveBlock(s.Body, sc)
+	case *ast.RepeatStatement:
+		a.resolveExpression(s.From, sc)
+		a.resolveExpression(s.To, sc)
+		if existing, ok := sc.names[s.Variable.Value]; ok && existing.kind == kindConstant {
+			a.errorf(diagnostic.CodeConstant, s.Variable.Loc, "no se puede usar la constante '%s' como variable de 'repetir'", s.Variable.Value)
+		} else {
+			sc.names[s.Variable.Value] = &binding{kind: kindVariable, arity: -1}
+		}
+		a.resolveBlock(s.Body, sc)
+	case *ast.FunctionStatement:
+		// El nombre se declara antes de resolver el cuerpo para permitir la recursión
+		if existing, ok := sc.names[s.Name.Value]; ok && existing.kind == kindConstant {
+			a.errorf(diagnostic.CodeConstant, s.Name.Loc, "no se puede redeclarar la constante '%s'", s.Name.Value)
+		} else {
+			sc.names[s.Name.Value] = &binding{kind: kindFunction, arity: len(s.Parameters)}
+		}
+		a.pending = append(a.pending, pendingBody{params: s.Parameters, body: s.Body, parent: sc})
+	case *ast.TryStatement:
+		a.resolveBlock(s.Body, sc)
+		if s.CatchName != nil {
+			sc.names[s.CatchName.Value] = &binding{kind: kindVariable, arity: -1}
+		}
+		a.resolveBlock(s.Catch, sc)
+		a.resolveBlock(s.Finally, sc)
+	case *ast.ThrowStatement:
+		a.resolveExpression(s.Value, sc)
+	case *ast.ShowStatement:
+		a.resolveExpression(s.Value, sc)
+	case *ast.ReturnStatement:
+		a.resolveExpression(s.Value, sc)
+	case *ast.ExpressionStatement:
+		// Un nombre suelto como sentencia suele ser una palabra clave mal
+		// escrita ('sinno'), así que también se sugieren las palabras clave
+		if ident, ok := s.Expression.(*ast.Identifier); ok {
+			a.resolveName(ident, sc, true)
+		} else {
+			a.resolveExpression(s.Expression, sc)
+		}
+	case *ast.BlockStatement:
+		a.resolveBlock(s, sc)
+	}
+}
+
+func (a *Analyzer) resolveExpression(expr ast.Expression, sc *scope) {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		a.resolveName(e, sc, false)
+	case *ast.InfixExpression:
+		a.resolveExpression(e.Left, sc)
+		a.resolveExpression(e.Right, sc)
+	case *ast.PrefixExpression:
+		a.resolveExpression(e.Right, sc)
+	case *ast.ListLiteral:
+		for _, el := range e.Elements {
+			a.resolveExpression(el, sc)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range e.Parts {
+			a.resolveExpression(part, sc)
+		}
+	case *ast.DictLiteral:
+		for _, pair := range e.Pairs {
+			a.resolveExpression(pair.Key, sc)
+			a.resolveExpression(pair.Value, sc)
+		}
+	case *ast.IndexExpression:
+		a.resolveExpression(e.Left, sc)
+		a.resolveExpression(e.Index, sc)
+	case *ast.FunctionLiteral:
+		a.pending = append(a.pending, pendingBody{params: e.Parameters, body: e.Body, parent: sc})
+	case *ast.CallExpression:
+		if ident, ok := e.Function.(*ast.Identifier); ok {
+			a.resolveName(ident, sc, true)
+		} else {
+			a.resolveExpression(e.Function, sc)
+		}
+		for _, arg := range e.Arguments {
+			a.resolveExpression(arg, sc)
+		}
+		a.checkArity(e, sc)
+	}
+}
+
+// resolveName comprueba que un nombre esté definido. Si no lo está, sugiere
+// el nombre visible más parecido; si keywords es verdadero, también las
+// palabras clave, porque 'mostar(x)' suele ser 'mostrar(x)' mal escrito.
+func (a *Analyzer) resolveName(ident *ast.Identifier, sc *scope, keywords bool) {
+	if sc.lookup(ident.Value) != nil {
+		return
+	}
+	if a.dynamicScope && a.depth > 0 {
+		return
+	}
+	d := a.errorf(diagnostic.CodeUndefinedName, ident.Loc, "el nombre '%s' no está definido", ident.Value)
+
+	candidates := sc.visibleNames()
+	if keywords {
+		candidates = append(candidates, lexer.Keywords()...)
+	}
+	if suggestion, ok := diagnostic.Closest(ident.Value, candidates, diagnostic.MaxDistance(ident.Value)); ok {
+		d.WithHint("¿quisiste decir '%s'?", suggestion)
+	}
+}
+
+// checkArity compara los argumentos de una llamada con los parámetros de la
+// función llamada, cuando se sabe con certeza cuál es
+func (a *Analyzer) checkArity(call *ast.CallExpression, sc *scope) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	b := sc.lookup(ident.Value)
+	if b == nil || b.arity < 0 || b.arity == len(call.Arguments) {
+		return
+	}
+	a.errorf(diagnostic.CodeArgumentCount, call.Loc, "la función '%s' espera %d %s, pero recibió %d",
+		ident.Value, b.arity, pluralArguments(b.arity), len(call.Arguments))
+}
+
+// literalArity devuelve el número de parámetros si la expresión es una
+// función anónima, o -1 en cualquier otro caso
+func literalArity(expr ast.Expression) int {
+	if fn, ok := expr.(*ast.FunctionLiteral); ok {
+		return len(fn.Parameters)
+	}
+	return -1
+}
+
+func pluralArguments(n int) string {
+	if n == 1 {
+		return "argumento"
+	}
+	return "argumentos"
+}
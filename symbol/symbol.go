@@ -1,6 +1,10 @@
 package symbol
 
-import "sync"
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
 
 type Table struct {
 	store  map[string]interface{}
@@ -50,6 +54,67 @@ func (t *Table) Set(name string, value interface{}) {
 	t.store[name] = value
 }
 
+// Assign actualiza la variable en el scope más cercano que ya la contiene.
+// Si ningún scope la contiene, la crea en el scope actual.
+func (t *Table) Assign(name string, value interface{}) error {
+	for scope := t; scope != nil; scope = scope.parent {
+		scope.mu.Lock()
+		if _, ok := scope.store[name]; ok {
+			defer scope.mu.Unlock()
+			if scope.consts[name] {
+				return fmt.Errorf("no se puede reasignar la constante '%s'", name)
+			}
+			scope.store[name] = value
+			return nil
+		}
+		scope.mu.Unlock()
+	}
+	t.Set(name, value)
+	return nil
+}
+
+// Names devuelve los nombres definidos en este scope (sin los padres),
+// ordenados alfabéticamente
+func (t *Table) Names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	names := make([]string, 0, len(t.store))
+	for name := range t.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VisibleNames devuelve los nombres definidos en este scope y en todos sus
+// padres, sin repetir y ordenados alfabéticamente
+func (t *Table) VisibleNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for scope := t; scope != nil; scope = scope.parent {
+		for _, name := range scope.Names() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsConst indica si el nombre es una constante de este scope
+func (t *Table) IsConst(name string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.consts[name]
+}
+
+// Parent devuelve el scope padre, o nil si es el scope global
+func (t *Table) Parent() *Table {
+	return t.parent
+}
+
 func (t *Table) SetConst(name string, value interface{}) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -0,0 +1,28 @@
+package trace
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+//go:embed viewer.html
+var viewer string
+
+// tracePlaceholder es el lugar del visor donde se inserta la traza
+const tracePlaceholder = "/*TRAZA*/"
+
+// WriteHTML escribe una página HTML autocontenida que recorre la traza paso
+// a paso: el código con la línea actual resaltada, la pila de llamadas, las
+// variables de cada scope y la salida acumulada.
+func WriteHTML(w io.Writer, t *Trace) error {
+	// json.Marshal escapa '<', '>' y '&', así que la traza no puede cerrar
+	// la etiqueta <script> en la que va
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, strings.Replace(viewer, tracePlaceholder, string(data), 1))
+	return err
+}
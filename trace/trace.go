@@ -0,0 +1,213 @@
+// Package trace registra la ejecución de un programa de Flux paso a paso:
+// cada sentencia ejecutada con las variables visibles en ese momento, y
+// cada entrada y salida de una función con sus argumentos y el valor que
+// retorna. La traza se puede exportar como JSON o como una página HTML que
+// la recorre junto al código.
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"flux/ast"
+	"flux/evaluator"
+	"flux/symbol"
+	"reflect"
+)
+
+// Eventos de la traza
+const (
+	EventStatement = "statement" // Antes de ejecutar una sentencia
+	EventCall      = "call"      // Al entrar en una función
+	EventReturn    = "return"    // Al salir de una función
+	EventEnd       = "end"       // Al terminar el programa
+)
+
+// DefaultMaxSteps es el número de pasos a partir del cual se deja de
+// registrar, para que un bucle infinito no produzca una traza sin fin
+const DefaultMaxSteps = 10000
+
+// ErrTooManySteps interrumpe el programa al llegar al máximo de pasos
+var ErrTooManySteps = errors.New("la traza llegó al máximo de pasos")
+
+// Trace es el resultado de ejecutar un programa
+type Trace struct {
+	File      string                  `json:"file"`
+	Source    string                  `json:"source"`
+	Steps     []Step                  `json:"steps"`
+	Truncated bool                    `json:"truncated"`       // Se alcanzó el máximo de pasos
+	Error     *evaluator.RuntimeError `json:"error,omitempty"` // Error que terminó el programa
+}
+
+// Step es un paso de la ejecución. Las variables son las visibles justo
+// antes de ejecutar la sentencia (o al entrar o salir de la función).
+type Step struct {
+	Step      int        `json:"step"`
+	Event     string     `json:"event"`
+	Line      int        `json:"line"`
+	Node      string     `json:"node,omitempty"` // Tipo de sentencia, como en 'flux ast'
+	Function  string     `json:"function"`
+	Depth     int        `json:"depth"`               // Llamadas en curso
+	Arguments []Variable `json:"arguments,omitempty"` // Solo en "call"
+	Return    *Value     `json:"return,omitempty"`    // Solo en "return" sin error
+	Error     string     `json:"error,omitempty"`
+	Printed   string     `json:"printed,omitempty"` // Salida de 'mostrar' desde el paso anterior
+	Scopes    []Scope    `json:"scopes"`
+}
+
+// Scope son las variables de un scope, del más interno al global
+type Scope struct {
+	Name      string     `json:"name"`
+	Variables []Variable `json:"variables"`
+}
+
+type Variable struct {
+	Name  string `json:"name"`
+	Const bool   `json:"const,omitempty"`
+	Value
+}
+
+// Recorder registra la traza. Implementa evaluator.Hook.
+type Recorder struct {
+	trace    *Trace
+	maxSteps int
+	output   bytes.Buffer // Lo que escribe 'mostrar'
+	printed  int          // Parte de output ya asignada a un paso
+	line     int          // Línea de la última sentencia registrada
+}
+
+// New prepara la traza de un programa. Se registran como mucho maxSteps
+// pasos.
+func New(filename, source string, maxSteps int) *Recorder {
+	return &Recorder{
+		trace:    &Trace{File: filename, Source: source, Steps: []Step{}},
+		maxSteps: maxSteps,
+	}
+}
+
+// Run ejecuta el programa registrando la traza. La salida de 'mostrar' no
+// se escribe en la salida estándar: queda en la traza, en el paso en que se
+// produjo.
+func (r *Recorder) Run(program *ast.Program, table *symbol.Table, opts ...evaluator.Option) *Trace {
+	// Un bucle sin sentencias no llega a BeforeStatement, así que además se
+	// limitan los pasos del evaluador, que cuentan las sentencias y las
+	// vueltas de los bucles. Un programa cuya traza cabe en maxSteps no da
+	// más del doble de pasos (cada vuelta de un bucle con cuerpo ejecuta al
+	// menos una sentencia), así que este límite solo corta los bucles vacíos.
+	opts = append(opts, evaluator.WithHook(r), evaluator.WithOutput(&r.output), evaluator.WithMaxSteps(2*r.maxSteps))
+	eval := evaluator.New(table, opts...)
+	err := eval.Evaluate(program)
+	if runtimeErr, ok := err.(*evaluator.RuntimeError); ok && runtimeErr.Code == evaluator.ErrStepLimit {
+		r.trace.Truncated = true
+		err = ErrTooManySteps
+	}
+
+	end := r.step(EventEnd, r.line, "<programa>", 0)
+	end.Scopes = snapshot(table, "global")
+	switch e := err.(type) {
+	case nil, *evaluator.ReturnValue:
+	case *evaluator.RuntimeError:
+		r.trace.Error = e
+		end.Error = e.Message
+	default:
+		if err != ErrTooManySteps {
+			end.Error = err.Error()
+		}
+	}
+	r.trace.Steps = append(r.trace.Steps, *end)
+	return r.trace
+}
+
+// BeforeStatement implementa evaluator.Hook
+func (r *Recorder) BeforeStatement(e *evaluator.Evaluator, stmt ast.Statement) error {
+	if len(r.trace.Steps) >= r.maxSteps {
+		r.trace.Truncated = true
+		return ErrTooManySteps
+	}
+	r.line = stmt.Span().Start.Line
+	step := r.step(EventStatement, r.line, currentFunction(e), len(e.Stack()))
+	step.Node = reflect.TypeOf(stmt).Elem().Name()
+	step.Scopes = scopes(e)
+	r.trace.Steps = append(r.trace.Steps, *step)
+	return nil
+}
+
+// EnterFunction implementa evaluator.Hook
+func (r *Recorder) EnterFunction(e *evaluator.Evaluator, fn *evaluator.Function, args []interface{}) {
+	stack := e.Stack()
+	step := r.step(EventCall, stack[len(stack)-1].Line, currentFunction(e), len(stack))
+	step.Arguments = make([]Variable, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		step.Arguments[i] = Variable{Name: param.Value, Value: convert(args[i])}
+	}
+	step.Scopes = scopes(e)
+	r.trace.Steps = append(r.trace.Steps, *step)
+}
+
+// ExitFunction implementa evaluator.Hook
+func (r *Recorder) ExitFunction(e *evaluator.Evaluator, fn *evaluator.Function, result interface{}, err error) {
+	step := r.step(EventReturn, r.line, currentFunction(e), len(e.Stack()))
+	if err != nil {
+		step.Error = err.Error()
+		if runtimeErr, ok := err.(*evaluator.RuntimeError); ok {
+			step.Error = runtimeErr.Message
+		}
+	} else {
+		value := convert(result)
+		step.Return = &value
+	}
+	step.Scopes = scopes(e)
+	r.trace.Steps = append(r.trace.Steps, *step)
+}
+
+// step crea un paso con la salida producida desde el anterior
+func (r *Recorder) step(event string, line int, function string, depth int) *Step {
+	printed := r.output.String()[r.printed:]
+	r.printed = r.output.Len()
+	return &Step{
+		Step:     len(r.trace.Steps) + 1,
+		Event:    event,
+		Line:     line,
+		Function: function,
+		Depth:    depth,
+		Printed:  printed,
+	}
+}
+
+func currentFunction(e *evaluator.Evaluator) string {
+	if stack := e.Stack(); len(stack) > 0 {
+		return stack[len(stack)-1].Function
+	}
+	return "<programa>"
+}
+
+// scopes devuelve las variables visibles desde el scope que se ejecuta
+func scopes(e *evaluator.Evaluator) []Scope {
+	name := "global"
+	if len(e.Stack()) > 0 {
+		name = currentFunction(e)
+	}
+	return snapshot(e.Scope(), name)
+}
+
+// snapshot copia las variables de un scope y de todos sus padres. El
+// primero se llama name; los demás, "exterior" salvo el global.
+func snapshot(table *symbol.Table, name string) []Scope {
+	var result []Scope
+	for ; table != nil; table = table.Parent() {
+		if table.Parent() == nil {
+			name = "global"
+		}
+		scope := Scope{Name: name, Variables: []Variable{}}
+		for _, varName := range table.Names() {
+			value, _ := table.Get(varName)
+			scope.Variables = append(scope.Variables, Variable{
+				Name:  varName,
+				Const: table.IsConst(varName),
+				Value: convert(value),
+			})
+		}
+		result = append(result, scope)
+		name = "exterior"
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package trace
+
+import (
+	"flux/evaluator"
+	"math"
+	"strconv"
+)
+
+// Value es un valor de Flux con su tipo. Las listas contienen Values y los
+// diccionarios, pares clave-valor de Values, para que al leer la traza se
+// distinga 1 de "1" y 2 de 2.0 a cualquier profundidad.
+type Value struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// Pair es un par de un diccionario
+type Pair struct {
+	Key   Value `json:"key"`
+	Value Value `json:"value"`
+}
+
+// cycleMarker sustituye a una lista o diccionario que se contiene a sí mismo
+const cycleMarker = "<ciclo>"
+
+func convert(value interface{}) Value {
+	return convertValue(value, make(map[interface{}]bool))
+}
+
+// convertValue copia un valor. seen son las colecciones que se están
+// copiando, para no entrar en un ciclo infinito.
+func convertValue(value interface{}, seen map[interface{}]bool) Value {
+	result := Value{Type: evaluator.TypeName(value)}
+	switch v := value.(type) {
+	case nil, int64, string, bool:
+		result.Value = v
+	case float64:
+		// JSON no admite infinitos ni NaN
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			result.Value = strconv.FormatFloat(v, 'g', -1, 64)
+		} else {
+			result.Value = v
+		}
+	case *evaluator.List:
+		if seen[v] {
+			result.Value = cycleMarker
+			break
+		}
+		seen[v] = true
+		elements := make([]Value, len(v.Elements))
+		for i, el := range v.Elements {
+			elements[i] = convertValue(el, seen)
+		}
+		delete(seen, v)
+		result.Value = elements
+	case *evaluator.Dict:
+		if seen[v] {
+			result.Value = cycleMarker
+			break
+		}
+		seen[v] = true
+		keys, values := v.Keys(), v.Values()
+		pairs := make([]Pair, len(keys))
+		for i := range keys {
+			pairs[i] = Pair{Key: convertValue(keys[i], seen), Value: convertValue(values[i], seen)}
+		}
+		delete(seen, v)
+		result.Value = pairs
+	default:
+		// Funciones y cualquier otro valor se muestran como los muestra 'mostrar'
+		result.Value = evaluator.Inspect(v)
+	}
+	return result
+}
@@ -0,0 +1,336 @@
+package vet
+
+import (
+	"flux/ast"
+	"flux/diagnostic"
+	"strings"
+)
+
+type declKind int
+
+const (
+	declVariable  declKind = iota // definir
+	declConstant                  // constante
+	declAssigned                  // Nombre creado por una asignación
+	declFunction                  // función nombre(...)
+	declParameter                 // Parámetro de función
+	declLoop                      // Variable de repetir
+	declCatch                     // Nombre del error en capturar
+)
+
+// decl es un nombre declarado en un scope
+type decl struct {
+	kind  declKind
+	ident *ast.Identifier
+	used  bool
+}
+
+// scope sigue las reglas del evaluador: solo las funciones crean uno nuevo
+type scope struct {
+	names  map[string]*decl
+	parent *scope
+}
+
+func (s *scope) lookup(name string) *decl {
+	for sc := s; sc != nil; sc = sc.parent {
+		if d, ok := sc.names[name]; ok {
+			return d
+		}
+	}
+	return nil
+}
+
+// pendingBody es el cuerpo de una función, que se recorre al terminar el
+// scope que la contiene (como en el análisis semántico) para que pueda usar
+// nombres declarados después de ella
+type pendingBody struct {
+	self   *decl // Declaración de la función, o nil si es anónima
+	params []*ast.Identifier
+	body   *ast.BlockStatement
+	parent *scope
+}
+
+type finding struct {
+	rule string
+	diag *diagnostic.Diagnostic
+}
+
+type checker struct {
+	enabled  map[string]bool
+	findings []finding
+	decls    []*decl // Todas las declaraciones, en orden, para buscar las no usadas
+	pending  []pendingBody
+	current  []*decl // Funciones cuyo cuerpo se está recorriendo
+}
+
+func newChecker(enabled map[string]bool) *checker {
+	return &checker{enabled: enabled}
+}
+
+// report registra un aviso de la regla si está activa. Devuelve el
+// diagnóstico en cualquier caso para poder añadirle una sugerencia.
+func (c *checker) report(rule string, span ast.Span, format string, args ...interface{}) *diagnostic.Diagnostic {
+	r, _ := LookupRule(rule)
+	d := diagnostic.Warningf(r.Code, span, format, args...)
+	if c.enabled[rule] {
+		c.findings = append(c.findings, finding{rule: rule, diag: d})
+	}
+	return d
+}
+
+func (c *checker) checkProgram(program *ast.Program) {
+	c.walkBody(program.Statements, &scope{names: make(map[string]*decl)})
+
+	for _, d := range c.decls {
+		if d.used || strings.HasPrefix(d.ident.Value, "_") {
+			continue
+		}
+		switch d.kind {
+		case declVariable:
+			c.report("variable-sin-usar", d.ident.Loc, "la variable '%s' se declara pero nunca se usa", d.ident.Value).
+				WithHint("si es intencionado, empieza su nombre por '_'")
+		case declFunction:
+			c.report("funcion-sin-usar", d.ident.Loc, "la función '%s' nunca se llama", d.ident.Value)
+		}
+	}
+}
+
+func (c *checker) declare(sc *scope, ident *ast.Identifier, kind declKind) *decl {
+	d := &decl{kind: kind, ident: ident}
+	sc.names[ident.Value] = d
+	c.decls = append(c.decls, d)
+	return d
+}
+
+// walkBody recorre las sentencias de un scope y después los cuerpos de las
+// funciones declaradas en él
+func (c *checker) walkBody(statements []ast.Statement, sc *scope) {
+	outerPending := c.pending
+	c.pending = nil
+
+	c.walkStatements(statements, sc)
+
+	pending := c.pending
+	c.pending = outerPending
+	for _, fn := range pending {
+		fnScope := &scope{names: make(map[string]*decl), parent: fn.parent}
+		for _, param := range fn.params {
+			c.declare(fnScope, param, declParameter)
+		}
+		c.current = append(c.current, fn.self)
+		c.walkBody(fn.body.Statements, fnScope)
+		c.current = c.current[:len(c.current)-1]
+	}
+}
+
+func (c *checker) walkBlock(block *ast.BlockStatement, sc *scope) {
+	if block != nil {
+		c.walkStatements(block.Statements, sc)
+	}
+}
+
+// walkStatements recorre una lista de sentencias y avisa de las que quedan
+// detrás de una que siempre sale del bloque
+func (c *checker) walkStatements(statements []ast.Statement, sc *scope) {
+	for i, stmt := range statements {
+		c.walkStatement(stmt, sc)
+		if keyword, ok := terminator(stmt); ok && i+1 < len(statements) {
+			rest := ast.Span{Start: statements[i+1].Span().Start, End: statements[len(statements)-1].Span().End}
+			c.report("codigo-inalcanzable", rest, "este código nunca se ejecuta porque está después de '%s'", keyword)
+			for _, unreachable := range statements[i+1:] {
+				c.walkStatement(unreachable, sc)
+			}
+			return
+		}
+	}
+}
+
+// terminator indica si la sentencia siempre sale del bloque en que está y
+// con qué palabra lo hace
+func terminator(stmt ast.Statement) (string, bool) {
+	switch s := stmt.(type) {
+	case *ast.ReturnStatement:
+		return "retornar", true
+	case *ast.ThrowStatement:
+		return "lanzar", true
+	case *ast.BreakStatement:
+		return "salir", true
+	case *ast.ContinueStatement:
+		return "continuar", true
+	case *ast.IfStatement:
+		// Un si cuyas dos ramas terminan también termina
+		if s.Else == nil {
+			return "", false
+		}
+		thenKeyword, thenOk := blockTerminator(s.Then)
+		elseKeyword, elseOk := blockTerminator(s.Else)
+		if !thenOk || !elseOk {
+			return "", false
+		}
+		if thenKeyword == elseKeyword {
+			return thenKeyword, true
+		}
+		return "si", true
+	}
+	return "", false
+}
+
+func blockTerminator(block *ast.BlockStatement) (string, bool) {
+	if block == nil || len(block.Statements) == 0 {
+		return "", false
+	}
+	return terminator(block.Statements[len(block.Statements)-1])
+}
+
+func (c *checker) walkStatement(stmt ast.Statement, sc *scope) {
+	switch s := stmt.(type) {
+	case *ast.DeclareStatement:
+		c.walkExpression(s.Value, sc)
+		if s.IsConst {
+			c.declare(sc, s.Name, declConstant)
+		} else {
+			c.declare(sc, s.Name, declVariable)
+		}
+	case *ast.AssignStatement:
+		c.walkExpression(s.Value, sc)
+		// Asignar no es usar, pero asignar a un nombre nuevo lo declara
+		if sc.lookup(s.Name.Value) == nil {
+			c.declare(sc, s.Name, declAssigned)
+		}
+	case *ast.IndexAssignStatement:
+		c.walkExpression(s.Target, sc)
+		c.walkExpression(s.Value, sc)
+	case *ast.IfStatement:
+		c.walkExpression(s.Condition, sc)
+		if isConstant(s.Condition) {
+			c.report("condicion-constante", s.Condition.Span(), "la condición de 'si' es constante: siempre se ejecuta la misma rama")
+		}
+		if s.Then == nil || len(s.Then.Statements) == 0 {
+			c.report("si-vacio", ast.Span{Start: s.Loc.Start, End: s.Condition.Span().End}, "el bloque 'si' está vacío")
+		}
+		c.walkBlock(s.Then, sc)
+		c.walkBlock(s.Else, sc)
+	case *ast.WhileStatement:
+		c.walkExpression(s.Condition, sc)
+		// 'mientras verdadero' es la forma habitual de un bucle que termina con 'salir'
+		if b, ok := s.Condition.(*ast.BooleanLiteral); !(ok && b.Value) && isConstant(s.Condition) {
+			c.report("condicion-constante", s.Condition.Span(), "la condición de 'mientras' es constante")
+		}
+		c.walkBlock(s.Body, sc)
+	case *ast.RepeatStatement:
+		c.walkExpression(s.From, sc)
+		c.walkExpression(s.To, sc)
+		if existing := sc.lookup(s.Variable.Value); existing != nil && existing.kind != declLoop {
+			c.report("repetir-sobrescribe", s.Variable.Loc, "la variable de 'repetir' '%s' sobrescribe %s '%s' de la línea %d",
+				s.Variable.Value, describeKind(existing.kind), s.Variable.Value, existing.ident.Loc.Start.Line)
+		} else {
+			c.declare(sc, s.Variable, declLoop)
+		}
+		c.walkBlock(s.Body, sc)
+	case *ast.FunctionStatement:
+		self := c.declare(sc, s.Name, declFunction)
+		c.pending = append(c.pending, pendingBody{self: self, params: s.Parameters, body: s.Body, parent: sc})
+	case *ast.TryStatement:
+		c.walkBlock(s.Body, sc)
+		if s.CatchName != nil {
+			c.declare(sc, s.CatchName, declCatch)
+		}
+		c.walkBlock(s.Catch, sc)
+		c.walkBlock(s.Finally, sc)
+	case *ast.ThrowStatement:
+		c.walkExpression(s.Value, sc)
+	case *ast.ShowStatement:
+		c.walkExpression(s.Value, sc)
+	case *ast.ReturnStatement:
+		c.walkExpression(s.Value, sc)
+	case *ast.ExpressionStatement:
+		c.walkExpression(s.Expression, sc)
+	case *ast.BlockStatement:
+		c.walkBlock(s, sc)
+	}
+}
+
+func describeKind(kind declKind) string {
+	switch kind {
+	case declConstant:
+		return "la constante"
+	case declFunction:
+		return "la función"
+	case declParameter:
+		return "el parámetro"
+	default:
+		return "la variable"
+	}
+}
+
+func (c *checker) walkExpression(expr ast.Expression, sc *scope) {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		c.use(e.Value, sc)
+	case *ast.InfixExpression:
+		c.walkExpression(e.Left, sc)
+		c.walkExpression(e.Right, sc)
+	case *ast.PrefixExpression:
+		c.walkExpression(e.Right, sc)
+	case *ast.ListLiteral:
+		for _, el := range e.Elements {
+			c.walkExpression(el, sc)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range e.Parts {
+			c.walkExpression(part, sc)
+		}
+	case *ast.DictLiteral:
+		for _, pair := range e.Pairs {
+			c.walkExpression(pair.Key, sc)
+			c.walkExpression(pair.Value, sc)
+		}
+	case *ast.IndexExpression:
+		c.walkExpression(e.Left, sc)
+		c.walkExpression(e.Index, sc)
+	case *ast.CallExpression:
+		c.walkExpression(e.Function, sc)
+		for _, arg := range e.Arguments {
+			c.walkExpression(arg, sc)
+		}
+	case *ast.FunctionLiteral:
+		c.pending = append(c.pending, pendingBody{params: e.Parameters, body: e.Body, parent: sc})
+	}
+}
+
+// use marca un nombre como usado. Las llamadas de una función a sí misma no
+// cuentan: una función que solo se llama a sí misma sigue sin usarse.
+func (c *checker) use(name string, sc *scope) {
+	d := sc.lookup(name)
+	if d == nil {
+		return
+	}
+	for _, fn := range c.current {
+		if fn == d {
+			return
+		}
+	}
+	d.used = true
+}
+
+// isConstant indica si la expresión solo contiene literales, de modo que su
+// valor es siempre el mismo
+func isConstant(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.BooleanLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return isConstant(e.Right)
+	case *ast.InterpolatedString:
+		for _, part := range e.Parts {
+			if !isConstant(part) {
+				return false
+			}
+		}
+		return true
+	case *ast.InfixExpression:
+		return isConstant(e.Left) && isConstant(e.Right)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,110 @@
+// Package vet busca en programas de Flux construcciones que son válidas pero
+// probablemente son errores: código que nunca se ejecuta, variables y
+// funciones sin usar, condiciones constantes... Cada comprobación es una
+// regla que se puede desactivar, y una línea se puede excluir con un
+// comentario:
+//
+//	definir temporal = 0 // flux:ignorar variable-sin-usar
+package vet
+
+import (
+	"flux/ast"
+	"flux/diagnostic"
+	"flux/lexer"
+	"strings"
+)
+
+// Rule es una comprobación del linter
+type Rule struct {
+	Name        string // Nombre con el que se activa, desactiva o ignora
+	Code        string
+	Description string
+}
+
+// Rules son todas las reglas, en el orden en que se documentan
+var Rules = []Rule{
+	{"codigo-inalcanzable", diagnostic.CodeUnreachable, "sentencias después de retornar, lanzar, salir o continuar"},
+	{"variable-sin-usar", diagnostic.CodeUnusedVariable, "variables declaradas con 'definir' que nunca se leen"},
+	{"funcion-sin-usar", diagnostic.CodeUnusedFunction, "funciones que nunca se llaman"},
+	{"condicion-constante", diagnostic.CodeConstantCondition, "condiciones de 'si' y 'mientras' que siempre valen lo mismo"},
+	{"repetir-sobrescribe", diagnostic.CodeLoopShadow, "variables de 'repetir' que sobrescriben un nombre ya definido"},
+	{"si-vacio", diagnostic.CodeEmptyIf, "bloques 'si' sin sentencias"},
+}
+
+// LookupRule busca una regla por su nombre
+func LookupRule(name string) (Rule, bool) {
+	for _, rule := range Rules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// ignoreDirective es la marca que excluye una línea de una o varias reglas
+const ignoreDirective = "flux:ignorar"
+
+// Check aplica al programa las reglas indicadas por nombre, o todas si rules
+// está vacía. source y comments son los del archivo analizado y se usan para
+// las marcas 'flux:ignorar'. Un comentario con la marca al final de una
+// línea afecta a esa línea; uno en una línea propia, a la siguiente. Sin
+// nombres de reglas, la marca las ignora todas.
+func Check(program *ast.Program, source string, comments []lexer.Comment, rules []string) diagnostic.List {
+	enabled := make(map[string]bool)
+	for _, rule := range Rules {
+		enabled[rule.Name] = len(rules) == 0
+	}
+	for _, name := range rules {
+		enabled[name] = true
+	}
+
+	c := newChecker(enabled)
+	c.checkProgram(program)
+	ignored := ignoredLines(source, comments)
+
+	var result diagnostic.List
+	for _, f := range c.findings {
+		if rules, ok := ignored[f.diag.Span.Start.Line]; ok && (rules[""] || rules[f.rule]) {
+			continue
+		}
+		result = append(result, f.diag)
+	}
+	result.Sort()
+	return result
+}
+
+// ignoredLines devuelve, para cada línea afectada por una marca
+// 'flux:ignorar', las reglas que ignora ("" significa todas)
+func ignoredLines(source string, comments []lexer.Comment) map[int]map[string]bool {
+	ignored := make(map[int]map[string]bool)
+	for _, c := range comments {
+		text := strings.TrimPrefix(c.Text, "//")
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		text = strings.TrimSpace(text)
+		if !strings.HasPrefix(text, ignoreDirective) {
+			continue
+		}
+
+		line := c.Line
+		lineStart := strings.LastIndexByte(source[:c.Offset], '\n') + 1
+		if strings.TrimSpace(source[lineStart:c.Offset]) == "" {
+			line = c.EndLine + 1
+		}
+
+		rules := ignored[line]
+		if rules == nil {
+			rules = make(map[string]bool)
+			ignored[line] = rules
+		}
+		names := strings.FieldsFunc(text[len(ignoreDirective):], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(names) == 0 {
+			rules[""] = true
+		}
+		for _, name := range names {
+			rules[name] = true
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,132 @@
+package vm
+
+import (
+	"flux/ast"
+	"flux/compiler"
+	"flux/evaluator"
+	"fmt"
+	"sort"
+)
+
+// Closure es una función de Flux compilada junto con el scope donde se
+// creó, en el que se resuelven sus variables libres
+type Closure struct {
+	Fn  *compiler.Function
+	env *env
+}
+
+func (c *Closure) String() string {
+	return fmt.Sprintf("<función %s>", c.displayName())
+}
+
+// TypeName implementa evaluator.TypedValue
+func (c *Closure) TypeName() string {
+	return "función"
+}
+
+func (c *Closure) displayName() string {
+	if c.Fn.Name == "" {
+		return "anónima"
+	}
+	return c.Fn.Name
+}
+
+// env es el scope de una llamada: una casilla por cada nombre que la
+// función puede definir. Una casilla sin valor (nil) es un nombre que aún no
+// se ha definido; los nulos de Flux solo llegan a las variables como
+// parámetros, que siempre cuentan como definidos.
+type env struct {
+	slots  []interface{}
+	consts []bool // nil hasta que se define la primera constante
+	fn     *compiler.Function
+	parent *env
+}
+
+func newEnv(fn *compiler.Function, parent *env) *env {
+	return &env{slots: make([]interface{}, len(fn.Slots)), fn: fn, parent: parent}
+}
+
+// up devuelve el scope que está depth niveles por encima
+func (e *env) up(depth int) *env {
+	for ; depth > 0; depth-- {
+		e = e.parent
+	}
+	return e
+}
+
+func (e *env) isConst(slot int) bool {
+	return e.consts != nil && e.consts[slot]
+}
+
+// set define una variable; como en symbol.Table, una constante no cambia
+func (e *env) set(slot int, value interface{}) {
+	if !e.isConst(slot) {
+		e.slots[slot] = value
+	}
+}
+
+func (e *env) setConst(slot int, value interface{}) {
+	if e.consts == nil {
+		e.consts = make([]bool, len(e.slots))
+	}
+	e.slots[slot] = value
+	e.consts[slot] = true
+}
+
+// visibleNames devuelve los nombres definidos en este scope y en los
+// exteriores, ordenados, como symbol.Table.VisibleNames
+func (e *env) visibleNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for scope := e; scope != nil; scope = scope.parent {
+		for i, name := range scope.fn.Slots {
+			if name == "" || seen[name] {
+				continue
+			}
+			if scope.slots[i] != nil || i < scope.fn.Parameters {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Errores
+
+// newError crea un error de ejecución en la posición del nodo con la pila
+// de llamadas actual
+func (vm *VM) newError(code evaluator.ErrorCode, node ast.Node, format string, args ...interface{}) *evaluator.RuntimeError {
+	span := node.Span()
+	return &evaluator.RuntimeError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+		Line:    span.Start.Line,
+		Column:  span.Start.Column,
+		Span:    span,
+		Stack:   vm.stackTrace(),
+	}
+}
+
+// locate completa un error que aún no tiene posición, como los de las
+// funciones predefinidas
+func (vm *VM) locate(err error, node ast.Node) *evaluator.RuntimeError {
+	r, ok := err.(*evaluator.RuntimeError)
+	if !ok {
+		return vm.newError(evaluator.ErrInvalidArgument, node, "%s", err.Error())
+	}
+	if r.Line == 0 {
+		r.Span = node.Span()
+		r.Line = r.Span.Start.Line
+		r.Column = r.Span.Start.Column
+		r.Stack = vm.stackTrace()
+	}
+	return r
+}
+
+func (vm *VM) stackTrace() []evaluator.Frame {
+	stack := make([]evaluator.Frame, len(vm.calls))
+	copy(stack, vm.calls)
+	return stack
+}
@@ -0,0 +1,621 @@
+// Package vm ejecuta los programas compilados por flux/compiler en una
+// máquina de pila. Usa los mismos valores, operaciones y errores que el
+// evaluador, así que un programa produce la misma salida con los dos
+// motores; solo cambia la velocidad.
+package vm
+
+import (
+	"context"
+	"flux/ast"
+	"flux/compiler"
+	"flux/diagnostic"
+	"flux/evaluator"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Option configura una VM al crearla
+type Option func(*VM)
+
+// WithOutput hace que 'mostrar' escriba en w en lugar de en la salida estándar
+func WithOutput(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.out = w
+	}
+}
+
+// WithInput hace que 'leer' y las demás funciones de entrada lean de r en
+// lugar de la entrada estándar
+func WithInput(r io.Reader) Option {
+	return func(vm *VM) {
+		vm.in = r
+	}
+}
+
+// WithSeed fija la semilla de 'aleatorio', como evaluator.WithSeed
+func WithSeed(seed int64) Option {
+	return func(vm *VM) {
+		vm.seed = &seed
+	}
+}
+
+// WithContext interrumpe la ejecución cuando el contexto se cancela o vence
+// su plazo, como evaluator.WithContext. Se comprueba en cada vuelta de un
+// bucle y en cada llamada.
+func WithContext(ctx context.Context) Option {
+	return func(vm *VM) {
+		vm.ctx = ctx
+		vm.done = ctx.Done()
+	}
+}
+
+// WithMaxDepth cambia la profundidad máxima de llamadas, como
+// evaluator.WithMaxDepth (por defecto evaluator.DefaultMaxDepth)
+func WithMaxDepth(n int) Option {
+	return func(vm *VM) {
+		if n <= 0 {
+			n = evaluator.DefaultMaxDepth
+		}
+		vm.maxDepth = n
+	}
+}
+
+// VM ejecuta un programa compilado
+type VM struct {
+	program  *compiler.Program
+	out      io.Writer
+	in       io.Reader
+	seed     *int64
+	runtime  *evaluator.Runtime // Estado que usan las funciones predefinidas
+	ctx      context.Context
+	done     <-chan struct{} // nil si la ejecución no se puede cancelar
+	maxDepth int
+	stack    []interface{}     // Pila de operandos de todas las llamadas
+	frames   []frame           // Llamadas en curso; la primera es el programa principal
+	calls    []evaluator.Frame // Las mismas llamadas como las ve el usuario, para los errores
+}
+
+// frame es una llamada en curso
+type frame struct {
+	fn   *compiler.Function
+	env  *env
+	ip   int // Siguiente instrucción
+	base int // Inicio de los operandos de la llamada en la pila
+}
+
+func New(program *compiler.Program, opts ...Option) *VM {
+	vm := &VM{program: program, out: os.Stdout, in: os.Stdin, maxDepth: evaluator.DefaultMaxDepth}
+	for _, opt := range opts {
+		opt(vm)
+	}
+	vm.runtime = evaluator.NewRuntime(vm.in, vm.out, vm.seed)
+	return vm
+}
+
+// Run ejecuta el programa. Devuelve un *evaluator.RuntimeError si la
+// ejecución falla.
+func (vm *VM) Run() error {
+	main := vm.program.Main
+	vm.stack = vm.stack[:0]
+	vm.calls = vm.calls[:0]
+	vm.frames = append(vm.frames[:0], frame{fn: main, env: newEnv(main, nil)})
+	if err := vm.run(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (vm *VM) push(value interface{}) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() interface{} {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+// run es el bucle principal: lee y ejecuta instrucciones hasta que el
+// programa principal termina o un error no se captura
+func (vm *VM) run() *evaluator.RuntimeError {
+	f := &vm.frames[len(vm.frames)-1]
+	for {
+		code := f.fn.Code
+		ip := f.ip
+		op := compiler.Opcode(code[ip])
+		f.ip = ip + op.Width()
+
+		var err *evaluator.RuntimeError
+		switch op {
+		case compiler.OpConstant:
+			vm.push(vm.program.Constants[compiler.ReadOperand(code, ip+1)])
+		case compiler.OpNull:
+			vm.push(nil)
+		case compiler.OpTrue:
+			vm.push(true)
+		case compiler.OpFalse:
+			vm.push(false)
+		case compiler.OpPop:
+			vm.pop()
+
+		case compiler.OpGetVar:
+			ref := &f.fn.References[compiler.ReadOperand(code, ip+1)]
+			if value, ok := lookup(f.env, ref); ok {
+				vm.push(value)
+			} else if value, ok := evaluator.Predefined(ref.Name); ok {
+				vm.push(value)
+			} else {
+				err = vm.undefinedError(f, ip, ref)
+			}
+		case compiler.OpAssign:
+			err = vm.assign(f, ip, &f.fn.References[compiler.ReadOperand(code, ip+1)])
+		case compiler.OpDefine, compiler.OpDefineConst:
+			slot := compiler.ReadOperand(code, ip+1)
+			value := vm.pop()
+			if value == nil {
+				err = vm.newError(evaluator.ErrNullValue, f.fn.Nodes[ip],
+					"la expresión asignada a '%s' no produjo ningún valor", f.fn.Slots[slot])
+				break
+			}
+			if op == compiler.OpDefineConst {
+				f.env.setConst(slot, value)
+			} else {
+				f.env.set(slot, value)
+			}
+		case compiler.OpGetTemp:
+			vm.push(f.env.slots[compiler.ReadOperand(code, ip+1)])
+		case compiler.OpSetTemp:
+			f.env.slots[compiler.ReadOperand(code, ip+1)] = vm.pop()
+
+		case compiler.OpAdd, compiler.OpSub, compiler.OpMul, compiler.OpDiv, compiler.OpMod:
+			err = vm.arithmetic(f, ip, op)
+		case compiler.OpEqual, compiler.OpNotEqual:
+			right, left := vm.pop(), vm.pop()
+			vm.push(evaluator.Equal(left, right) == (op == compiler.OpEqual))
+		case compiler.OpLess, compiler.OpGreater, compiler.OpLessEqual, compiler.OpGreaterEqual:
+			err = vm.comparison(f, ip, op)
+		case compiler.OpAnd:
+			right, left := vm.pop(), vm.pop()
+			vm.push(evaluator.Truthy(left) && evaluator.Truthy(right))
+		case compiler.OpOr:
+			right, left := vm.pop(), vm.pop()
+			vm.push(evaluator.Truthy(left) || evaluator.Truthy(right))
+		case compiler.OpNot:
+			vm.push(!evaluator.Truthy(vm.pop()))
+		case compiler.OpNeg:
+			switch value := vm.pop().(type) {
+			case int64:
+				vm.push(-value)
+			case float64:
+				vm.push(-value)
+			default:
+				node := f.fn.Nodes[ip].(*ast.PrefixExpression)
+				err = vm.newError(evaluator.ErrTypeMismatch, node,
+					"no se puede aplicar '%s' a un valor de tipo %s", node.Operator, evaluator.TypeName(value))
+			}
+
+		case compiler.OpList:
+			n := compiler.ReadOperand(code, ip+1)
+			elements := make([]interface{}, n)
+			copy(elements, vm.stack[len(vm.stack)-n:])
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(&evaluator.List{Elements: elements})
+		case compiler.OpConcat:
+			n := compiler.ReadOperand(code, ip+1)
+			var text strings.Builder
+			for _, value := range vm.stack[len(vm.stack)-n:] {
+				text.WriteString(evaluator.Inspect(value))
+			}
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(text.String())
+		case compiler.OpCheckKey:
+			if keyErr := evaluator.CheckDictKey(vm.stack[len(vm.stack)-1]); keyErr != nil {
+				err = vm.locate(keyErr, f.fn.Nodes[ip])
+			}
+		case compiler.OpDict:
+			n := compiler.ReadOperand(code, ip+1)
+			pairs := vm.stack[len(vm.stack)-2*n:]
+			dict := evaluator.NewDict()
+			for i := 0; i < len(pairs); i += 2 {
+				dict.Set(pairs[i], pairs[i+1])
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2*n]
+			vm.push(dict)
+		case compiler.OpIndex:
+			err = vm.index(f, ip)
+		case compiler.OpSetIndex:
+			err = vm.setIndex(f, ip)
+
+		case compiler.OpJump:
+			f.ip = compiler.ReadOperand(code, ip+1)
+			if f.ip < ip && vm.done != nil {
+				err = vm.checkCancelled(f.fn.Nodes[ip])
+			}
+		case compiler.OpJumpIfFalse:
+			if !evaluator.Truthy(vm.pop()) {
+				f.ip = compiler.ReadOperand(code, ip+1)
+			}
+		case compiler.OpRepeatInit:
+			slot := compiler.ReadOperand(code, ip+1)
+			to, from := vm.pop(), vm.pop()
+			fromVal, fromOk := from.(int64)
+			toVal, toOk := to.(int64)
+			if !fromOk || !toOk {
+				err = vm.newError(evaluator.ErrTypeMismatch, f.fn.Nodes[ip],
+					"los valores de 'desde' y 'hasta' deben ser enteros, pero son %s y %s", evaluator.TypeName(from), evaluator.TypeName(to))
+				break
+			}
+			f.env.slots[slot], f.env.slots[slot+1] = fromVal, toVal
+		case compiler.OpRepeatNext:
+			slot := compiler.ReadOperand(code, ip+1)
+			counter := f.env.slots[slot].(int64)
+			if counter > f.env.slots[slot+1].(int64) {
+				f.ip = compiler.ReadOperand(code, ip+3)
+			} else {
+				vm.push(counter)
+			}
+		case compiler.OpRepeatStep:
+			slot := compiler.ReadOperand(code, ip+1)
+			f.env.slots[slot] = f.env.slots[slot].(int64) + 1
+
+		case compiler.OpClosure:
+			vm.push(&Closure{Fn: vm.program.Functions[compiler.ReadOperand(code, ip+1)], env: f.env})
+		case compiler.OpCall:
+			err = vm.call(f, ip, compiler.ReadOperand(code, ip+1))
+			f = &vm.frames[len(vm.frames)-1]
+		case compiler.OpReturn, compiler.OpReturnNull:
+			var result interface{}
+			if op == compiler.OpReturn {
+				result = vm.pop()
+			}
+			if len(vm.frames) == 1 {
+				return nil
+			}
+			vm.stack = append(vm.stack[:f.base], result)
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.calls = vm.calls[:len(vm.calls)-1]
+			f = &vm.frames[len(vm.frames)-1]
+
+		case compiler.OpShow:
+			fmt.Fprintln(vm.out, evaluator.Inspect(vm.pop()))
+		case compiler.OpThrow:
+			err = vm.throw(f, ip)
+		case compiler.OpCatch:
+			vm.push(evaluator.ErrorValue(vm.pop().(*evaluator.RuntimeError)))
+		case compiler.OpRaise:
+			err = vm.pop().(*evaluator.RuntimeError)
+
+		default:
+			err = vm.newError(evaluator.ErrInternal, f.fn.Nodes[ip], "instrucción desconocida %s", op)
+		}
+
+		if err != nil {
+			if !vm.unwind(err) {
+				return err
+			}
+			f = &vm.frames[len(vm.frames)-1]
+		}
+	}
+}
+
+// checkCancelled devuelve un error si se canceló el contexto
+func (vm *VM) checkCancelled(node ast.Node) *evaluator.RuntimeError {
+	select {
+	case <-vm.done:
+		err := vm.newError(evaluator.ErrCancelled, node, "la ejecución se interrumpió: %v", vm.ctx.Err())
+		if vm.ctx.Err() == context.DeadlineExceeded {
+			err.Message = "la ejecución superó el tiempo máximo"
+		}
+		return err
+	default:
+		return nil
+	}
+}
+
+// unwind busca el manejador del error en la llamada actual y, si no lo
+// hay, en las que la llamaron. Devuelve false si nadie lo captura.
+func (vm *VM) unwind(err *evaluator.RuntimeError) bool {
+	// La cancelación no se captura ni ejecuta 'finalmente'
+	if evaluator.IsFatal(err) {
+		return false
+	}
+	for {
+		f := &vm.frames[len(vm.frames)-1]
+		// ip ya pasó la instrucción que falló; ip-1 sigue dentro de ella
+		pc := f.ip - 1
+		for _, h := range f.fn.Handlers {
+			if pc >= h.Start && pc < h.End {
+				vm.stack = append(vm.stack[:f.base], err)
+				f.ip = h.Target
+				return true
+			}
+		}
+		if len(vm.frames) == 1 {
+			return false
+		}
+		vm.frames = vm.frames[:len(vm.frames)-1]
+		vm.calls = vm.calls[:len(vm.calls)-1]
+	}
+}
+
+// checkDepth comprueba que se pueda hacer una llamada más
+func (vm *VM) checkDepth(node ast.Node) *evaluator.RuntimeError {
+	if len(vm.calls) < vm.maxDepth {
+		return nil
+	}
+	err := vm.newError(evaluator.ErrDepthLimit, node, "se superó la profundidad máxima de %d llamadas", vm.maxDepth)
+	err.Hint = "comprueba que las llamadas recursivas lleguen a un caso base"
+	return err
+}
+
+// call llama a la función que está bajo los argc argumentos de la cima
+func (vm *VM) call(f *frame, ip, argc int) *evaluator.RuntimeError {
+	calleePos := len(vm.stack) - 1 - argc
+	node := f.fn.Nodes[ip]
+	span := node.Span()
+
+	switch fn := vm.stack[calleePos].(type) {
+	case *Closure:
+		if argc != fn.Fn.Parameters {
+			return vm.newError(evaluator.ErrArgumentCount, node,
+				"la función '%s' espera %d argumentos, pero recibió %d", fn.displayName(), fn.Fn.Parameters, argc)
+		}
+		if err := vm.checkDepth(node); err != nil {
+			return err
+		}
+		if vm.done != nil {
+			if err := vm.checkCancelled(node); err != nil {
+				return err
+			}
+		}
+		env := newEnv(fn.Fn, fn.env)
+		copy(env.slots, vm.stack[calleePos+1:])
+		vm.stack = vm.stack[:calleePos]
+		vm.calls = append(vm.calls, evaluator.Frame{Function: fn.displayName(), Line: span.Start.Line, Column: span.Start.Column})
+		vm.frames = append(vm.frames, frame{fn: fn.Fn, env: env, base: calleePos})
+		return nil
+	case *evaluator.Builtin:
+		// Como en el evaluador, las funciones predefinidas también cuentan
+		if err := vm.checkDepth(node); err != nil {
+			return err
+		}
+		args := make([]interface{}, argc)
+		copy(args, vm.stack[calleePos+1:])
+		vm.stack = vm.stack[:calleePos]
+		// La función predefinida aparece en la pila del error, como en el evaluador
+		vm.calls = append(vm.calls, evaluator.Frame{Function: fn.Name, Line: span.Start.Line, Column: span.Start.Column})
+		result, callErr := fn.Invoke(vm.runtime, args)
+		var err *evaluator.RuntimeError
+		if callErr != nil {
+			err = vm.locate(callErr, node)
+		}
+		vm.calls = vm.calls[:len(vm.calls)-1]
+		if err != nil {
+			return err
+		}
+		vm.push(result)
+		return nil
+	default:
+		return vm.newError(evaluator.ErrNotCallable, node,
+			"un valor de tipo %s no se puede llamar como función", evaluator.TypeName(fn))
+	}
+}
+
+func (vm *VM) throw(f *frame, ip int) *evaluator.RuntimeError {
+	value := vm.pop()
+	// Volver a lanzar un error capturado conserva su código y su posición
+	if rethrown := evaluator.ErrorFromValue(value); rethrown != nil {
+		rethrown.Stack = vm.stackTrace()
+		return rethrown
+	}
+	message, ok := value.(string)
+	if !ok {
+		message = evaluator.Inspect(value)
+	}
+	return vm.newError(evaluator.ErrThrown, f.fn.Nodes[ip], "%s", message)
+}
+
+// Variables
+
+// lookup busca el valor de un nombre en las casillas que pueden contenerlo
+func lookup(e *env, ref *compiler.Reference) (interface{}, bool) {
+	for i := range ref.Slots {
+		slot := &ref.Slots[i]
+		scope := e.up(slot.Depth)
+		if value := scope.slots[slot.Index]; value != nil || slot.Param {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// assign actualiza la variable donde fue declarada o, si no existe en
+// ningún scope, la crea en el actual
+func (vm *VM) assign(f *frame, ip int, ref *compiler.Reference) *evaluator.RuntimeError {
+	value := vm.pop()
+	node := f.fn.Nodes[ip]
+	if value == nil {
+		return vm.newError(evaluator.ErrNullValue, node,
+			"la expresión asignada a '%s' no produjo ningún valor", ref.Name)
+	}
+	for i := range ref.Slots {
+		slot := &ref.Slots[i]
+		scope := f.env.up(slot.Depth)
+		if scope.slots[slot.Index] == nil && !slot.Param {
+			continue
+		}
+		if scope.isConst(slot.Index) {
+			return vm.newError(evaluator.ErrConstant, node, "no se puede reasignar la constante '%s'", ref.Name)
+		}
+		scope.slots[slot.Index] = value
+		return nil
+	}
+	f.env.set(ref.Local, value)
+	return nil
+}
+
+func (vm *VM) undefinedError(f *frame, ip int, ref *compiler.Reference) *evaluator.RuntimeError {
+	err := vm.newError(evaluator.ErrUndefinedName, f.fn.Nodes[ip], "el nombre '%s' no está definido", ref.Name)
+	candidates := append(f.env.visibleNames(), evaluator.BuiltinNames()...)
+	candidates = append(candidates, evaluator.ConstantNames()...)
+	if suggestion, ok := diagnostic.Closest(ref.Name, candidates, diagnostic.MaxDistance(ref.Name)); ok {
+		err.Hint = fmt.Sprintf("¿quisiste decir '%s'?", suggestion)
+	}
+	if ref.Called {
+		err.Message = fmt.Sprintf("la función '%s' no está definida", ref.Name)
+	}
+	return err
+}
+
+// Operadores
+
+func (vm *VM) arithmetic(f *frame, ip int, op compiler.Opcode) *evaluator.RuntimeError {
+	right, left := vm.pop(), vm.pop()
+
+	// Camino rápido para los enteros, el caso más común
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			switch op {
+			case compiler.OpAdd:
+				vm.push(l + r)
+				return nil
+			case compiler.OpSub:
+				vm.push(l - r)
+				return nil
+			case compiler.OpMul:
+				vm.push(l * r)
+				return nil
+			case compiler.OpMod:
+				if r != 0 {
+					vm.push(l % r)
+					return nil
+				}
+			}
+		}
+	}
+
+	var result interface{}
+	switch op {
+	case compiler.OpAdd:
+		result = evaluator.Add(left, right)
+	case compiler.OpSub:
+		result = evaluator.Subtract(left, right)
+	case compiler.OpMul:
+		result = evaluator.Multiply(left, right)
+	default:
+		if evaluator.IsZero(right) {
+			return vm.newError(evaluator.ErrDivisionByZero, f.fn.Nodes[ip], "división por cero")
+		}
+		if op == compiler.OpDiv {
+			result = evaluator.Divide(left, right)
+		} else {
+			result = evaluator.Modulo(left, right)
+		}
+	}
+	if result == nil {
+		return vm.operatorError(f, ip, left, right)
+	}
+	vm.push(result)
+	return nil
+}
+
+func (vm *VM) comparison(f *frame, ip int, op compiler.Opcode) *evaluator.RuntimeError {
+	right, left := vm.pop(), vm.pop()
+	var cmp int
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			switch {
+			case l < r:
+				cmp = -1
+			case l > r:
+				cmp = 1
+			}
+			vm.push(compareResult(op, cmp))
+			return nil
+		}
+	}
+	cmp, ok := evaluator.Compare(left, right)
+	if !ok {
+		return vm.operatorError(f, ip, left, right)
+	}
+	vm.push(compareResult(op, cmp))
+	return nil
+}
+
+func compareResult(op compiler.Opcode, cmp int) bool {
+	switch op {
+	case compiler.OpLess:
+		return cmp < 0
+	case compiler.OpGreater:
+		return cmp > 0
+	case compiler.OpLessEqual:
+		return cmp <= 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func (vm *VM) operatorError(f *frame, ip int, left, right interface{}) *evaluator.RuntimeError {
+	node := f.fn.Nodes[ip].(*ast.InfixExpression)
+	return vm.newError(evaluator.ErrTypeMismatch, node,
+		"no se puede aplicar '%s' a %s y %s", node.Operator, evaluator.TypeName(left), evaluator.TypeName(right))
+}
+
+// Colecciones
+
+func (vm *VM) index(f *frame, ip int) *evaluator.RuntimeError {
+	index, container := vm.pop(), vm.pop()
+	node := f.fn.Nodes[ip]
+	switch c := container.(type) {
+	case *evaluator.List:
+		i, err := c.ResolveIndex(index)
+		if err != nil {
+			return vm.locate(err, node)
+		}
+		vm.push(c.Elements[i])
+	case string:
+		char, err := evaluator.StringIndex(c, index)
+		if err != nil {
+			return vm.locate(err, node)
+		}
+		vm.push(char)
+	case *evaluator.Dict:
+		if err := evaluator.CheckDictKey(index); err != nil {
+			return vm.locate(err, node)
+		}
+		value, ok := c.Get(index)
+		if !ok {
+			return vm.newError(evaluator.ErrKeyNotFound, node,
+				"la clave %s no existe en el diccionario", evaluator.InspectElement(index))
+		}
+		vm.push(value)
+	default:
+		return vm.newError(evaluator.ErrTypeMismatch, node,
+			"no se puede indexar un valor de tipo %s", evaluator.TypeName(container))
+	}
+	return nil
+}
+
+func (vm *VM) setIndex(f *frame, ip int) *evaluator.RuntimeError {
+	value, index, container := vm.pop(), vm.pop(), vm.pop()
+	node := f.fn.Nodes[ip]
+	switch c := container.(type) {
+	case *evaluator.List:
+		i, err := c.ResolveIndex(index)
+		if err != nil {
+			return vm.locate(err, node)
+		}
+		c.Elements[i] = value
+	case *evaluator.Dict:
+		if err := evaluator.CheckDictKey(index); err != nil {
+			return vm.locate(err, node)
+		}
+		c.Set(index, value)
+	default:
+		return vm.newError(evaluator.ErrTypeMismatch, node,
+			"no se puede asignar un elemento a un valor de tipo %s", evaluator.TypeName(container))
+	}
+	return nil
+}